@@ -31,6 +31,13 @@ func NewEncryptionKey() (*[32]byte, error) {
 // The implementation is copied (and then trivially-altered) from
 // https://github.com/gtank/cryptopasta/blob/bc3a108a5776376aa811eea34b93383837994340/encrypt.go#L34-L55
 func Encrypt(plaintext []byte, key *[32]byte) (ciphertext []byte, err error) {
+	return EncryptWithContext(plaintext, key, nil)
+}
+
+// EncryptWithContext encrypts data like Encrypt, and also
+// authenticates context as GCM additional data. The
+// ciphertext can only be decrypted with the same context.
+func EncryptWithContext(plaintext []byte, key *[32]byte, context []byte) (ciphertext []byte, err error) {
 	block, err := aes.NewCipher(key[:])
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new aes cipher: %v", err)
@@ -47,7 +54,7 @@ func Encrypt(plaintext []byte, key *[32]byte) (ciphertext []byte, err error) {
 		return nil, fmt.Errorf("failed to read nonce: %v", err)
 	}
 
-	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+	return gcm.Seal(nonce, nonce, plaintext, context), nil
 }
 
 // Decrypt decrypts data using 256-bit AES-GCM.  This both hides the content of
@@ -57,6 +64,13 @@ func Encrypt(plaintext []byte, key *[32]byte) (ciphertext []byte, err error) {
 // The implementation is copied (and then trivially-altered) from
 // https://github.com/gtank/cryptopasta/blob/bc3a108a5776376aa811eea34b93383837994340/encrypt.go#L57-L80
 func Decrypt(ciphertext []byte, key *[32]byte) (plaintext []byte, err error) {
+	return DecryptWithContext(ciphertext, key, nil)
+}
+
+// DecryptWithContext decrypts data which was encrypted
+// with EncryptWithContext. It fails if context does
+// not match the context that the data was encrypted with.
+func DecryptWithContext(ciphertext []byte, key *[32]byte, context []byte) (plaintext []byte, err error) {
 	block, err := aes.NewCipher(key[:])
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new aes cipher: %v", err)
@@ -74,6 +88,6 @@ func Decrypt(ciphertext []byte, key *[32]byte) (plaintext []byte, err error) {
 	return gcm.Open(nil,
 		ciphertext[:gcm.NonceSize()],
 		ciphertext[gcm.NonceSize():],
-		nil,
+		context,
 	)
 }
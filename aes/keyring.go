@@ -0,0 +1,233 @@
+package aes
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhoelle/redactr/watch"
+)
+
+// keyIDRE matches valid key IDs
+var keyIDRE = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// KeyID returns a short identifier for a key,
+// derived from the key's SHA-256 hash
+func KeyID(key *[32]byte) string {
+	sum := sha256.Sum256(key[:])
+	return hex.EncodeToString(sum[:4])
+}
+
+// A Keyring holds a set of keys, each identified by an ID.
+//
+// One of the keys is the primary key, which is used to
+// encrypt new secrets. Any key may be used to decrypt.
+//
+// A Keyring is safe for concurrent use, so that keys can
+// be added while secrets are decrypted.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[string]*[32]byte
+	ids     []string
+	primary string
+}
+
+// NewKeyring creates an empty Keyring
+func NewKeyring() *Keyring {
+	return &Keyring{
+		keys: make(map[string]*[32]byte),
+	}
+}
+
+// Add adds a key to the keyring. If id is empty,
+// the key's ID is derived with KeyID.
+//
+// The first key added to a keyring becomes its primary key.
+func (k *Keyring) Add(id string, key *[32]byte) error {
+	if key == nil {
+		return fmt.Errorf("missing key")
+	}
+	if id == "" {
+		id = KeyID(key)
+	}
+	if !keyIDRE.MatchString(id) {
+		return fmt.Errorf("invalid key ID %q (key IDs may only contain letters, digits, '_', '.' and '-')", id)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; ok {
+		return fmt.Errorf("duplicate key ID %q", id)
+	}
+
+	k.keys[id] = key
+	k.ids = append(k.ids, id)
+	if k.primary == "" {
+		k.primary = id
+	}
+	return nil
+}
+
+// SetPrimary sets the primary key of the keyring
+func (k *Keyring) SetPrimary(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("no key with ID %q in keyring", id)
+	}
+	k.primary = id
+	return nil
+}
+
+// Primary returns the primary key and its ID. If the
+// keyring is empty, Primary returns a nil key.
+func (k *Keyring) Primary() (string, *[32]byte) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.primary, k.keys[k.primary]
+}
+
+// Key returns the key with the given ID
+func (k *Keyring) Key(id string) (*[32]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// IDs returns the IDs of all keys in the keyring,
+// in the order that they were added
+func (k *Keyring) IDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	ids := make([]string, len(k.ids))
+	copy(ids, k.ids)
+	return ids
+}
+
+// Len returns the number of keys in the keyring
+func (k *Keyring) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.ids)
+}
+
+// keyringTokenVersion prefixes secrets redacted by a KeyringRedacter
+const keyringTokenVersion = "v2"
+
+// A KeyringRedacter translates between plaintext secret
+// tokens and AES-encrypted tokens, using the keys in
+// a Keyring.
+//
+// Redacted secrets record the ID of the key which
+// encrypted them, like:
+//
+//    v2:<key ID>:<base64 ciphertext>
+//
+// Unversioned secrets (as produced by a Redacter) can
+// also be unredacted. Since they do not record a key ID,
+// each key in the keyring is tried in turn.
+type KeyringRedacter struct {
+	Keyring *Keyring
+}
+
+// Redact returns an AES-256 GCM encrypted, base64-encoded
+// version of the plaintext, encrypted with the primary key
+// of the keyring
+func (r *KeyringRedacter) Redact(plaintext string) (string, error) {
+	return r.RedactWithContext(plaintext, "")
+}
+
+// RedactWithContext redacts plaintext like Redact, and
+// binds the redacted secret to context: it can only be
+// unredacted with UnredactWithContext and the same context.
+func (r *KeyringRedacter) RedactWithContext(plaintext, context string) (string, error) {
+	if r.Keyring == nil {
+		return "", fmt.Errorf("missing keyring")
+	}
+	id, key := r.Keyring.Primary()
+	if key == nil {
+		return "", fmt.Errorf("missing key: keyring is empty")
+	}
+
+	ciphertext, err := EncryptWithContext([]byte(plaintext), key, contextData(context))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt: %v", err)
+	}
+
+	return keyringTokenVersion + ":" + id + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Unredact decrypts a versioned or unversioned
+// secret into plaintext
+func (r *KeyringRedacter) Unredact(redacted string) (string, error) {
+	return r.UnredactWithContext(redacted, "")
+}
+
+// UnredactWithContext decrypts a versioned or unversioned
+// secret, which is bound to context, into plaintext
+func (r *KeyringRedacter) UnredactWithContext(redacted, context string) (string, error) {
+	if r.Keyring == nil || r.Keyring.Len() == 0 {
+		return "", fmt.Errorf("missing key: keyring is empty")
+	}
+
+	if !strings.HasPrefix(redacted, keyringTokenVersion+":") {
+		return r.unredactUnversioned(redacted, context)
+	}
+
+	ss := strings.SplitN(redacted, ":", 3)
+	if len(ss) != 3 {
+		return "", fmt.Errorf("malformed %v secret: expected %v:<key ID>:<ciphertext>", keyringTokenVersion, keyringTokenVersion)
+	}
+	id, ciphertextBase64 := ss[1], ss[2]
+
+	key, ok := r.Keyring.Key(id)
+	if !ok {
+		return "", fmt.Errorf("secret was encrypted with key %q, which is not in the keyring (keyring has: %v)", id, strings.Join(r.Keyring.IDs(), ", "))
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextBase64)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %v", err)
+	}
+
+	plaintext, err := DecryptWithContext(ciphertext, key, contextData(context))
+	if err != nil {
+		if context != "" {
+			return "", fmt.Errorf("failed to decrypt with key %q in context %q: %v (the secret may have been redacted in a different context)", id, context, err)
+		}
+		return "", fmt.Errorf("failed to decrypt with key %q: %v", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// WatchPayloads returns a Watcher which never reports
+// a change: an AES secret is encrypted in its token, so
+// it only changes when the token does
+func (r *KeyringRedacter) WatchPayloads(payloads []string, interval time.Duration) (watch.Watcher, error) {
+	return watch.Never(), nil
+}
+
+func (r *KeyringRedacter) unredactUnversioned(ciphertextBase64, context string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextBase64)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %v", err)
+	}
+
+	for _, id := range r.Keyring.IDs() {
+		key, _ := r.Keyring.Key(id)
+		plaintext, err := DecryptWithContext(ciphertext, key, contextData(context))
+		if err == nil {
+			return string(plaintext), nil
+		}
+	}
+	if context != "" {
+		return "", fmt.Errorf("failed to decrypt in context %q with any of the %v keys in the keyring (%v); the secret may have been redacted in a different context", context, r.Keyring.Len(), strings.Join(r.Keyring.IDs(), ", "))
+	}
+	return "", fmt.Errorf("failed to decrypt with any of the %v keys in the keyring (%v)", r.Keyring.Len(), strings.Join(r.Keyring.IDs(), ", "))
+}
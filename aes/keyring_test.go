@@ -0,0 +1,148 @@
+package aes
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	testKeyA = &[32]byte{1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 6, 6, 6, 6, 7, 7, 7, 7, 8, 8, 8, 8}
+	testKeyB = &[32]byte{42, 42, 42, 42, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 6, 6, 6, 6, 7, 7, 7, 7, 8, 8, 8, 8}
+)
+
+func testKeyring(t *testing.T, keys map[string]*[32]byte, ids ...string) *Keyring {
+	t.Helper()
+	k := NewKeyring()
+	for _, id := range ids {
+		if err := k.Add(id, keys[id]); err != nil {
+			t.Fatalf("Keyring.Add(%v) got err: %v", id, err)
+		}
+	}
+	return k
+}
+
+func TestKeyring_Add(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		key     *[32]byte
+		wantID  string
+		wantErr bool
+	}{
+		{name: "explicit ID", id: "2019-q3", key: testKeyA, wantID: "2019-q3"},
+		{name: "derived ID", key: testKeyA, wantID: KeyID(testKeyA)},
+		{name: "invalid ID", id: "not:valid", key: testKeyA, wantErr: true},
+		{name: "missing key", id: "foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewKeyring()
+			err := k.Add(tt.id, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Keyring.Add() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if id, _ := k.Primary(); id != tt.wantID {
+				t.Errorf("Keyring.Primary() = %v, want %v", id, tt.wantID)
+			}
+		})
+	}
+
+	t.Run("duplicate IDs", func(t *testing.T) {
+		k := NewKeyring()
+		if err := k.Add("a", testKeyA); err != nil {
+			t.Fatal(err)
+		}
+		if err := k.Add("a", testKeyB); err == nil {
+			t.Errorf("Keyring.Add(): expected an error for a duplicate ID, got none")
+		}
+	})
+}
+
+func TestKeyringRedacter(t *testing.T) {
+	keys := map[string]*[32]byte{"a": testKeyA, "b": testKeyB}
+
+	t.Run("it should redact with the primary key, and record its ID", func(t *testing.T) {
+		k := testKeyring(t, keys, "b", "a")
+		r := &KeyringRedacter{Keyring: k}
+
+		got, err := r.Redact("hunter2")
+		if err != nil {
+			t.Fatalf("KeyringRedacter.Redact() got err: %v", err)
+		}
+		re := regexp.MustCompile(`^v2:b:(?:[A-Za-z0-9+/]{4})*(?:[A-Za-z0-9+/]{2}==|[A-Za-z0-9+/]{3}=)?$`)
+		if !re.MatchString(got) {
+			t.Fatalf("KeyringRedacter.Redact() doesn't match regex\n\tregex: %v\n\t  got: %v", re, got)
+		}
+
+		// a keyring in which "b" is not the primary key
+		other := testKeyring(t, keys, "a", "b")
+		unredacted, err := (&KeyringRedacter{Keyring: other}).Unredact(got)
+		if err != nil {
+			t.Fatalf("KeyringRedacter.Unredact() got err: %v", err)
+		}
+		if unredacted != "hunter2" {
+			t.Errorf("KeyringRedacter.Unredact() = %v, want hunter2", unredacted)
+		}
+	})
+
+	tests := []struct {
+		name        string
+		ids         []string
+		s           string
+		want        string
+		wantErrText string
+	}{
+		{
+			name: "unversioned secrets are decrypted by trying every key",
+			ids:  []string{"b", "a"},
+			s:    "KHnpT8YvbfqjsxIiAmRQ54EDDe6tjBtZi24/YqNyTVxwp8E=",
+			want: "hunter2",
+		},
+		{
+			name:        "unversioned secrets which no key can decrypt",
+			ids:         []string{"b"},
+			s:           "KHnpT8YvbfqjsxIiAmRQ54EDDe6tjBtZi24/YqNyTVxwp8E=",
+			wantErrText: "any of the 1 keys",
+		},
+		{
+			name:        "versioned secrets with an unknown key ID",
+			ids:         []string{"a"},
+			s:           "v2:c:KHnpT8YvbfqjsxIiAmRQ54EDDe6tjBtZi24/YqNyTVxwp8E=",
+			wantErrText: `key "c"`,
+		},
+		{
+			name:        "versioned secrets with the wrong key",
+			ids:         []string{"a", "b"},
+			s:           "v2:b:KHnpT8YvbfqjsxIiAmRQ54EDDe6tjBtZi24/YqNyTVxwp8E=",
+			wantErrText: `failed to decrypt with key "b"`,
+		},
+		{
+			name:        "empty keyring",
+			s:           "KHnpT8YvbfqjsxIiAmRQ54EDDe6tjBtZi24/YqNyTVxwp8E=",
+			wantErrText: "keyring is empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &KeyringRedacter{Keyring: testKeyring(t, keys, tt.ids...)}
+			got, err := r.Unredact(tt.s)
+			if tt.wantErrText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Errorf("KeyringRedacter.Unredact(): expected error with %q, got: %v", tt.wantErrText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("KeyringRedacter.Unredact() got err: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("KeyringRedacter.Unredact() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
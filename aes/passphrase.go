@@ -0,0 +1,115 @@
+package aes
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeyDescriptorTypeScrypt identifies keys derived
+// from a passphrase with scrypt
+const KeyDescriptorTypeScrypt = "scrypt"
+
+// Default scrypt cost parameters for new key descriptors.
+// These follow the recommendations for interactive use in
+// https://godoc.org/golang.org/x/crypto/scrypt#Key
+const (
+	DefaultScryptN = 1 << 15
+	DefaultScryptR = 8
+	DefaultScryptP = 1
+)
+
+// A KeyDescriptor describes how to derive a key
+// from a passphrase: the KDF, its salt and its
+// cost parameters.
+//
+// A KeyDescriptor holds no secret material. It is
+// usually stored in a small JSON file, like:
+//
+//    {
+//      "type": "scrypt",
+//      "salt": "n7G9ZMHJEHlC9YeSQy1R3w==",
+//      "n": 32768,
+//      "r": 8,
+//      "p": 1
+//    }
+//
+type KeyDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// NewKeyDescriptor creates a scrypt KeyDescriptor
+// with a random salt and the default cost parameters
+func NewKeyDescriptor() (*KeyDescriptor, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to read random data: %v", err)
+	}
+	return &KeyDescriptor{
+		Type: KeyDescriptorTypeScrypt,
+		Salt: salt,
+		N:    DefaultScryptN,
+		R:    DefaultScryptR,
+		P:    DefaultScryptP,
+	}, nil
+}
+
+// ParseKeyDescriptor parses a JSON key descriptor
+func ParseKeyDescriptor(b []byte) (*KeyDescriptor, error) {
+	d := &KeyDescriptor{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, fmt.Errorf("failed to parse key descriptor: %v", err)
+	}
+	if err := d.validate(); err != nil {
+		return nil, fmt.Errorf("invalid key descriptor: %v", err)
+	}
+	return d, nil
+}
+
+// DeriveKey derives a 256-bit key from a passphrase
+func (d *KeyDescriptor) DeriveKey(passphrase string) (*[32]byte, error) {
+	if err := d.validate(); err != nil {
+		return nil, fmt.Errorf("invalid key descriptor: %v", err)
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("missing passphrase")
+	}
+
+	dk, err := scrypt.Key([]byte(passphrase), d.Salt, d.N, d.R, d.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	key := &[32]byte{}
+	copy(key[:], dk)
+	return key, nil
+}
+
+func (d *KeyDescriptor) validate() error {
+	if d.Type != KeyDescriptorTypeScrypt {
+		return fmt.Errorf("unsupported type %q (supported: %v)", d.Type, KeyDescriptorTypeScrypt)
+	}
+	if len(d.Salt) < 16 {
+		return fmt.Errorf("salt must be at least 16 bytes (got %v)", len(d.Salt))
+	}
+
+	// Guard against descriptors which are too weak, or
+	// which would take an unreasonable amount of memory
+	if d.N < 1<<14 || d.N > 1<<22 || d.N&(d.N-1) != 0 {
+		return fmt.Errorf("n must be a power of two between 2^14 and 2^22 (got %v)", d.N)
+	}
+	if d.R < 1 || d.R > 32 {
+		return fmt.Errorf("r must be between 1 and 32 (got %v)", d.R)
+	}
+	if d.P < 1 || d.P > 16 {
+		return fmt.Errorf("p must be between 1 and 16 (got %v)", d.P)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package aes
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestKeyDescriptor_DeriveKey(t *testing.T) {
+	d, err := NewKeyDescriptor()
+	if err != nil {
+		t.Fatalf("NewKeyDescriptor() got err: %v", err)
+	}
+	d.N = 1 << 14 // keep the test fast
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseKeyDescriptor(b)
+	if err != nil {
+		t.Fatalf("ParseKeyDescriptor() got err: %v", err)
+	}
+
+	k1, err := d.DeriveKey("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("KeyDescriptor.DeriveKey() got err: %v", err)
+	}
+	k2, err := parsed.DeriveKey("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("KeyDescriptor.DeriveKey() got err: %v", err)
+	}
+	if *k1 != *k2 {
+		t.Errorf("KeyDescriptor.DeriveKey() should derive the same key from the same passphrase and descriptor")
+	}
+
+	k3, err := parsed.DeriveKey("Tr0ub4dor&3")
+	if err != nil {
+		t.Fatalf("KeyDescriptor.DeriveKey() got err: %v", err)
+	}
+	if *k1 == *k3 {
+		t.Errorf("KeyDescriptor.DeriveKey() should derive different keys from different passphrases")
+	}
+
+	other, err := NewKeyDescriptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.N = 1 << 14
+	k4, err := other.DeriveKey("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("KeyDescriptor.DeriveKey() got err: %v", err)
+	}
+	if *k1 == *k4 {
+		t.Errorf("KeyDescriptor.DeriveKey() should derive different keys with different salts")
+	}
+}
+
+func TestParseKeyDescriptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		json        string
+		wantErrText string
+	}{
+		{
+			name: "valid",
+			json: `{"type": "scrypt", "salt": "n7G9ZMHJEHlC9YeSQy1R3w==", "n": 32768, "r": 8, "p": 1}`,
+		},
+		{
+			name:        "unsupported type",
+			json:        `{"type": "md5", "salt": "n7G9ZMHJEHlC9YeSQy1R3w==", "n": 32768, "r": 8, "p": 1}`,
+			wantErrText: "unsupported type",
+		},
+		{
+			name:        "short salt",
+			json:        `{"type": "scrypt", "salt": "c2FsdA==", "n": 32768, "r": 8, "p": 1}`,
+			wantErrText: "salt",
+		},
+		{
+			name:        "weak cost",
+			json:        `{"type": "scrypt", "salt": "n7G9ZMHJEHlC9YeSQy1R3w==", "n": 1024, "r": 8, "p": 1}`,
+			wantErrText: "n must be",
+		},
+		{
+			name:        "not json",
+			json:        `hunter2`,
+			wantErrText: "failed to parse",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKeyDescriptor([]byte(tt.json))
+			if tt.wantErrText == "" {
+				if err != nil {
+					t.Errorf("ParseKeyDescriptor() got err: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrText) {
+				t.Errorf("ParseKeyDescriptor(): expected error with %q, got: %v", tt.wantErrText, err)
+			}
+		})
+	}
+}
@@ -14,11 +14,19 @@ type Redacter struct {
 // Redact returns an AES-256 GCM encrypted,
 // base64-redacted version of the plaintext
 func (r *Redacter) Redact(plaintext string) (string, error) {
+	return r.RedactWithContext(plaintext, "")
+}
+
+// RedactWithContext returns an AES-256 GCM encrypted,
+// base64-redacted version of the plaintext, which is
+// bound to context: it can only be unredacted with
+// UnredactWithContext and the same context.
+func (r *Redacter) RedactWithContext(plaintext, context string) (string, error) {
 	if r.Key == nil {
 		return "", fmt.Errorf("missing key")
 	}
 
-	ciphertext, err := Encrypt([]byte(plaintext), r.Key)
+	ciphertext, err := EncryptWithContext([]byte(plaintext), r.Key, contextData(context))
 	if err != nil {
 		return "", fmt.Errorf("failed to encrypt: %v", err)
 	}
@@ -29,6 +37,13 @@ func (r *Redacter) Redact(plaintext string) (string, error) {
 // Unredact unredacts an AES-256 GCM encrypted,
 // base64-redacted secret into plaintext
 func (r *Redacter) Unredact(ciphertextBase64 string) (string, error) {
+	return r.UnredactWithContext(ciphertextBase64, "")
+}
+
+// UnredactWithContext unredacts an AES-256 GCM encrypted,
+// base64-redacted secret, which is bound to context,
+// into plaintext
+func (r *Redacter) UnredactWithContext(ciphertextBase64, context string) (string, error) {
 	if r.Key == nil {
 		return "", fmt.Errorf("missing key")
 	}
@@ -38,10 +53,22 @@ func (r *Redacter) Unredact(ciphertextBase64 string) (string, error) {
 		return "", fmt.Errorf("failed to unredact base64: %v", err)
 	}
 
-	plaintext, err := Decrypt([]byte(ciphertext), r.Key)
+	plaintext, err := DecryptWithContext([]byte(ciphertext), r.Key, contextData(context))
 	if err != nil {
+		if context != "" {
+			return "", fmt.Errorf("failed to decrypt in context %q: %v (the secret may have been redacted in a different context, or with a different key)", context, err)
+		}
 		return "", fmt.Errorf("failed to decrypt: %v", err)
 	}
 
 	return string(plaintext), nil
 }
+
+// contextData converts a context label
+// into GCM additional data
+func contextData(context string) []byte {
+	if context == "" {
+		return nil
+	}
+	return []byte(context)
+}
@@ -2,6 +2,7 @@ package aes
 
 import (
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -115,3 +116,29 @@ func TestRedacter_Unredact(t *testing.T) {
 		})
 	}
 }
+
+func TestRedacter_Context(t *testing.T) {
+	e := &Redacter{
+		Key: &[32]byte{1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 6, 6, 6, 6, 7, 7, 7, 7, 8, 8, 8, 8},
+	}
+
+	redacted, err := e.RedactWithContext("hunter2", "db-password")
+	if err != nil {
+		t.Fatalf("Redacter.RedactWithContext() got err: %v", err)
+	}
+
+	got, err := e.UnredactWithContext(redacted, "db-password")
+	if err != nil {
+		t.Fatalf("Redacter.UnredactWithContext() got err: %v", err)
+	}
+	if got != "hunter2" {
+		t.Errorf("Redacter.UnredactWithContext() = %v, want hunter2", got)
+	}
+
+	if _, err := e.UnredactWithContext(redacted, "admin-password"); err == nil || !strings.Contains(err.Error(), `"admin-password"`) {
+		t.Errorf(`Redacter.UnredactWithContext() in another context: expected error with "admin-password", got: %v`, err)
+	}
+	if _, err := e.Unredact(redacted); err == nil {
+		t.Errorf("Redacter.Unredact() without a context: expected an error, got none")
+	}
+}
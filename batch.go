@@ -0,0 +1,103 @@
+package redactr
+
+import "fmt"
+
+// A BatchRedacter is a Provider which can redact many
+// payloads at once, like the "vault-transit" provider,
+// which sends them to Vault in one request. RedactTokens
+// hands it the payloads of every token in the text (apart
+// from those with context labels) in one batch.
+type BatchRedacter interface {
+	RedactBatch(payloads []string) ([]string, error)
+}
+
+// A BatchUnredacter is a Provider which can unredact
+// many payloads at once. UnredactTokens hands it the
+// payloads of every token in the text (apart from those
+// with context labels) in one batch.
+type BatchUnredacter interface {
+	UnredactBatch(payloads []string) ([]string, error)
+}
+
+// A PayloadRewrapper is a Provider which can re-encrypt
+// redacted payloads under the latest version of a key
+// (after the key is rotated) without unredacting them,
+// like the "vault-transit" provider. See RewrapTokens.
+type PayloadRewrapper interface {
+	RewrapPayloads(payloads []string) ([]string, error)
+}
+
+// RewrapTokens rewraps every redacted token in s whose
+// provider is a PayloadRewrapper, in one batch per provider.
+// It returns the rewrapped text, and the number of tokens
+// that were rewrapped.
+func (r *Registry) RewrapTokens(s string) (string, int, error) {
+	tokens := r.locate(s)
+	payloads := make([]string, len(tokens))
+	for i, t := range tokens {
+		payloads[i] = s[t.PayloadStart:t.PayloadEnd]
+	}
+
+	rewrapped, err := batchPayloads(tokens, payloads, "rewrap", func(t providerToken) func([]string) ([]string, error) {
+		if pr, ok := r.providers[t.provider].(PayloadRewrapper); ok && t.redacted {
+			return pr.RewrapPayloads
+		}
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	var locations []ContextTokenLocation
+	var replacements []string
+	for i, t := range tokens {
+		payload, ok := rewrapped[i]
+		if !ok {
+			continue
+		}
+		locations = append(locations, t.ContextTokenLocation)
+		replacements = append(replacements, r.wrap(true, t.provider, t.Context, payload))
+	}
+	return replaceLocations(s, locations, replacements), len(locations), nil
+}
+
+// batchPayloads hands the payloads of tokens to the batch
+// functions of their providers (as returned by batchFunc,
+// which returns nil for tokens that are not batched), in
+// one call per provider. It returns the results by the
+// index of their tokens.
+func batchPayloads(tokens []providerToken, payloads []string, verb string, batchFunc func(providerToken) func([]string) ([]string, error)) (map[int]string, error) {
+	var names []string
+	funcs := make(map[string]func([]string) ([]string, error))
+	indexes := make(map[string][]int)
+	for i, t := range tokens {
+		f := batchFunc(t)
+		if f == nil {
+			continue
+		}
+		if _, ok := funcs[t.provider]; !ok {
+			names = append(names, t.provider)
+			funcs[t.provider] = f
+		}
+		indexes[t.provider] = append(indexes[t.provider], i)
+	}
+
+	results := make(map[int]string)
+	for _, name := range names {
+		var batch []string
+		for _, i := range indexes[name] {
+			batch = append(batch, payloads[i])
+		}
+		out, err := funcs[name](batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to %v %v tokens: %v", verb, name, err)
+		}
+		if len(out) != len(batch) {
+			return nil, fmt.Errorf("failed to %v %v tokens: expected %v results, got %v", verb, name, len(batch), len(out))
+		}
+		for j, i := range indexes[name] {
+			results[i] = out[j]
+		}
+	}
+	return results, nil
+}
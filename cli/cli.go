@@ -3,18 +3,23 @@ package cli
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/dhoelle/redactr"
 	"github.com/dhoelle/redactr/aes"
+	"github.com/dhoelle/redactr/escape"
 	"github.com/urfave/cli"
 
 	goexec "os/exec"
+
+	redactrexec "github.com/dhoelle/redactr/exec"
 )
 
 //go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/token_redacter_unredacter.go --fake-name TokenRedacterUnredacter . TokenRedacterUnredacter
@@ -25,6 +30,14 @@ type TokenRedacterUnredacter interface {
 	UnredactTokens(string, ...redactr.UnredactTokensOption) (string, error)
 }
 
+//go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/token_streamer.go --fake-name TokenStreamer . TokenStreamer
+
+// A TokenStreamer can redact and unredact tokens in a stream
+type TokenStreamer interface {
+	RedactStream(io.Reader, io.Writer) error
+	UnredactStream(io.Reader, io.Writer, ...redactr.UnredactTokensOption) error
+}
+
 //go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/execer.go --fake-name Execer . Execer
 
 // An Execer can exec a shell command
@@ -32,14 +45,52 @@ type Execer interface {
 	Exec(name string, args []string, opts ...redactr.ExecOption) error
 }
 
+//go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/rekeyer.go --fake-name Rekeyer . Rekeyer
+
+// A Rekeyer can re-encrypt redacted tokens under new keys,
+// which are configured like the Tool's own keys
+type Rekeyer interface {
+	RekeyTokens(s string, newKeys ...redactr.NewToolOption) (string, int, error)
+	RekeyFiles(paths []string, newKeys ...redactr.NewToolOption) ([]redactr.RekeyResult, error)
+}
+
+//go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/rewrapper.go --fake-name Rewrapper . Rewrapper
+
+// A Rewrapper can re-encrypt redacted tokens under the
+// latest version of a rotated key, like a Vault transit key
+type Rewrapper interface {
+	RewrapTokens(s string) (string, int, error)
+	RewrapFiles(paths []string) ([]redactr.RekeyResult, error)
+}
+
 // CLI provides a command-line interface for redactr
 type CLI struct {
 	cliApp *cli.App
 }
 
-// Run runs the CLI
+// Run runs the CLI.
+//
+// If a command run by exec fails, Run returns its error,
+// which has an ExitCode method (see exec.ExitError). The
+// caller should exit with that code. (Run doesn't exit,
+// so that the Tool is closed first.)
 func (c *CLI) Run(arguments []string) error {
-	return c.cliApp.Run(arguments)
+	err := c.cliApp.Run(arguments)
+	switch e := err.(type) {
+	case commandExit:
+		return e.err
+	case cli.MultiError:
+		// the Tool failed to close, after
+		// the command had already failed
+		for i, err := range e.Errors {
+			if ce, ok := err.(commandExit); ok {
+				others := append(append([]error{}, e.Errors[:i]...), e.Errors[i+1:]...)
+				log.Printf("redactr: %v", cli.NewMultiError(others...))
+				return ce.err
+			}
+		}
+	}
+	return err
 }
 
 // Config is used to configure a CLI
@@ -73,25 +124,53 @@ func Date(v string) NewOption {
 	}
 }
 
-// New creates a new CLI
-func New(ted TokenRedacterUnredacter, execer Execer, opts ...NewOption) (*CLI, error) {
+// New creates a new CLI. The CLI uses newTool to create
+// a Tool, configured by its global flags, the first time
+// that a command needs one.
+func New(newTool ToolFactory, opts ...NewOption) (*CLI, error) {
 	conf := &Config{}
 	for _, o := range opts {
 		o(conf)
 	}
 
+	tool := &toolProxy{newTool: newTool}
+
 	app := cli.NewApp()
 	app.Usage = "redact and unredact secrets"
 	app.Version = versionString(conf.version, conf.commit, conf.date)
+	app.Flags = globalFlags
+	app.Before = func(c *cli.Context) error {
+		opts, err := toolOptions(c)
+		if err != nil {
+			return err
+		}
+		tool.opts = opts
+		return nil
+	}
+	app.After = func(c *cli.Context) error {
+		return tool.Close()
+	}
 	app.Commands = []cli.Command{
 		{
 			Name:    "keygen",
 			Aliases: []string{"key", "k"},
 			Usage:   "generate a key",
+			UsageText: `Generate a key.
+
+   With --type 32byte (the default), generate a random AES key for AES_KEY.
+
+   With --type passphrase, generate a key descriptor for deriving an AES key
+   from a passphrase. The descriptor holds a random salt and the KDF's cost
+   parameters, and no secret material. Save it to a file, and set
+   AES_KEY_DESCRIPTOR to the file and AES_PASSPHRASE to your passphrase:
+
+		$ redactr keygen --type passphrase > .redactr-key.json
+		$ export AES_KEY_DESCRIPTOR=.redactr-key.json
+		$ export AES_PASSPHRASE="correct horse battery staple"`,
 			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:  "type, t",
-					Usage: "type of key to generate (choices: 32byte) (default: 32byte)",
+					Usage: "type of key to generate (choices: 32byte, passphrase) (default: 32byte)",
 				},
 			},
 			Action: keygen(os.Stdout),
@@ -100,25 +179,119 @@ func New(ted TokenRedacterUnredacter, execer Execer, opts ...NewOption) (*CLI, e
 			Name:    "redact",
 			Aliases: []string{"r"},
 			Usage:   "redact embedded secrets",
-			Action:  redact(ted, os.Stdin, os.Stdout),
+			Action:  redact(tool, tool, os.Stdin, os.Stdout),
 		},
 		{
 			Name:    "unredact",
 			Aliases: []string{"u"},
 			Usage:   "unredact embedded secrets",
+			UsageText: `Unredact the secrets in the arguments or, if there are none, in stdin (or --in).
+
+   With --format, secrets are escaped for where they sit in a document of that
+   format, like a JSON string or a single-quoted YAML scalar. The format of
+   --in is detected from its name (like config.json), unless it is given.
+
+		$ redactr unredact --in config.json > config.unredacted.json
+		$ redactr unredact --format yaml < values.yaml`,
 			Flags: []cli.Flag{
 				cli.BoolFlag{
 					Name:  "wrap-tokens, w",
 					Usage: "wrap unredacted tokens",
 				},
+				cli.StringFlag{
+					Name:  "format, f",
+					Usage: "escape secrets for the input's format (choices: raw, json, yaml, shell, dotenv) (default: detected from --in, or raw)",
+				},
+				cli.StringFlag{
+					Name:  "in, i",
+					Usage: "read input from a file, rather than stdin",
+				},
+			},
+			Action: unredact(tool, tool, os.Stdin, os.Stdout),
+		},
+		{
+			Name:  "rekey",
+			Usage: "re-encrypt AES secrets under a new key",
+			UsageText: `Re-encrypt every AES secret (~~redacted-aes:...~~) in the given files or
+   directories under a new key. Secrets are decrypted and re-encrypted in memory.
+
+   Secrets are decrypted with the keys that every command uses (AES_KEY,
+   AES_KEYRING, --key-file, --key-fd, --key-command or AES_PASSPHRASE). The
+   new key is read from the same kinds of sources: NEW_AES_KEY, --new-key-file,
+   --new-key-fd, --new-key-command or NEW_AES_PASSPHRASE.
+
+   If any secret fails to decrypt with the old key, no files are changed.
+
+   If no files are given, rekey reads from stdin and writes to stdout.
+
+   For example:
+
+		$ AES_KEY="xuY6/V0ZE29RtPD3TNWga/EkdU3XYsPtBIk8U4nzZyc=" \
+		  NEW_AES_KEY="$(redactr keygen)" \
+		  redactr rekey config/ secrets.yaml
+
+		# example output:
+		# config/app.yaml: 2 secrets rekeyed
+		# secrets.yaml: 5 secrets rekeyed
+
+		$ redactr --key-command "pass show redactr/old" \
+		  rekey --new-key-command "pass show redactr/new" config/`,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "new-key",
+					Usage:  "the key to re-encrypt secrets with",
+					EnvVar: "NEW_AES_KEY",
+				},
+				cli.StringFlag{
+					Name:   "new-key-file",
+					Usage:  "read the new key from a file, which must only be accessible by its owner",
+					EnvVar: "NEW_AES_KEY_FILE",
+				},
+				cli.IntFlag{
+					Name:   "new-key-fd",
+					Usage:  "read the new key from an inherited file descriptor",
+					EnvVar: "NEW_AES_KEY_FD",
+					Value:  -1,
+				},
+				cli.StringFlag{
+					Name:   "new-key-command",
+					Usage:  "read the new key from the output of a command (run with sh -c)",
+					EnvVar: "NEW_AES_KEY_COMMAND",
+				},
+				cli.StringFlag{
+					Name:   "new-key-descriptor",
+					Usage:  "derive the new key from NEW_AES_PASSPHRASE with the KDF parameters in this file",
+					EnvVar: "NEW_AES_KEY_DESCRIPTOR",
+				},
 			},
-			Action: unredact(ted, os.Stdin, os.Stdout),
+			Action: rekey(tool, os.Stdin, os.Stdout),
+		},
+		{
+			Name:  "rewrap",
+			Usage: "re-encrypt Vault transit secrets under the latest version of their keys",
+			UsageText: `Rewrap every Vault transit secret (~~redacted-vault-transit:...~~) in the
+   given files or directories under the latest version of its key, after the
+   key is rotated. Secrets are rewrapped by Vault, without being decrypted.
+
+   If any secret fails to rewrap, no files are changed.
+
+   If no files are given, rewrap reads from stdin and writes to stdout.
+
+   For example:
+
+		$ vault write -f transit/keys/app/rotate
+		$ redactr rewrap config/ secrets.yaml
+
+		# example output:
+		# config/app.yaml: 2 secrets rewrapped
+		# secrets.yaml: 5 secrets rewrapped`,
+			Action: rewrap(tool, os.Stdin, os.Stdout),
 		},
 		{
 			Name:      "edit",
 			Usage:     "edit a redacted file",
 			UsageText: `Edit a redacted file. Secrets will be redacted again once you finish editing.`,
-			Action:    edit(ted),
+			Action:    edit(tool),
 		},
 		{
 			Name:  "exec",
@@ -136,9 +309,12 @@ func New(ted TokenRedacterUnredacter, execer Execer, opts ...NewOption) (*CLI, e
 				# example output:
 				# my password is hunter2
 
-		2. If you set the --restart-if-env-changes or --stop-if-env-changes options,
-		   it will periodically re-check the environment. If the environment changes
-		   (e.g. a secret is updated in Vault), the command will be restarted or stopped.
+		2. If you set the --restart-if-env-changes, --stop-if-env-changes or
+		   --signal-if-env-changes options, it will periodically re-check the environment.
+		   If the environment changes (e.g. a secret is updated in Vault), the command
+		   will be restarted, stopped, or sent --signal-on-change (after @redacted:
+		   files are rewritten). --signal-on-change alone re-checks the environment
+		   every 10s.
 
 		   For example:
 
@@ -165,8 +341,88 @@ func New(ted TokenRedacterUnredacter, execer Execer, opts ...NewOption) (*CLI, e
 					Name:  "stop-if-env-changes, s",
 					Usage: "periodically re-evaluate the environment. If it changes, stop the command",
 				},
+				cli.DurationFlag{
+					Name:  "signal-if-env-changes",
+					Usage: "periodically re-evaluate the environment. If it changes, rewrite @redacted: files and send the command --signal-on-change",
+				},
+				cli.StringFlag{
+					Name:  "signal-on-change",
+					Value: "HUP",
+					Usage: "the signal sent by --signal-if-env-changes. Set alone, it implies --signal-if-env-changes " + redactr.DefaultPollInterval.String(),
+				},
+				cli.StringSliceFlag{
+					Name:  "poll-interval",
+					Usage: "how often to check the secrets of a provider for changes, like vault=30s (overrides the interval of --*-if-env-changes)",
+				},
+				cli.BoolFlag{
+					Name:  "restart-on-failure",
+					Usage: "if the command fails, restart it (with exponential backoff)",
+				},
+				cli.IntFlag{
+					Name:  "max-restarts",
+					Value: redactr.DefaultRestartPolicy.MaxRestarts,
+					Usage: "with --restart-on-failure, give up after the command fails this many times in a row (or within --restart-window). 0 means no limit",
+				},
+				cli.DurationFlag{
+					Name:  "restart-window",
+					Usage: "with --restart-on-failure, only count failures within this window",
+				},
+				cli.DurationFlag{
+					Name:  "min-uptime",
+					Value: redactr.DefaultRestartPolicy.MinUptime,
+					Usage: "with --restart-on-failure, a command which runs this long is healthy, and its failure resets the backoff and count of failures. 0 means every failure counts",
+				},
+				cli.DurationFlag{
+					Name:  "restart-backoff",
+					Value: redactr.DefaultRestartPolicy.InitialBackoff,
+					Usage: "with --restart-on-failure, how long to wait before the first restart (doubled for each consecutive failure)",
+				},
+				cli.DurationFlag{
+					Name:  "max-restart-backoff",
+					Value: redactr.DefaultRestartPolicy.MaxBackoff,
+					Usage: "with --restart-on-failure, the longest wait between restarts",
+				},
+				cli.BoolFlag{
+					Name:  "keep-key-env",
+					Usage: "pass AES key variables (like AES_KEY) through to the command",
+				},
+				cli.StringSliceFlag{
+					Name:  "env, e",
+					Usage: "add a variable, like FOO=bar, to the command's environment (its value may hold redacted tokens)",
+				},
+				cli.StringSliceFlag{
+					Name:  "env-file",
+					Usage: "add the variables in a .env file to the command's environment (their values may hold redacted tokens)",
+				},
+				cli.BoolFlag{
+					Name:  "tty, t",
+					Usage: "run the command in a pseudo-terminal, for interactive programs (like psql)",
+				},
+				cli.BoolFlag{
+					Name:  "secrets-dir",
+					Usage: "deliver secrets in files in a private directory, rather than in environment variables (FOO becomes FOO_FILE=<path>)",
+				},
+				cli.BoolFlag{
+					Name:  "mask-output",
+					Usage: "replace unredacted secrets in the command's output and errors with --mask-placeholder",
+				},
+				cli.StringFlag{
+					Name:  "mask-placeholder",
+					Value: "****",
+					Usage: "the placeholder for secrets masked by --mask-output",
+				},
+				cli.StringFlag{
+					Name:  "stop-signal",
+					Value: "TERM",
+					Usage: "the signal which asks the command to stop, when it is stopped or restarted",
+				},
+				cli.DurationFlag{
+					Name:  "stop-grace-period",
+					Value: redactrexec.DefaultStopGracePeriod,
+					Usage: "how long to wait for the command to exit after --stop-signal, before killing it",
+				},
 			},
-			Action: exec(execer),
+			Action: exec(tool),
 		},
 	}
 
@@ -177,70 +433,164 @@ func New(ted TokenRedacterUnredacter, execer Execer, opts ...NewOption) (*CLI, e
 
 func keygen(out io.Writer) func(*cli.Context) error {
 	return func(c *cli.Context) error {
-		// the "type" flag is reserved for use with future
-		// key types, but for now there is only one option :)
-		typ := c.String("type")
-		if typ != "" && typ != "32byte" {
-			return fmt.Errorf("type must be in: [32byte]")
+		switch typ := c.String("type"); typ {
+		case "", "32byte":
+			key, err := aes.NewEncryptionKey()
+			if err != nil {
+				return fmt.Errorf("failed to generate AES encryption key: %v", err)
+			}
+
+			fmt.Fprintln(out, base64.StdEncoding.EncodeToString(key[:]))
+			return nil
+
+		case "passphrase":
+			d, err := aes.NewKeyDescriptor()
+			if err != nil {
+				return fmt.Errorf("failed to generate key descriptor: %v", err)
+			}
+
+			b, err := json.MarshalIndent(d, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal key descriptor: %v", err)
+			}
+			fmt.Fprintln(out, string(b))
+			return nil
+
+		default:
+			return fmt.Errorf("type must be in: [32byte, passphrase]")
+		}
+	}
+}
+
+// redact redacts tokens in its arguments or, if
+// there are none, streams input to output
+func redact(ted redactr.TokenRedacterUnredacter, ts TokenStreamer, in io.Reader, out io.Writer) func(*cli.Context) error {
+	return func(c *cli.Context) error {
+		if !c.Args().Present() {
+			if err := ts.RedactStream(in, out); err != nil {
+				return fmt.Errorf("failed to redact tokens: %v", err)
+			}
+			return nil
 		}
 
-		key, err := aes.NewEncryptionKey()
+		redacted, err := ted.RedactTokens(strings.Join(c.Args(), " "))
 		if err != nil {
-			return fmt.Errorf("failed to generate AES encryption key: %v", err)
+			return fmt.Errorf("failed to redact tokens: %v", err)
 		}
 
-		fmt.Fprintln(out, base64.StdEncoding.EncodeToString(key[:]))
+		fmt.Fprintln(out, redacted)
 		return nil
 	}
 }
 
-func redact(ted redactr.TokenRedacterUnredacter, in io.Reader, out io.Writer) func(*cli.Context) error {
+// unredact unredacts tokens in its arguments or, if
+// there are none, streams input to output
+func unredact(ted redactr.TokenRedacterUnredacter, ts TokenStreamer, in io.Reader, out io.Writer) func(*cli.Context) error {
 	return func(c *cli.Context) error {
-		var input string
-		if c.Args().Present() {
-			input = strings.Join(c.Args(), " ")
-		} else {
-			b, err := ioutil.ReadAll(in)
+		var opts []redactr.UnredactTokensOption
+		if c.Bool("wrap-tokens") {
+			opts = append(opts, redactr.WrapTokens)
+		}
+
+		inFile := c.String("in")
+		if inFile != "" && c.Args().Present() {
+			return fmt.Errorf("unredact reads from its arguments or --in, not both")
+		}
+
+		format := escape.FormatOf(inFile)
+		if f := c.String("format"); f != "" {
+			var err error
+			format, err = escape.ParseFormat(f)
 			if err != nil {
-				return fmt.Errorf("failed to read input: %v", err)
+				return err
 			}
-			input = string(b)
+		}
+		if format != escape.Raw {
+			opts = append(opts, redactr.EscapeFor(format))
+		}
+
+		if !c.Args().Present() {
+			if inFile != "" {
+				f, err := os.Open(inFile)
+				if err != nil {
+					return fmt.Errorf("failed to open %v: %v", inFile, err)
+				}
+				defer f.Close()
+				in = f
+			}
+			if err := ts.UnredactStream(in, out, opts...); err != nil {
+				return fmt.Errorf("failed to unredact tokens: %v", err)
+			}
+			return nil
 		}
 
-		redacted, err := ted.RedactTokens(input)
+		unredacted, err := ted.UnredactTokens(strings.Join(c.Args(), " "), opts...)
 		if err != nil {
-			return fmt.Errorf("failed to redact tokens: %v", err)
+			return fmt.Errorf("failed to unredact tokens: %v", err)
 		}
 
-		fmt.Fprintln(out, redacted)
+		fmt.Fprintln(out, unredacted)
 		return nil
 	}
 }
 
-func unredact(ted redactr.TokenRedacterUnredacter, in io.Reader, out io.Writer) func(*cli.Context) error {
+func rekey(rekeyer Rekeyer, in io.Reader, out io.Writer) func(*cli.Context) error {
 	return func(c *cli.Context) error {
-		var input string
-		if c.Args().Present() {
-			input = strings.Join(c.Args(), " ")
-		} else {
+		newKeys := newKeyOptions(c)
+		if len(newKeys) == 0 {
+			return fmt.Errorf("rekey requires a new key (NEW_AES_KEY, --new-key-file, --new-key-fd, --new-key-command or NEW_AES_PASSPHRASE)")
+		}
+
+		if !c.Args().Present() {
 			b, err := ioutil.ReadAll(in)
 			if err != nil {
 				return fmt.Errorf("failed to read input: %v", err)
 			}
-			input = string(b)
+			rekeyed, _, err := rekeyer.RekeyTokens(string(b), newKeys...)
+			if err != nil {
+				return fmt.Errorf("failed to rekey tokens: %v", err)
+			}
+			fmt.Fprint(out, rekeyed)
+			return nil
 		}
 
-		var opts []redactr.UnredactTokensOption
-		if c.Bool("wrap-tokens") {
-			opts = append(opts, redactr.WrapTokens)
+		results, err := rekeyer.RekeyFiles(c.Args(), newKeys...)
+		if err != nil {
+			return fmt.Errorf("failed to rekey files: %v", err)
 		}
+		for _, r := range results {
+			if r.Tokens > 0 {
+				fmt.Fprintf(out, "%v: %v secrets rekeyed\n", r.Filename, r.Tokens)
+			}
+		}
+		return nil
+	}
+}
 
-		unredacted, err := ted.UnredactTokens(input, opts...)
-		if err != nil {
-			return fmt.Errorf("failed to unredact tokens: %v", err)
+func rewrap(rewrapper Rewrapper, in io.Reader, out io.Writer) func(*cli.Context) error {
+	return func(c *cli.Context) error {
+		if !c.Args().Present() {
+			b, err := ioutil.ReadAll(in)
+			if err != nil {
+				return fmt.Errorf("failed to read input: %v", err)
+			}
+			rewrapped, _, err := rewrapper.RewrapTokens(string(b))
+			if err != nil {
+				return fmt.Errorf("failed to rewrap tokens: %v", err)
+			}
+			fmt.Fprint(out, rewrapped)
+			return nil
 		}
 
-		fmt.Fprintln(out, unredacted)
+		results, err := rewrapper.RewrapFiles(c.Args())
+		if err != nil {
+			return fmt.Errorf("failed to rewrap files: %v", err)
+		}
+		for _, r := range results {
+			if r.Tokens > 0 {
+				fmt.Fprintf(out, "%v: %v secrets rewrapped\n", r.Filename, r.Tokens)
+			}
+		}
 		return nil
 	}
 }
@@ -336,17 +686,109 @@ func exec(execer Execer) func(*cli.Context) error {
 			args = strings.Fields(string(b))
 		}
 
+		var opts []redactr.ExecOption
+		if c.Bool("keep-key-env") {
+			opts = append(opts, redactr.KeepKeyEnv)
+		}
+		for _, path := range c.StringSlice("env-file") {
+			opts = append(opts, redactr.EnvFile(path))
+		}
+		if len(c.StringSlice("env")) > 0 {
+			opts = append(opts, redactr.Env(c.StringSlice("env")...))
+		}
+		if c.Bool("tty") {
+			opts = append(opts, redactr.TTY)
+		}
+		if c.Bool("secrets-dir") {
+			opts = append(opts, redactr.SecretFiles)
+		}
+		if c.Bool("mask-output") {
+			if c.String("mask-placeholder") == "" {
+				return fmt.Errorf("--mask-placeholder can't be empty")
+			}
+			opts = append(opts, redactr.MaskOutput(c.String("mask-placeholder")))
+		}
+
+		for _, pi := range c.StringSlice("poll-interval") {
+			ss := strings.SplitN(pi, "=", 2)
+			if len(ss) != 2 {
+				return fmt.Errorf("invalid --poll-interval %q: expected <provider>=<duration>, like vault=30s", pi)
+			}
+			d, err := time.ParseDuration(ss[1])
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid --poll-interval %q: expected a positive duration, like 30s", pi)
+			}
+			opts = append(opts, redactr.PollInterval(ss[0], d))
+		}
+
+		if c.Bool("restart-on-failure") {
+			policy := redactr.DefaultRestartPolicy
+			policy.MaxRestarts = c.Int("max-restarts")
+			policy.Window = c.Duration("restart-window")
+			policy.MinUptime = c.Duration("min-uptime")
+			policy.InitialBackoff = c.Duration("restart-backoff")
+			policy.MaxBackoff = c.Duration("max-restart-backoff")
+			opts = append(opts, redactr.RestartOnFailure(policy))
+		}
+
+		sig, err := redactrexec.ParseSignal(c.String("stop-signal"))
+		if err != nil {
+			return fmt.Errorf("invalid --stop-signal: %v", err)
+		}
+		opts = append(opts, redactr.StopSignal(sig, c.Duration("stop-grace-period")))
+
+		// action describes what is done to the
+		// command when its configuration changes
+		var action string
 		switch {
 		case c.Duration("stop-if-env-changes") > 0:
-			return execer.Exec(args[0], args[1:], redactr.StopIfEnvChanges(c.Duration("stop-if-env-changes")))
+			opts = append(opts, redactr.StopIfEnvChanges(c.Duration("stop-if-env-changes")))
+			action = "stopping"
 		case c.Duration("restart-if-env-changes") > 0:
-			return execer.Exec(args[0], args[1:], redactr.RestartIfEnvChanges(c.Duration("restart-if-env-changes")))
-		default:
-			return execer.Exec(args[0], args[1:])
+			opts = append(opts, redactr.RestartIfEnvChanges(c.Duration("restart-if-env-changes")))
+			action = "restarting"
+		case c.Duration("signal-if-env-changes") > 0 || c.IsSet("signal-on-change"):
+			changeSig, err := redactrexec.ParseSignal(c.String("signal-on-change"))
+			if err != nil {
+				return fmt.Errorf("invalid --signal-on-change: %v", err)
+			}
+			// --signal-on-change alone signals
+			// at the default interval
+			d := c.Duration("signal-if-env-changes")
+			if d <= 0 {
+				d = redactr.DefaultPollInterval
+			}
+			opts = append(opts, redactr.SignalIfEnvChanges(d, changeSig))
+			action = fmt.Sprintf("sending %v to", changeSig)
+		}
+		if action != "" {
+			opts = append(opts, redactr.ReportChanges(func(changes redactrexec.Changes) {
+				log.Printf("redactr: configuration changed (%v), %v the command", changes, action)
+			}))
 		}
+		err = execer.Exec(args[0], args[1:], opts...)
+		if _, ok := err.(interface{ ExitCode() int }); ok {
+			// let CLI.Run return the error, so that
+			// redactr exits with the command's exit code
+			return commandExit{err}
+		}
+		return err
 	}
 }
 
+// commandExit holds the error of a command which exec
+// ran, and which exited with a non-zero status. Unlike
+// the command's error, it isn't a cli.ExitCoder, which
+// the cli package would exit with before the Tool is
+// closed.
+type commandExit struct {
+	err error
+}
+
+func (e commandExit) Error() string {
+	return e.err.Error()
+}
+
 func versionString(version, commit, date string) string {
 	return fmt.Sprintf("%v (%v, %v)", version, commit, date)
 }
@@ -0,0 +1,332 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/dhoelle/redactr"
+	"github.com/dhoelle/redactr/vault"
+	"github.com/urfave/cli"
+)
+
+// A Tool can redact, unredact, rekey and rewrap tokens
+// (in strings or streams), and exec commands.
+// Close stops any plugins that the Tool launched.
+type Tool interface {
+	TokenRedacterUnredacter
+	TokenStreamer
+	Execer
+	Rekeyer
+	Rewrapper
+	io.Closer
+}
+
+// A ToolFactory creates a Tool. The CLI calls it
+// with options derived from global flags and the
+// environment, the first time that a command
+// needs a Tool.
+type ToolFactory func(opts ...redactr.NewToolOption) (Tool, error)
+
+// keyEnvVars are the environment variables
+// which the CLI reads key material from
+var keyEnvVars = []string{
+	"AES_KEY",
+	"AES_KEYRING",
+	"AES_KEY_FILE",
+	"AES_KEY_FD",
+	"AES_KEY_COMMAND",
+	"AES_KEY_DESCRIPTOR",
+	"AES_PASSPHRASE",
+	"NEW_AES_KEY",
+	"NEW_AES_KEY_FILE",
+	"NEW_AES_KEY_FD",
+	"NEW_AES_KEY_COMMAND",
+	"NEW_AES_KEY_DESCRIPTOR",
+	"NEW_AES_PASSPHRASE",
+	"VAULT_SECRET_ID",
+	"VAULT_PASSWORD",
+}
+
+// globalFlags configure the Tool
+var globalFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "key-file",
+		Usage:  "read AES keys from a file, which must only be accessible by its owner",
+		EnvVar: "AES_KEY_FILE",
+	},
+	cli.IntFlag{
+		Name:   "key-fd",
+		Usage:  "read AES keys from an inherited file descriptor",
+		EnvVar: "AES_KEY_FD",
+		Value:  -1,
+	},
+	cli.StringFlag{
+		Name:   "key-command",
+		Usage:  "read AES keys from the output of a command (run with sh -c)",
+		EnvVar: "AES_KEY_COMMAND",
+	},
+	cli.StringFlag{
+		Name:   "plugin-dir",
+		Usage:  "look for provider plugins (redactr-provider-<name> executables) in this directory, as well as on PATH",
+		EnvVar: "REDACTR_PLUGIN_DIR",
+	},
+	cli.StringFlag{
+		Name:   "key-descriptor",
+		Usage:  "derive an AES key from AES_PASSPHRASE with the KDF parameters in this file (see keygen --type passphrase)",
+		EnvVar: "AES_KEY_DESCRIPTOR",
+	},
+	cli.StringFlag{
+		Name:   "vault-auth",
+		Usage:  "log in to Vault with this auth method: token (VAULT_TOKEN), approle, kubernetes, userpass or token-file",
+		EnvVar: "VAULT_AUTH_METHOD",
+		Value:  "token",
+	},
+	cli.StringFlag{
+		Name:   "vault-auth-mount",
+		Usage:  "the path that the Vault auth method is mounted at (by default, the name of the method)",
+		EnvVar: "VAULT_AUTH_MOUNT",
+	},
+	cli.StringFlag{
+		Name:   "vault-role-id",
+		Usage:  "the AppRole role ID to log in to Vault with (the secret ID is read from VAULT_SECRET_ID)",
+		EnvVar: "VAULT_ROLE_ID",
+	},
+	cli.StringFlag{
+		Name:   "vault-role",
+		Usage:  "the Vault role to log in as, with the kubernetes auth method",
+		EnvVar: "VAULT_ROLE",
+	},
+	cli.StringFlag{
+		Name:   "vault-jwt-file",
+		Usage:  "read the Kubernetes service account token from this file",
+		EnvVar: "VAULT_JWT_FILE",
+		Value:  vault.DefaultKubernetesJWTFile,
+	},
+	cli.StringFlag{
+		Name:   "vault-username",
+		Usage:  "the username to log in to Vault with (the password is read from VAULT_PASSWORD)",
+		EnvVar: "VAULT_USERNAME",
+	},
+	cli.StringFlag{
+		Name:   "vault-token-file",
+		Usage:  "read the Vault token from this file (like the sink of a Vault Agent)",
+		EnvVar: "VAULT_TOKEN_FILE",
+	},
+	cli.StringFlag{
+		Name:   "vault-transit-mount",
+		Usage:  "the path that Vault's transit secrets engine is mounted at, for ~~redact-vault-transit:...~~ tokens",
+		EnvVar: "VAULT_TRANSIT_MOUNT",
+		Value:  vault.DefaultTransitMount,
+	},
+	cli.BoolFlag{
+		Name:   "latest",
+		Usage:  "read the latest version of Vault secrets, ignoring the versions that tokens pin them to (like #password@7)",
+		EnvVar: "REDACTR_VAULT_LATEST",
+	},
+}
+
+// toolOptions converts global flags and environment
+// variables into options for a new Tool
+func toolOptions(c *cli.Context) ([]redactr.NewToolOption, error) {
+	opts := []redactr.NewToolOption{
+		redactr.AESKey(os.Getenv("AES_KEY")),
+		redactr.AESKeyring(os.Getenv("AES_KEYRING")),
+	}
+	if f := c.GlobalString("key-file"); f != "" {
+		opts = append(opts, redactr.AESKeyFile(f))
+	}
+	if fd := c.GlobalInt("key-fd"); fd >= 0 {
+		opts = append(opts, redactr.AESKeyFD(fd))
+	}
+	if cmd := c.GlobalString("key-command"); cmd != "" {
+		opts = append(opts, redactr.AESKeyCommand(cmd))
+	}
+	var pluginDirs []string
+	if dir := c.GlobalString("plugin-dir"); dir != "" {
+		pluginDirs = append(pluginDirs, dir)
+	}
+	opts = append(opts, redactr.DiscoverPlugins(pluginDirs...))
+	if passphrase, d := os.Getenv("AES_PASSPHRASE"), c.GlobalString("key-descriptor"); passphrase != "" || d != "" {
+		opts = append(opts, redactr.AESPassphrase(passphrase, d))
+	}
+
+	opts = append(opts, redactr.VaultTransitMount(c.GlobalString("vault-transit-mount")))
+	if c.GlobalBool("latest") {
+		opts = append(opts, redactr.VaultLatestVersions)
+	}
+	auth, err := vaultAuthenticator(c)
+	if err != nil {
+		return nil, err
+	}
+	if auth != nil {
+		opts = append(opts, redactr.VaultAuth(auth))
+	}
+
+	var used []string
+	for _, name := range keyEnvVars {
+		if os.Getenv(name) != "" {
+			used = append(used, name)
+		}
+	}
+	return append(opts, redactr.KeyEnvVars(used...)), nil
+}
+
+// newKeyOptions converts the flags of the rekey command
+// (and their environment variables) into options which
+// configure the new AES keys, like toolOptions does for
+// the Tool's keys
+func newKeyOptions(c *cli.Context) []redactr.NewToolOption {
+	var opts []redactr.NewToolOption
+	if k := c.String("new-key"); k != "" {
+		opts = append(opts, redactr.AESKey(k))
+	}
+	if f := c.String("new-key-file"); f != "" {
+		opts = append(opts, redactr.AESKeyFile(f))
+	}
+	if fd := c.Int("new-key-fd"); fd >= 0 {
+		opts = append(opts, redactr.AESKeyFD(fd))
+	}
+	if cmd := c.String("new-key-command"); cmd != "" {
+		opts = append(opts, redactr.AESKeyCommand(cmd))
+	}
+	if passphrase, d := os.Getenv("NEW_AES_PASSPHRASE"), c.String("new-key-descriptor"); passphrase != "" || d != "" {
+		opts = append(opts, redactr.AESPassphrase(passphrase, d))
+	}
+	return opts
+}
+
+// vaultAuthenticator returns the Authenticator chosen
+// by the --vault-auth flag, or nil to use VAULT_TOKEN
+func vaultAuthenticator(c *cli.Context) (vault.Authenticator, error) {
+	mount := c.GlobalString("vault-auth-mount")
+	switch method := c.GlobalString("vault-auth"); method {
+	case "", "token":
+		return nil, nil
+	case "approle":
+		return &vault.AppRole{
+			RoleID:   c.GlobalString("vault-role-id"),
+			SecretID: os.Getenv("VAULT_SECRET_ID"),
+			Mount:    mount,
+		}, nil
+	case "kubernetes":
+		return &vault.Kubernetes{
+			Role:    c.GlobalString("vault-role"),
+			JWTFile: c.GlobalString("vault-jwt-file"),
+			Mount:   mount,
+		}, nil
+	case "userpass":
+		return &vault.UserPass{
+			Username: c.GlobalString("vault-username"),
+			Password: os.Getenv("VAULT_PASSWORD"),
+			Mount:    mount,
+		}, nil
+	case "token-file":
+		if c.GlobalString("vault-token-file") == "" {
+			return nil, fmt.Errorf("--vault-auth token-file needs --vault-token-file")
+		}
+		return &vault.TokenFile{Path: c.GlobalString("vault-token-file")}, nil
+	default:
+		return nil, fmt.Errorf("unknown Vault auth method %q (expected token, approle, kubernetes, userpass or token-file)", method)
+	}
+}
+
+// toolProxy forwards calls to a Tool, which is created
+// by a ToolFactory on first use. This lets commands which
+// don't need a Tool (like keygen) run without keys.
+type toolProxy struct {
+	newTool ToolFactory
+	opts    []redactr.NewToolOption
+
+	once sync.Once
+	tool Tool
+	err  error
+}
+
+func (p *toolProxy) get() (Tool, error) {
+	p.once.Do(func() {
+		p.tool, p.err = p.newTool(p.opts...)
+	})
+	return p.tool, p.err
+}
+
+// Close closes the Tool, if it was created
+func (p *toolProxy) Close() error {
+	if p.tool == nil {
+		return nil
+	}
+	return p.tool.Close()
+}
+
+func (p *toolProxy) RedactTokens(s string) (string, error) {
+	t, err := p.get()
+	if err != nil {
+		return "", err
+	}
+	return t.RedactTokens(s)
+}
+
+func (p *toolProxy) UnredactTokens(s string, opts ...redactr.UnredactTokensOption) (string, error) {
+	t, err := p.get()
+	if err != nil {
+		return "", err
+	}
+	return t.UnredactTokens(s, opts...)
+}
+
+func (p *toolProxy) RedactStream(r io.Reader, w io.Writer) error {
+	t, err := p.get()
+	if err != nil {
+		return err
+	}
+	return t.RedactStream(r, w)
+}
+
+func (p *toolProxy) UnredactStream(r io.Reader, w io.Writer, opts ...redactr.UnredactTokensOption) error {
+	t, err := p.get()
+	if err != nil {
+		return err
+	}
+	return t.UnredactStream(r, w, opts...)
+}
+
+func (p *toolProxy) Exec(name string, args []string, opts ...redactr.ExecOption) error {
+	t, err := p.get()
+	if err != nil {
+		return err
+	}
+	return t.Exec(name, args, opts...)
+}
+
+func (p *toolProxy) RekeyTokens(s string, newKeys ...redactr.NewToolOption) (string, int, error) {
+	t, err := p.get()
+	if err != nil {
+		return "", 0, err
+	}
+	return t.RekeyTokens(s, newKeys...)
+}
+
+func (p *toolProxy) RekeyFiles(paths []string, newKeys ...redactr.NewToolOption) ([]redactr.RekeyResult, error) {
+	t, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+	return t.RekeyFiles(paths, newKeys...)
+}
+
+func (p *toolProxy) RewrapTokens(s string) (string, int, error) {
+	t, err := p.get()
+	if err != nil {
+		return "", 0, err
+	}
+	return t.RewrapTokens(s)
+}
+
+func (p *toolProxy) RewrapFiles(paths []string) ([]redactr.RekeyResult, error) {
+	t, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+	return t.RewrapFiles(paths)
+}
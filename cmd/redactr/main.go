@@ -16,20 +16,22 @@ var (
 )
 
 func main() {
-	tool, err := redactr.New(
-		redactr.AESKey(os.Getenv("AES_KEY")),
-	)
-	must(err, "failed to create redactr tool")
-
 	c, err := cli.New(
-		tool,
-		tool,
+		func(opts ...redactr.NewToolOption) (cli.Tool, error) {
+			return redactr.New(opts...)
+		},
 		cli.Commit(commit),
 		cli.Date(date),
 		cli.Version(version),
 	)
 	must(err, "failed to create CLI")
-	must(c.Run(os.Args), "redactr failed")
+	err = c.Run(os.Args)
+	if ee, ok := err.(interface{ ExitCode() int }); ok {
+		// exit with the command's exit code. The
+		// command has reported its own errors.
+		os.Exit(ee.ExitCode())
+	}
+	must(err, "redactr failed")
 }
 
 // must wraps a given error with a message and prints it via
@@ -0,0 +1,183 @@
+package escape
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dotenvState is the context in a line of a .env file
+type dotenvState int8
+
+const (
+	dotenvKey        = dotenvState(iota) // FOO (before the =)
+	dotenvValueStart                     // FOO=
+	dotenvUnquoted                       // FOO=bar
+	dotenvDouble                         // FOO="bar"
+	dotenvSingle                         // FOO='bar'
+	dotenvAfterQuote                     // FOO="bar" (after the closing quote)
+	dotenvComment                        // # ...
+)
+
+// dotenvScanner follows a .env file, of lines like:
+//
+//    FOO=bar
+//    export BAR="multiple\nlines"
+//    BAZ='single quoted' # and a comment
+//
+// Values in double quotes are escaped as they are by
+// common dotenv loaders: \\, \", \n, \r and \$. Single-
+// quoted values are written literally, so they can't hold
+// a single quote or a line break. A value which makes up
+// a whole unquoted value is double-quoted if it needs to be.
+type dotenvScanner struct {
+	state   dotenvState
+	blank   bool // only whitespace has been seen on this line
+	space   bool // the last character was whitespace
+	escaped bool // the last character was a backslash, in double quotes
+}
+
+func newDotenvScanner() *dotenvScanner {
+	return &dotenvScanner{blank: true}
+}
+
+func (s *dotenvScanner) scan(text string) {
+	for i := 0; i < len(text); i++ {
+		s.scanByte(text[i])
+	}
+}
+
+func (s *dotenvScanner) scanByte(c byte) {
+	space := c == ' ' || c == '\t'
+	defer func() { s.space = space }()
+
+	if c == '\n' && s.state != dotenvDouble && s.state != dotenvSingle {
+		s.state = dotenvKey
+		s.blank = true
+		return
+	}
+
+	switch s.state {
+	case dotenvKey:
+		switch {
+		case c == '#' && s.blank:
+			s.state = dotenvComment
+		case c == '=':
+			s.state = dotenvValueStart
+		}
+
+	case dotenvValueStart:
+		switch {
+		case space:
+		case c == '"':
+			s.state = dotenvDouble
+		case c == '\'':
+			s.state = dotenvSingle
+		case c == '#':
+			s.state = dotenvComment
+		default:
+			s.state = dotenvUnquoted
+		}
+
+	case dotenvUnquoted:
+		if c == '#' && s.space {
+			s.state = dotenvComment
+		}
+
+	case dotenvDouble:
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case c == '\\':
+			s.escaped = true
+		case c == '"':
+			s.state = dotenvAfterQuote
+		}
+
+	case dotenvSingle:
+		if c == '\'' {
+			s.state = dotenvAfterQuote
+		}
+	}
+
+	if !space && c != '\r' {
+		s.blank = false
+	}
+}
+
+func (s *dotenvScanner) escape(value, rest string) (string, error) {
+	defer func() {
+		s.space = false
+		s.blank = false
+	}()
+
+	switch s.state {
+	case dotenvDouble:
+		s.escaped = false
+		return dotenvDoubleQuoteReplacer.Replace(value), nil
+
+	case dotenvSingle:
+		if strings.ContainsAny(value, "'\r\n") {
+			return "", fmt.Errorf("can't write a single quote or line break into a single-quoted dotenv value")
+		}
+		return value, nil
+
+	case dotenvComment:
+		if strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("can't write a line break into a dotenv comment")
+		}
+		return value, nil
+
+	case dotenvValueStart:
+		s.state = dotenvUnquoted
+		if dotenvSafe(value) {
+			return value, nil
+		}
+		if wholeUnquotedValue(rest, "") {
+			return `"` + dotenvDoubleQuoteReplacer.Replace(value) + `"`, nil
+		}
+		return "", fmt.Errorf("can't write a value with spaces, quotes or special characters into part of an unquoted dotenv value (quote the whole value)")
+
+	case dotenvUnquoted:
+		if dotenvSafe(value) {
+			return value, nil
+		}
+		return "", fmt.Errorf("can't write a value with spaces, quotes or special characters into part of an unquoted dotenv value (quote the whole value)")
+	}
+
+	return value, nil
+}
+
+var dotenvDoubleQuoteReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	`$`, `\$`,
+)
+
+// dotenvSafe reports whether a value can be written,
+// as it is, into an unquoted dotenv value
+func dotenvSafe(value string) bool {
+	if strings.TrimSpace(value) != value {
+		return false
+	}
+	return !strings.ContainsAny(value, " \t\r\n\"'`$#\\")
+}
+
+// wholeUnquotedValue reports whether a value, followed
+// by rest (up to the end of its line), would make up a
+// whole unquoted value: nothing follows it but whitespace,
+// a comment, or one of the given terminators
+func wholeUnquotedValue(rest, terminators string) bool {
+	trimmed := strings.TrimLeft(rest, " \t")
+	switch {
+	case trimmed == "":
+		return true
+	case trimmed[0] == '#':
+		// a comment must be preceded by whitespace
+		return len(trimmed) < len(rest)
+	case strings.IndexByte(terminators, trimmed[0]) >= 0:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+// Package escape escapes secrets for the syntactic context
+// that they are written into.
+//
+// A secret which is written into a JSON string must have its
+// quotes and backslashes escaped, while the same secret in a
+// single-quoted shell string must have its single quotes
+// escaped (and nothing else). A Scanner follows a document in
+// one of the supported Formats, so that each secret written
+// into it can be escaped for the place where it lands.
+package escape
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// A Format is a kind of document which secrets can be
+// written into
+type Format string
+
+// Supported Formats
+const (
+	Raw    = Format("raw") // default: secrets are written as they are
+	JSON   = Format("json")
+	YAML   = Format("yaml")
+	Shell  = Format("shell")
+	Dotenv = Format("dotenv")
+)
+
+// Formats lists the supported formats
+var Formats = []Format{Raw, JSON, YAML, Shell, Dotenv}
+
+// ParseFormat parses the name of a Format, like "json"
+func ParseFormat(s string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == strings.ToLower(s) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q (choices: %v)", s, Formats)
+}
+
+// FormatOf detects the Format of a file from its name, like
+// JSON for config.json or Dotenv for .env.production.
+// Files of unknown formats are Raw.
+func FormatOf(filename string) Format {
+	base := strings.ToLower(filepath.Base(filename))
+
+	// ignore the suffix of a redacted copy,
+	// like config.json.redacted
+	base = strings.TrimSuffix(base, ".redacted")
+
+	switch {
+	case base == ".env" || strings.HasPrefix(base, ".env."):
+		return Dotenv
+	}
+
+	switch filepath.Ext(base) {
+	case ".json":
+		return JSON
+	case ".yaml", ".yml":
+		return YAML
+	case ".sh", ".bash", ".zsh", ".ksh":
+		return Shell
+	case ".env":
+		return Dotenv
+	}
+	return Raw
+}
+
+// A Scanner follows a document, and escapes the values
+// which are written into it.
+//
+// Text is given to the Scanner in order: the document's
+// own text to Scan, and each inserted value to Escape.
+// Text which is neither (like a token which is left
+// as it is) can be given to Skip.
+type Scanner struct {
+	s scanner
+}
+
+// NewScanner creates a Scanner for a document of the
+// given Format, starting at the top of the document
+func NewScanner(f Format) *Scanner {
+	switch f {
+	case JSON:
+		return &Scanner{s: &jsonScanner{}}
+	case YAML:
+		return &Scanner{s: newYAMLScanner()}
+	case Shell:
+		return &Scanner{s: newShellScanner()}
+	case Dotenv:
+		return &Scanner{s: newDotenvScanner()}
+	}
+	return &Scanner{s: rawScanner{}}
+}
+
+// Scan moves the scanner over text from the document
+func (sc *Scanner) Scan(text string) {
+	sc.s.scan(text)
+}
+
+// Escape escapes a value that is written into the document
+// at the scanner's position, and moves the scanner past it.
+//
+// rest is the text which follows the value, up to the end
+// of its line (or as much of it as is known). It tells the
+// scanner whether the value makes up a whole unquoted value,
+// which can be quoted if it needs to be.
+//
+// Escape returns an error if the value can't be written
+// into its context at all, like a line break into a
+// single-quoted YAML string.
+func (sc *Scanner) Escape(value, rest string) (string, error) {
+	return sc.s.escape(value, rest)
+}
+
+// Skip moves the scanner past text which is written into
+// the document as an opaque value, and not escaped
+func (sc *Scanner) Skip(text string) {
+	sc.s.escape(text, "")
+}
+
+// A scanner implements a Format
+type scanner interface {
+	scan(text string)
+	escape(value, rest string) (string, error)
+}
+
+// rawScanner writes values as they are
+type rawScanner struct{}
+
+func (rawScanner) scan(string) {}
+
+func (rawScanner) escape(value, _ string) (string, error) {
+	return value, nil
+}
+
+// RestOfLine returns the text of s from i
+// up to (but not including) the next line break
+func RestOfLine(s string, i int) string {
+	s = s[i:]
+	if j := strings.IndexAny(s, "\r\n"); j >= 0 {
+		return s[:j]
+	}
+	return s
+}
+
+// isLineBreak reports whether r breaks a line
+func isLineBreak(r rune) bool {
+	return r == '\n' || r == '\r'
+}
@@ -0,0 +1,326 @@
+package escape_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/dhoelle/redactr/escape"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// hostileSecrets are secrets which break naive
+// substitution into most formats
+var hostileSecrets = []string{
+	`hunter2`,
+	``,
+	`"double quoted"`,
+	`it's`,
+	`back\slash\`,
+	`'"\'"\\`,
+	"multiple\nlines",
+	"trailing line break\n",
+	"\nleading line break",
+	"tab\tand\r\ncrlf",
+	"bell\a",
+	`$HOME and ${HOME} and $(id) and ` + "`id`",
+	`# not a comment`,
+	`key: value`,
+	` leading and trailing spaces `,
+	`{"json": [1, 2]}`,
+	`- dash`,
+	`!@#%^&*()`,
+	"unicode ☃ and a line separator \u2028",
+
+	// YAML reads these as other types,
+	// if they aren't quoted
+	`true`,
+	`yes`,
+	`null`,
+	`~`,
+	`0777`,
+	`0x1F`,
+	`1e3`,
+	`-.5`,
+	`.inf`,
+	`12:30`,
+	`2001-12-14`,
+	`<<`,
+}
+
+// render writes a secret into a template, in place of @@
+func render(f escape.Format, template, secret string) (string, error) {
+	i := strings.Index(template, "@@")
+	sc := escape.NewScanner(f)
+	sc.Scan(template[:i])
+	escaped, err := sc.Escape(secret, escape.RestOfLine(template, i+2))
+	if err != nil {
+		return "", err
+	}
+	return template[:i] + escaped + template[i+2:], nil
+}
+
+// A roundTripCase renders each hostile secret into a
+// template, and checks that it can be read back
+type roundTripCase struct {
+	template string
+	read     func(doc string) (string, error) // reads the value back
+	want     string                           // the value, with @@ for the secret
+	rejects  func(secret string) bool         // the secret may be rejected
+}
+
+// holdsAny rejects secrets which hold any of chars
+func holdsAny(chars string) func(string) bool {
+	return func(secret string) bool {
+		return strings.ContainsAny(secret, chars)
+	}
+}
+
+func (c roundTripCase) run(t *testing.T, f escape.Format) {
+	for _, secret := range hostileSecrets {
+		doc, err := render(f, c.template, secret)
+		if err != nil {
+			if c.rejects == nil || !c.rejects(secret) {
+				t.Errorf("%q in %q: got unexpected err: %v", secret, c.template, err)
+			}
+			continue
+		}
+
+		got, err := c.read(doc)
+		if err != nil {
+			t.Errorf("%q in %q: failed to read back\n%v\n\terr: %v", secret, c.template, doc, err)
+			continue
+		}
+		if want := strings.Replace(c.want, "@@", secret, 1); got != want {
+			t.Errorf("%q in %q: read back\n%v\n\twant %q\n\t got %q", secret, c.template, doc, want, got)
+		}
+	}
+}
+
+func TestScanner_JSON(t *testing.T) {
+	read := func(path ...interface{}) func(string) (string, error) {
+		return func(doc string) (string, error) {
+			var v interface{}
+			if err := json.Unmarshal([]byte(doc), &v); err != nil {
+				return "", err
+			}
+			for _, p := range path {
+				switch p := p.(type) {
+				case string:
+					v = v.(map[string]interface{})[p]
+				case int:
+					v = v.([]interface{})[p]
+				}
+			}
+			return v.(string), nil
+		}
+	}
+
+	cases := []roundTripCase{
+		{template: `{"password": "@@"}`, read: read("password"), want: "@@"},
+		{template: `{"a": "\"}", "b": ["x", "@@"]}`, read: read("b", 1), want: "@@"},
+		{template: `{"url": "postgres://user:@@@db/app"}`, read: read("url"), want: "postgres://user:@@@db/app"},
+	}
+	for _, c := range cases {
+		c.run(t, escape.JSON)
+	}
+
+	t.Run("it should write values outside of strings as they are", func(t *testing.T) {
+		got, err := render(escape.JSON, `{"port": @@}`, "8080")
+		if err != nil {
+			t.Fatalf("got err: %v", err)
+		}
+		if want := `{"port": 8080}`; got != want {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	})
+}
+
+func TestScanner_YAML(t *testing.T) {
+	// read decodes a document, and reads the value at path
+	// (of keys and indexes) back. The value must be a string:
+	// a secret like true or 0777 must not come back as a bool
+	// or a number.
+	read := func(path ...interface{}) func(string) (string, error) {
+		return func(doc string) (string, error) {
+			var v interface{}
+			if err := yaml.Unmarshal([]byte(doc), &v); err != nil {
+				return "", err
+			}
+			for _, p := range path {
+				switch p := p.(type) {
+				case string:
+					m, ok := v.(map[interface{}]interface{})
+					if !ok {
+						return "", fmt.Errorf("read back %#v, not a map", v)
+					}
+					v = m[p]
+				case int:
+					l, ok := v.([]interface{})
+					if !ok || p >= len(l) {
+						return "", fmt.Errorf("read back %#v, not a list of %v", v, p+1)
+					}
+					v = l[p]
+				}
+			}
+			s, ok := v.(string)
+			if !ok {
+				return "", fmt.Errorf("read back %#v (a %T), not a string", v, v)
+			}
+			return s, nil
+		}
+	}
+
+	// block scalars can't start with whitespace, which
+	// YAML would take as the indentation of the block
+	blockRejects := func(secret string) bool {
+		return strings.ContainsAny(secret, "\r\a\u2028") || strings.IndexAny(secret, " \n") == 0
+	}
+
+	cases := []roundTripCase{
+		{template: "password: \"@@\"\nother: x\n", read: read("password"), want: "@@"},
+		{template: "password: '@@'\nother: x\n", read: read("password"), want: "@@", rejects: holdsAny("\r\n\a\u2028")},
+		{template: "password: 'it''s @@'\n", read: read("password"), want: "it's @@", rejects: holdsAny("\r\n\a\u2028")},
+		{template: "password: @@\nother: x\n", read: read("password"), want: "@@"},
+		{template: "password: @@ # comment\n", read: read("password"), want: "@@"},
+		{template: "password: &anchor @@\n", read: read("password"), want: "@@"},
+		{template: "@@: key\n", read: func(doc string) (string, error) {
+			var v map[interface{}]interface{}
+			if err := yaml.Unmarshal([]byte(doc), &v); err != nil {
+				return "", err
+			}
+			for k := range v {
+				if s, ok := k.(string); ok {
+					return s, nil
+				}
+				return "", fmt.Errorf("read back the key %#v (a %T), not a string", k, k)
+			}
+			return "", fmt.Errorf("read back no keys")
+		}, want: "@@", rejects: func(secret string) bool {
+			// a (plain) key must fit on one line
+			return holdsAny("\r\n\u2028")(secret)
+		}},
+		{template: "# a comment: 'with quotes\npassword: @@\n", read: read("password"), want: "@@"},
+		{template: "url: postgres://user:@@@db/app\n", read: read("url"), want: "postgres://user:@@@db/app", rejects: holdsAny(" \t\r\n\a\u2028#:[]{},")},
+		{template: "password: |+\n  @@\nother: x\n", read: read("password"), want: "@@\n", rejects: blockRejects},
+		{template: "outer:\n  - key: |\n      first line\n      @@ and more\nother: x\n", read: read("outer", 0, "key"), want: "first line\n@@ and more\n", rejects: holdsAny("\r\a\u2028")},
+		{template: "password: >\n  @@\n", read: read("password"), want: "@@\n", rejects: func(secret string) bool {
+			return secret == "" || strings.Contains(secret, "\n") || blockRejects(secret)
+		}},
+		{template: "list: [a, @@, \"b\"]\n", read: read("list", 1), want: "@@"},
+		{template: "list: [\"a\", '@@']\n", read: read("list", 1), want: "@@", rejects: holdsAny("\r\n\a\u2028")},
+		{template: "list:\n  - \"x\"\n  - @@\n", read: read("list", 1), want: "@@"},
+	}
+	for _, c := range cases {
+		c.run(t, escape.YAML)
+	}
+}
+
+func TestScanner_Shell(t *testing.T) {
+	sh, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not available")
+	}
+	run := func(script string) (string, error) {
+		out, err := exec.Command(sh, "-c", script).Output()
+		return string(out), err
+	}
+
+	cases := []roundTripCase{
+		{template: `printf %s @@`, want: "@@"},
+		{template: `printf %s x@@y`, want: "x@@y"},
+		{template: `printf %s '@@'`, want: "@@"},
+		{template: `printf %s "@@"`, want: "@@"},
+		{template: `printf %s $'@@'`, want: "@@"},
+		{template: `printf %s "$(echo "a b")"'@@'`, want: "a b@@"},
+		{template: "printf %s `echo a`\"@@\"", want: "a@@"},
+		{template: "# comment: it's @@\nprintf %s ok", want: "ok", rejects: holdsAny("\r\n")},
+		{template: "cat <<EOF\n@@\nEOF\n", want: "@@\n"},
+		{template: "X=x; cat <<EOF; printf %s '$X'\n@@ $X\nEOF\n", want: "@@ x\n$X"},
+		{template: "cat <<'EOF'\n@@\nEOF\n", want: "@@\n"},
+		{template: "cat <<-\"EOF\"\n\t@@ and $(more)\n\tEOF\nprintf %s ok", want: "@@ and $(more)\nok"},
+		{template: "X=x; cat <<A; cat <<\\B\n@@ $X\nA\n$X\nB\n", want: "@@ x\n$X\n"},
+		{template: "X=x; cat <<A; cat <<\\B\n$X\nA\n@@ $X\nB\n", want: "x\n@@ $X\n"},
+		{template: "cat <<<@@", want: "@@\n"},
+		{template: "printf %s $((1<<2))@@", want: "4@@"},
+	}
+	for _, c := range cases {
+		c.read = run
+		c.run(t, escape.Shell)
+	}
+
+	t.Run("it should reject a secret which would end a here-document", func(t *testing.T) {
+		for _, secret := range []string{"EOF", "a\nEOF\nb", "a\n\tEOF"} {
+			if _, err := render(escape.Shell, "cat <<-EOF\n@@\nEOF\n", secret); err == nil {
+				t.Errorf("%q: expected an error", secret)
+			}
+		}
+	})
+}
+
+func TestScanner_Dotenv(t *testing.T) {
+	tests := []struct {
+		template string
+		secret   string
+		want     string
+		wantErr  bool
+	}{
+		{template: "PASSWORD=@@\n", secret: "hunter2", want: "PASSWORD=hunter2\n"},
+		{template: "PASSWORD=@@\n", secret: "a \"b\"\nc", want: "PASSWORD=\"a \\\"b\\\"\\nc\"\n"},
+		{template: "PASSWORD=@@ # comment\n", secret: "$HOME", want: "PASSWORD=\"\\$HOME\" # comment\n"},
+		{template: "PASSWORD=\"@@\"\n", secret: `back\slash "quote"` + "\n", want: `PASSWORD="back\\slash \"quote\"\n"` + "\n"},
+		{template: "export PASSWORD='@@'\n", secret: `$HOME\n`, want: `export PASSWORD='$HOME\n'` + "\n"},
+		{template: "PASSWORD='@@'\n", secret: "it's", wantErr: true},
+		{template: "URL=postgres://user:@@@db\n", secret: "hunter2", want: "URL=postgres://user:hunter2@db\n"},
+		{template: "URL=postgres://user:@@@db\n", secret: "hunter 2", wantErr: true},
+		{template: "# PASSWORD=\"@@\n", secret: "it's \"ok\"", want: "# PASSWORD=\"it's \"ok\"\n"},
+		{template: "A=\"x\ny\"\nB='#'\nPASSWORD=@@\n", secret: "a b", want: "A=\"x\ny\"\nB='#'\nPASSWORD=\"a b\"\n"},
+	}
+	for _, tt := range tests {
+		got, err := render(escape.Dotenv, tt.template, tt.secret)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q in %q: got err %v, want err: %v", tt.secret, tt.template, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q in %q:\n\twant %q\n\t got %q", tt.secret, tt.template, tt.want, got)
+		}
+	}
+}
+
+func TestScanner_Skip(t *testing.T) {
+	// quotes in a skipped token don't
+	// change the context of later ones
+	sc := escape.NewScanner(escape.JSON)
+	sc.Scan(`{"a": "`)
+	sc.Skip(`~~redact:"~~`)
+	sc.Scan(`", "b": "`)
+	got, err := sc.Escape(`"`, `"}`)
+	if err != nil {
+		t.Fatalf("got err: %v", err)
+	}
+	if want := `\"`; got != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]escape.Format{
+		"config.json":              escape.JSON,
+		"deploy/values.YAML":       escape.YAML,
+		"app.yml.redacted":         escape.YAML,
+		"run.sh":                   escape.Shell,
+		".env":                     escape.Dotenv,
+		"/srv/app/.env.production": escape.Dotenv,
+		"prod.env":                 escape.Dotenv,
+		"notes.txt":                escape.Raw,
+		"Makefile":                 escape.Raw,
+	}
+	for filename, want := range tests {
+		if got := escape.FormatOf(filename); got != want {
+			t.Errorf("FormatOf(%q): want %v, got %v", filename, want, got)
+		}
+	}
+}
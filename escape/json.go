@@ -0,0 +1,59 @@
+package escape
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonScanner follows a JSON document.
+//
+// Values inside a string are escaped. Values outside of a
+// string are written as they are, so that a token can
+// stand for a number or other raw JSON value:
+//
+//    {"password": "~~redacted-aes:...~~", "port": ~~redacted-aes:...~~}
+type jsonScanner struct {
+	inString bool
+	escaped  bool
+}
+
+func (s *jsonScanner) scan(text string) {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case !s.inString:
+			s.inString = c == '"'
+		case s.escaped:
+			s.escaped = false
+		case c == '\\':
+			s.escaped = true
+		case c == '"':
+			s.inString = false
+		}
+	}
+}
+
+func (s *jsonScanner) escape(value, _ string) (string, error) {
+	if !s.inString {
+		return value, nil
+	}
+	s.escaped = false
+	if !utf8.ValidString(value) {
+		return "", fmt.Errorf("can't write invalid UTF-8 into a JSON string")
+	}
+	return jsonString(value), nil
+}
+
+// jsonString escapes a value for the inside of a
+// JSON string (without the surrounding quotes)
+func jsonString(value string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(value) // a string always encodes
+	quoted := strings.TrimSuffix(b.String(), "\n")
+	return quoted[1 : len(quoted)-1]
+}
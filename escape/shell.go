@@ -0,0 +1,393 @@
+package escape
+
+import (
+	"fmt"
+	"strings"
+)
+
+// shellState is the quoting context in a shell script
+type shellState int8
+
+const (
+	shellUnquoted = shellState(iota)
+	shellSingle   // '...'
+	shellDouble   // "..."
+	shellANSIC    // $'...'
+	shellComment  // # ...
+)
+
+// A shellFrame is the quoting context of a script, or
+// of a command substitution within it, like $(...)
+// or `...`, which starts afresh
+type shellFrame struct {
+	state  shellState
+	closer byte // ')' or '`' for a command substitution
+	depth  int  // nested parentheses, like in $((1+2))
+}
+
+// A heredoc is a here-document, like:
+//
+//    cat <<EOF
+//    body
+//    EOF
+//
+// If any part of its delimiter word is quoted (like
+// <<'EOF'), its body is literal. If not, the shell expands
+// $, ` and \ in the body, as it does in double quotes.
+type heredoc struct {
+	delimiter string
+	quoted    bool
+	stripTabs bool // <<-, which strips leading tabs from each line
+}
+
+// ends reports whether a line of
+// the body is the closing delimiter
+func (h heredoc) ends(line string) bool {
+	if h.stripTabs {
+		line = strings.TrimLeft(line, "\t")
+	}
+	return line == h.delimiter
+}
+
+// A heredocWord is the delimiter word
+// of a here-document, as it is read
+type heredocWord struct {
+	heredoc
+	operator bool // directly after the << operator
+	started  bool // the word has started
+	quote    byte // the quote that the word is in, if any
+	escaped  bool // the last character was a backslash
+}
+
+// shellScanner follows a POSIX shell script.
+//
+// Values are escaped for the quotes around them. Unquoted
+// values are single-quoted, unless they are made only of
+// characters which the shell leaves alone. In the body of
+// a here-document, values are escaped like in double quotes
+// (or written as they are, if the delimiter is quoted), and
+// may not hold a line which would end the body.
+type shellScanner struct {
+	frames    []shellFrame
+	escaped   bool // the last character was a backslash
+	dollar    bool // the last character was an unescaped $
+	wordStart bool // the next character starts a word
+
+	lt       int          // consecutive unquoted <
+	word     *heredocWord // the delimiter word being read, after <<
+	heredocs []heredoc    // here-documents whose bodies start on the next line
+	body     *heredoc     // the here-document whose body is being read
+	line     []byte       // the line of the body up to here
+}
+
+func newShellScanner() *shellScanner {
+	return &shellScanner{
+		frames:    []shellFrame{{state: shellUnquoted}},
+		wordStart: true,
+	}
+}
+
+func (s *shellScanner) top() *shellFrame {
+	return &s.frames[len(s.frames)-1]
+}
+
+func (s *shellScanner) push(closer byte) {
+	s.frames = append(s.frames, shellFrame{state: shellUnquoted, closer: closer})
+	s.wordStart = true
+}
+
+func (s *shellScanner) pop() {
+	if len(s.frames) > 1 {
+		s.frames = s.frames[:len(s.frames)-1]
+	}
+	s.wordStart = false
+}
+
+func (s *shellScanner) scan(text string) {
+	for i := 0; i < len(text); i++ {
+		s.scanByte(text[i])
+	}
+}
+
+func (s *shellScanner) scanByte(c byte) {
+	if s.body != nil {
+		s.scanBody(c)
+		return
+	}
+	if s.word != nil && s.scanWord(c) {
+		return
+	}
+	lt := s.lt
+	s.lt = 0
+
+	dollar := s.dollar
+	s.dollar = false
+
+	if s.escaped {
+		s.escaped = false
+		s.wordStart = false
+		return
+	}
+
+	f := s.top()
+	switch f.state {
+	case shellComment:
+		if c == '\n' {
+			f.state = shellUnquoted
+			s.wordStart = true
+			s.startBody()
+		}
+
+	case shellSingle:
+		if c == '\'' {
+			f.state = shellUnquoted
+		}
+
+	case shellANSIC:
+		switch c {
+		case '\\':
+			s.escaped = true
+		case '\'':
+			f.state = shellUnquoted
+		}
+
+	case shellDouble:
+		switch {
+		case c == '\\':
+			s.escaped = true
+		case c == '"':
+			f.state = shellUnquoted
+		case c == '`':
+			s.push('`')
+		case c == '(' && dollar:
+			s.push(')')
+		case c == '$':
+			s.dollar = true
+		}
+
+	case shellUnquoted:
+		wordStart := s.wordStart
+		s.wordStart = false
+		switch {
+		case c == '\\':
+			s.escaped = true
+		case c == '\'' && dollar:
+			f.state = shellANSIC
+		case c == '\'':
+			f.state = shellSingle
+		case c == '"':
+			f.state = shellDouble
+		case c == '#' && wordStart:
+			f.state = shellComment
+		case c == '`' && f.closer == '`':
+			s.pop()
+		case c == '`':
+			s.push('`')
+		case c == '(' && dollar:
+			s.push(')')
+		case c == '(':
+			f.depth++
+			s.wordStart = true
+		case c == ')' && f.depth > 0:
+			f.depth--
+			s.wordStart = true
+		case c == ')' && f.closer == ')':
+			s.pop()
+		case c == '$':
+			s.dollar = true
+		case c == '<':
+			// << starts a here-document, but not in
+			// arithmetic (like $((1 << 2))), and <<<
+			// starts a here-string
+			s.lt = lt + 1
+			if s.lt == 2 && f.depth == 0 {
+				s.word = &heredocWord{operator: true}
+			}
+			s.wordStart = true
+		case c == '\n':
+			s.wordStart = true
+			s.startBody()
+		case strings.IndexByte(" \t;&|>)", c) >= 0:
+			s.wordStart = true
+		}
+	}
+}
+
+// scanWord reads the delimiter word of a here-document.
+// It returns false if c is not part of the word, and
+// should be scanned as usual.
+func (s *shellScanner) scanWord(c byte) bool {
+	w := s.word
+	switch {
+	case w.escaped:
+		w.escaped = false
+		w.delimiter += string(c)
+	case w.quote != 0 && c == w.quote:
+		w.quote = 0
+	case w.quote != 0:
+		w.delimiter += string(c)
+	case c == '<' && w.operator:
+		// a here-string, like <<<word
+		s.word = nil
+		return false
+	case c == '-' && w.operator:
+		w.stripTabs = true
+	case c == ' ' || c == '\t':
+		if w.started {
+			s.endWord()
+			return false
+		}
+	case strings.IndexByte("\n;&|<>()", c) >= 0:
+		if w.started {
+			s.endWord()
+		} else {
+			s.word = nil
+		}
+		return false
+	case c == '\\':
+		w.escaped, w.quoted = true, true
+	case c == '\'' || c == '"':
+		w.quote, w.quoted = c, true
+	default:
+		w.delimiter += string(c)
+	}
+	w.operator = false
+	w.started = w.started || c != ' ' && c != '\t' && c != '-'
+	return true
+}
+
+// endWord queues the here-document whose
+// delimiter word has been read
+func (s *shellScanner) endWord() {
+	s.heredocs = append(s.heredocs, s.word.heredoc)
+	s.word = nil
+	s.wordStart = true
+}
+
+// startBody starts the body of the next here-
+// document, if any, at the start of a line
+func (s *shellScanner) startBody() {
+	if s.word != nil && s.word.started {
+		s.endWord()
+	}
+	s.word = nil
+	if len(s.heredocs) == 0 {
+		return
+	}
+	h := s.heredocs[0]
+	s.heredocs = s.heredocs[1:]
+	s.body = &h
+	s.line = s.line[:0]
+}
+
+// scanBody follows the body of a here-document,
+// up to the line which holds its delimiter
+func (s *shellScanner) scanBody(c byte) {
+	if c != '\n' {
+		s.line = append(s.line, c)
+		return
+	}
+	ended := s.body.ends(string(s.line))
+	s.line = s.line[:0]
+	if ended {
+		s.body = nil
+		s.wordStart = true
+		s.startBody()
+	}
+}
+
+func (s *shellScanner) escape(value, rest string) (string, error) {
+	s.escaped = false
+	s.dollar = false
+	s.lt = 0
+	if s.body != nil {
+		return s.escapeBody(value, rest)
+	}
+
+	switch s.top().state {
+	case shellSingle:
+		return strings.Replace(value, `'`, `'\''`, -1), nil
+
+	case shellDouble:
+		return shellDoubleQuoteReplacer.Replace(value), nil
+
+	case shellANSIC:
+		return shellANSICReplacer.Replace(value), nil
+
+	case shellComment:
+		if strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("can't write a line break into a shell comment")
+		}
+		return value, nil
+	}
+
+	s.wordStart = false
+	return shellQuote(value), nil
+}
+
+// escapeBody escapes a value in the body of a
+// here-document, which is followed by rest
+func (s *shellScanner) escapeBody(value, rest string) (string, error) {
+	escaped := value
+	if !s.body.quoted {
+		escaped = shellHeredocReplacer.Replace(value)
+	}
+
+	// the body ends at the first line which
+	// holds only the delimiter
+	var err error
+	for _, line := range strings.Split(string(s.line)+escaped+rest, "\n") {
+		if s.body.ends(line) {
+			err = fmt.Errorf("can't write a line which ends the here-document (%v) into it", s.body.delimiter)
+			break
+		}
+	}
+
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] == '\n' {
+			s.line = s.line[:0]
+		} else {
+			s.line = append(s.line, escaped[i])
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return escaped, nil
+}
+
+// shellHeredocReplacer escapes the characters which
+// the shell expands in the body of a here-document
+var shellHeredocReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`$`, `\$`,
+	"`", "\\`",
+)
+
+var shellDoubleQuoteReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	`$`, `\$`,
+	"`", "\\`",
+)
+
+var shellANSICReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`'`, `\'`,
+)
+
+// shellQuote quotes a value for a shell, unless it
+// is made only of characters which need no quotes
+func shellQuote(value string) string {
+	if value == "" {
+		return "''"
+	}
+	if strings.Trim(value, shellSafeChars) == "" {
+		return value
+	}
+	return "'" + strings.Replace(value, `'`, `'\''`, -1) + "'"
+}
+
+// shellSafeChars are characters which
+// a shell treats literally, anywhere
+const shellSafeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-"
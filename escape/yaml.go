@@ -0,0 +1,453 @@
+package escape
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// yamlState is the context in a YAML document
+type yamlState int8
+
+const (
+	yamlPlain       = yamlState(iota) // outside of quotes: keys, plain scalars and indicators
+	yamlDouble                        // "..."
+	yamlSingle                        // '...'
+	yamlComment                       // # ...
+	yamlBlockHeader                   // | or >, up to the end of the line (including any comment)
+	yamlBlock                         // the content of a block scalar
+)
+
+// yamlScanner follows a YAML document.
+//
+// Values are escaped for double- and single-quoted scalars,
+// and indented to fit literal block scalars (|). A value
+// which makes up a whole plain scalar is written as it is,
+// if YAML would read it back as the same string (and not,
+// say, as a bool or a number), and double-quoted if not.
+// Line breaks can't be written into single-quoted or
+// folded (>) scalars, which fold them into spaces.
+type yamlScanner struct {
+	state      yamlState
+	flow       int  // depth of flow collections, like [...] and {...}
+	valueStart bool // a scalar may start here
+	space      bool // the last character was whitespace
+	pending    byte // an indicator (-, ? or :) which is followed by whitespace if it is one
+	property   bool // in an anchor or tag (like &a or !!str) before a value
+	quoted     bool // the last scalar was quoted, so a : may follow it directly
+	escaped    bool // the last character was a backslash, in double quotes
+	quoteEnd   bool // the last character was a ', in single quotes, which may be the first of ''
+
+	lineStart bool // in the indentation of a line
+	indent    int  // the indentation of the line
+	col       int  // the column of the next character
+	nodeCol   int  // the column of the first key or scalar on the line, or -1
+
+	blockFolded    bool // the block scalar is folded (>), not literal (|)
+	blockKeep      bool // the block scalar keeps its trailing line breaks (|+)
+	blockIndicated bool // the indicators of the block scalar's header have been read
+	blockFirst     bool // on the first line of the block scalar, which sets its indentation
+	blockParent    int  // lines of the block scalar are indented more than this
+	blockIndent    int  // the indentation of the block scalar, or -1 until it is known
+}
+
+func newYAMLScanner() *yamlScanner {
+	return &yamlScanner{
+		valueStart: true,
+		space:      true,
+		lineStart:  true,
+		nodeCol:    -1,
+	}
+}
+
+func (s *yamlScanner) scan(text string) {
+	for i := 0; i < len(text); i++ {
+		s.scanByte(text[i])
+	}
+}
+
+func (s *yamlScanner) scanByte(c byte) {
+	if c == '\n' {
+		s.newline()
+		return
+	}
+	if s.lineStart {
+		switch c {
+		case ' ':
+			s.indent++
+			s.col++
+			return
+		case '\r':
+			return
+		}
+		s.startLine()
+	}
+	s.col++
+
+	switch s.state {
+	case yamlBlockHeader:
+		// indicators follow the | or > directly,
+		// like |+ or >2-
+		switch {
+		case c == ' ' || c == '\t':
+			s.blockIndicated = true
+		case c == '+' && !s.blockIndicated:
+			s.blockKeep = true
+		}
+
+	case yamlDouble:
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case c == '\\':
+			s.escaped = true
+		case c == '"':
+			s.state = yamlPlain
+			s.quoted = true
+		}
+
+	case yamlSingle:
+		switch {
+		case s.quoteEnd && c == '\'':
+			// '' is an escaped quote
+			s.quoteEnd = false
+		case c == '\'':
+			s.quoteEnd = true
+		case s.quoteEnd:
+			s.quoteEnd = false
+			s.state = yamlPlain
+			s.quoted = true
+			s.scanPlain(c)
+		}
+
+	case yamlPlain:
+		s.scanPlain(c)
+	}
+
+	s.space = c == ' ' || c == '\t'
+}
+
+// scanPlain moves over a character outside of quotes
+func (s *yamlScanner) scanPlain(c byte) {
+	space := c == ' ' || c == '\t'
+	quoted := s.quoted
+	s.quoted = false
+
+	if p := s.pending; p != 0 {
+		s.pending = 0
+		if space {
+			// the indicator is followed by a value
+			s.valueStart = true
+			return
+		}
+		if p == '-' || p == '?' {
+			// the indicator starts a plain scalar, like -1
+			s.markNode(s.col - 2)
+		}
+		s.valueStart = false
+	}
+
+	if s.property {
+		if space {
+			s.property = false
+			s.valueStart = true
+		}
+		return
+	}
+
+	valueStart := s.valueStart
+	s.valueStart = false
+	switch {
+	case space:
+		s.valueStart = valueStart
+	case c == '#' && s.space:
+		s.state = yamlComment
+		s.valueStart = valueStart
+	case c == ':' && quoted:
+		s.valueStart = true
+	case c == ':':
+		s.pending = c
+	case valueStart && (c == '-' || c == '?'):
+		s.pending = c
+	case valueStart && c == '"':
+		s.markNode(s.col - 1)
+		s.state = yamlDouble
+	case valueStart && c == '\'':
+		s.markNode(s.col - 1)
+		s.state = yamlSingle
+	case valueStart && s.flow == 0 && (c == '|' || c == '>'):
+		s.state = yamlBlockHeader
+		s.blockFolded = c == '>'
+		s.blockParent = s.indent
+		if s.nodeCol >= 0 {
+			s.blockParent = s.nodeCol
+		}
+	case valueStart && (c == '&' || c == '!'):
+		s.property = true
+	case (valueStart || s.flow > 0) && (c == '[' || c == '{'):
+		s.flow++
+		s.valueStart = true
+	case s.flow > 0 && (c == ']' || c == '}'):
+		s.flow--
+		s.quoted = true
+	case s.flow > 0 && c == ',':
+		s.valueStart = true
+	case valueStart:
+		s.markNode(s.col - 1)
+	}
+}
+
+func (s *yamlScanner) newline() {
+	switch {
+	case s.state == yamlBlockHeader:
+		s.state = yamlBlock
+		s.blockIndent = -1
+	case s.state == yamlComment:
+		s.state = yamlPlain
+	case s.state == yamlSingle && s.quoteEnd:
+		s.state = yamlPlain
+	}
+	s.quoteEnd = false
+	s.pending = 0
+	s.property = false
+	s.quoted = false
+	s.blockFirst = false
+
+	s.lineStart = true
+	s.indent = 0
+	s.col = 0
+	s.nodeCol = -1
+	s.space = true
+	if s.state == yamlPlain && s.flow == 0 {
+		s.valueStart = true
+	}
+}
+
+// startLine moves past the indentation of a line,
+// which may end a block scalar
+func (s *yamlScanner) startLine() {
+	s.lineStart = false
+	if s.state != yamlBlock {
+		return
+	}
+	switch {
+	case s.indent <= s.blockParent:
+		s.state = yamlPlain
+		s.valueStart = true
+	case s.blockIndent < 0:
+		s.blockIndent = s.indent
+		s.blockFirst = true
+	}
+}
+
+func (s *yamlScanner) markNode(col int) {
+	if s.nodeCol < 0 {
+		s.nodeCol = col
+	}
+}
+
+func (s *yamlScanner) escape(value, rest string) (string, error) {
+	if s.lineStart {
+		s.startLine()
+	}
+	if s.state == yamlSingle && s.quoteEnd {
+		s.quoteEnd = false
+		s.state = yamlPlain
+	}
+	afterSpace := s.space
+	s.space = false
+	s.col += len(value)
+
+	if !utf8.ValidString(value) {
+		return "", fmt.Errorf("can't write invalid UTF-8 into a YAML document")
+	}
+
+	switch s.state {
+	case yamlDouble:
+		s.escaped = false
+		return yamlDoubleQuote(value), nil
+
+	case yamlSingle:
+		if yamlHasLineBreak(value) {
+			return "", fmt.Errorf("can't write a line break into a single-quoted YAML string (use a double-quoted string)")
+		}
+		if yamlHasControl(value, "\t") {
+			return "", fmt.Errorf("can't write a control character into a single-quoted YAML string (use a double-quoted string)")
+		}
+		return strings.Replace(value, `'`, `''`, -1), nil
+
+	case yamlBlock:
+		if s.blockFolded && yamlHasLineBreak(value) {
+			return "", fmt.Errorf("can't write a line break into a folded YAML block scalar (use | instead of >)")
+		}
+		if yamlHasControl(value, "\t\n") {
+			return "", fmt.Errorf("can't write a control character into a YAML block scalar (use a double-quoted string)")
+		}
+		if strings.ContainsAny(value, "\u0085\u2028\u2029") {
+			return "", fmt.Errorf("can't write a unicode line break into a YAML block scalar (use a double-quoted string)")
+		}
+		lineStart := s.col-len(value) == s.indent
+		if s.blockFirst && lineStart && strings.IndexAny(value, " \n") == 0 {
+			// YAML would take the indentation of the
+			// block scalar from the value
+			return "", fmt.Errorf("can't write a value which starts with whitespace at the start of a YAML block scalar")
+		}
+		if !s.blockKeep && rest == "" && (strings.HasSuffix(value, "\n") || (value == "" && lineStart)) {
+			// the last lines of the block scalar may be chomped
+			return "", fmt.Errorf("can't write a value which ends with an empty line into a YAML block scalar (use |+ to keep it)")
+		}
+		return strings.Replace(value, "\n", "\n"+strings.Repeat(" ", s.blockIndent), -1), nil
+
+	case yamlComment, yamlBlockHeader:
+		if yamlHasLineBreak(value) {
+			return "", fmt.Errorf("can't write a line break into a YAML comment")
+		}
+		return value, nil
+	}
+
+	// a plain scalar
+	start := s.valueStart && s.pending == 0 && !s.property
+	if s.pending == '-' || s.pending == '?' {
+		s.markNode(s.col - len(value) - 1)
+	}
+	s.pending = 0
+	s.property = false
+	s.valueStart = false
+	s.quoted = false
+	if start {
+		s.markNode(s.col - len(value))
+	}
+
+	whole := start && yamlWholeScalar(rest, s.flow > 0)
+	if yamlPlainSafe(value, start, afterSpace, s.flow > 0) && !(whole && yamlNonStringRE.MatchString(value)) {
+		return value, nil
+	}
+	if whole {
+		s.quoted = true
+		return `"` + yamlDoubleQuote(value) + `"`, nil
+	}
+	return "", fmt.Errorf("can't write a value with line breaks, quotes or special characters into part of a plain YAML scalar (quote the whole scalar)")
+}
+
+// yamlWholeScalar reports whether a scalar, followed by
+// rest (up to the end of its line), is a whole plain
+// scalar, which can be replaced with a quoted scalar
+func yamlWholeScalar(rest string, flow bool) bool {
+	terminators := ""
+	if flow {
+		terminators = ",]}"
+	}
+	if wholeUnquotedValue(rest, terminators) {
+		return true
+	}
+
+	// a key, like: ~~redacted~~: value
+	trimmed := strings.TrimLeft(rest, " \t")
+	return strings.HasPrefix(trimmed, ":") && (len(trimmed) == 1 || trimmed[1] == ' ' || trimmed[1] == '\t')
+}
+
+// yamlNonStringRE matches plain scalars which YAML reads as
+// something other than a string: the nulls, bools, ints,
+// floats and timestamps of YAML 1.1 and of the YAML 1.2
+// core schema, like ~, true, yes, 0777, 1e3 or 2001-12-14
+// (and the merge key, <<). A secret which would make up a
+// whole scalar like these is double-quoted, so that it is
+// read back as the same string.
+var yamlNonStringRE = regexp.MustCompile(`^(?:` +
+	`~|null|Null|NULL|<<|=` +
+	`|y|Y|yes|Yes|YES|n|N|no|No|NO|true|True|TRUE|false|False|FALSE|on|On|ON|off|Off|OFF` +
+	`|[-+]?(?:0b[01_]+|0o[0-7_]+|0x[0-9a-fA-F_]+|[0-9][0-9_]*(?::[0-5]?[0-9])*)` +
+	`|[-+]?(?:[0-9][0-9_]*(?::[0-5]?[0-9])*)?\.[0-9_]*(?:[eE][-+]?[0-9]+)?` +
+	`|[-+]?[0-9][0-9_]*[eE][-+]?[0-9]+` +
+	`|[-+]?\.(?:inf|Inf|INF)|\.(?:nan|NaN|NAN)` +
+	`|[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}(?:(?:[Tt]|[ \t]+)[0-9]{1,2}:[0-9]{2}:[0-9]{2}(?:\.[0-9]*)?(?:[ \t]*(?:Z|[-+][0-9]{1,2}(?::[0-9]{2})?))?)?` +
+	`)$`)
+
+// yamlPlainSafe reports whether a value can be written, as
+// it is, into a plain scalar. If start is true, the value
+// starts the scalar; if afterSpace is true, it follows
+// whitespace.
+//
+// It doesn't check whether YAML would read the value as
+// another type (see yamlNonStringRE), which only matters
+// if the value makes up a whole scalar.
+func yamlPlainSafe(value string, start, afterSpace, flow bool) bool {
+	if value == "" {
+		return !start
+	}
+	if strings.TrimSpace(value) != value {
+		return false
+	}
+	if yamlHasLineBreak(value) || yamlHasControl(value, "") {
+		return false
+	}
+	if strings.Contains(value, ": ") || strings.Contains(value, " #") || strings.HasSuffix(value, ":") {
+		return false
+	}
+	if flow && strings.ContainsAny(value, ",[]{}") {
+		return false
+	}
+	if start && strings.IndexByte(yamlIndicators, value[0]) >= 0 {
+		return false
+	}
+	if afterSpace && value[0] == '#' {
+		return false
+	}
+	return true
+}
+
+// yamlIndicators can't start a plain scalar
+const yamlIndicators = "-?:,[]{}#&*!|>'\"%@`"
+
+// yamlDoubleQuote escapes a value for the inside
+// of a double-quoted YAML scalar
+func yamlDoubleQuote(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case 0:
+			b.WriteString(`\0`)
+		case '\u0085':
+			b.WriteString(`\N`)
+		case '\u2028':
+			b.WriteString(`\L`)
+		case '\u2029':
+			b.WriteString(`\P`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// yamlHasLineBreak reports whether a value
+// holds a line break, as YAML reads them
+func yamlHasLineBreak(value string) bool {
+	return strings.ContainsAny(value, "\r\n\u0085\u2028\u2029")
+}
+
+// yamlHasControl reports whether a value holds a control
+// character, other than the allowed ones
+func yamlHasControl(value, allowed string) bool {
+	for _, r := range value {
+		if (r < 0x20 || r == 0x7f) && !strings.ContainsRune(allowed, r) {
+			return true
+		}
+	}
+	return false
+}
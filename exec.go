@@ -1,8 +1,15 @@
 package redactr
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
 	"time"
+
+	"github.com/dhoelle/redactr/exec"
+	"github.com/dhoelle/redactr/watch"
 )
 
 //go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/runner.go --fake-name Runner . Runner
@@ -27,16 +34,58 @@ type Runner interface {
 	// Restart should restart the running runner.
 	Restart()
 
+	// Signal should send a signal to the running
+	// Runner, after re-rendering any configuration
+	// which it can reload without restarting.
+	Signal(os.Signal)
+
 	// Stop should stop the running Runner
 	//
 	Stop()
 }
 
+// A ChangeReporter is a Runner which can describe how
+// its configuration has changed (see ReportChanges)
+type ChangeReporter interface {
+	// ConfigurationChanges is like HasConfigurationChanged,
+	// but describes what changed
+	ConfigurationChanges() (exec.Changes, error)
+}
+
 // ExecConfig is used to configure a call
 // to Exec()
 type ExecConfig struct {
 	onEnvChange      OnEnvChangeBehavior
 	reevaluationFreq time.Duration
+	keepKeyEnv       bool
+	secretFiles      bool
+	tty              bool
+	env              []string
+	envFiles         []string
+	maskPlaceholder  string
+	stopSignal       os.Signal
+	stopGracePeriod  time.Duration
+	changeSignal     os.Signal
+	restartPolicy    *RestartPolicy
+	onChanges        func(exec.Changes)
+
+	// watching is set if the configuration is
+	// re-evaluated when one of the watchers
+	// reports a change (and every pollFreq),
+	// rather than every reevaluationFreq
+	watching      bool
+	watchers      []watch.Watcher
+	pollFreq      time.Duration
+	pollIntervals map[string]time.Duration
+}
+
+// pollInterval returns how often to poll
+// the secrets of the named provider
+func (c *ExecConfig) pollInterval(provider string) time.Duration {
+	if d, ok := c.pollIntervals[provider]; ok {
+		return d
+	}
+	return c.reevaluationFreq
 }
 
 // An ExecOption changes the way that Exec behaves
@@ -62,6 +111,197 @@ func StopIfEnvChanges(d time.Duration) ExecOption {
 	}
 }
 
+// DefaultPollInterval is how often the redactr CLI
+// re-checks the configuration of a command when it
+// is asked to act on changes without an interval
+// (like `redactr exec --signal-on-change HUP`)
+const DefaultPollInterval = 10 * time.Second
+
+// SignalIfEnvChanges tells Exec to periodically
+// re-check the configuration of the running command.
+// If it changes, Exec will send the command sig (like
+// SIGHUP), so that it can reload its configuration
+// without restarting.
+func SignalIfEnvChanges(d time.Duration, sig os.Signal) ExecOption {
+	return func(c *ExecConfig) {
+		c.onEnvChange = Signal
+		c.reevaluationFreq = d
+		c.changeSignal = sig
+	}
+}
+
+// A RestartPolicy tells Exec how to restart
+// a runner which fails (see RestartOnFailure)
+type RestartPolicy struct {
+	// InitialBackoff is how long to wait before the
+	// first restart. Each consecutive restart waits
+	// twice as long as the last, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Jitter randomizes each wait by up to this
+	// fraction of it (like 0.2, for ±20%), so that
+	// many runners don't restart in lockstep
+	Jitter float64
+
+	// MaxRestarts is the number of times that the
+	// runner may fail in a row (or, if Window is set,
+	// within Window) before Exec gives up and returns
+	// its error. Zero means no limit.
+	MaxRestarts int
+	Window      time.Duration
+
+	// MinUptime is how long the runner must run to be
+	// healthy. A healthy run resets the backoff and
+	// the count of failures. If MinUptime is zero, no
+	// run is healthy: every failure counts.
+	MinUptime time.Duration
+}
+
+// DefaultRestartPolicy is a RestartPolicy
+// which suits most long-running commands
+var DefaultRestartPolicy = RestartPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Jitter:         0.2,
+	MaxRestarts:    5,
+	MinUptime:      10 * time.Second,
+}
+
+// jitter randomizes a wait by up to ±p.Jitter
+func (p *RestartPolicy) jitter(d time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+}
+
+// RestartOnFailure tells Exec to run the runner
+// again, as p allows, if it fails.
+//
+// The runner is not restarted once the current process
+// receives a termination signal (see exec.TerminationSignals),
+// or if it exits after the signal was forwarded to it
+// (see exec.ExitError).
+func RestartOnFailure(p RestartPolicy) ExecOption {
+	return func(c *ExecConfig) {
+		c.restartPolicy = &p
+	}
+}
+
+// ReportChanges requests that f be called with a
+// description of the changes to the configuration of
+// the running command (naming the environment variables,
+// args and secret sources which changed, but never the
+// secrets), before Exec stops, restarts or signals it.
+// If the Runner is not a ChangeReporter, f is not called.
+func ReportChanges(f func(exec.Changes)) ExecOption {
+	return func(c *ExecConfig) {
+		c.onChanges = f
+	}
+}
+
+// WatchChanges tells Exec to re-evaluate the
+// configuration of the running command (when called
+// with RestartIfEnvChanges, StopIfEnvChanges or
+// SignalIfEnvChanges) whenever one of the watchers
+// reports a change, and every poll (if poll is set),
+// rather than at the frequency of those options.
+//
+// Tool.Exec watches the secrets in the command's
+// environment and args this way, with watchers from
+// the providers which can watch their secrets (see
+// PayloadWatcher). Other providers are polled. Leased
+// secrets are watched even without those options, and
+// the command is restarted when they change.
+func WatchChanges(poll time.Duration, watchers ...watch.Watcher) ExecOption {
+	return func(c *ExecConfig) {
+		c.watching = true
+		c.watchers = watchers
+		c.pollFreq = poll
+	}
+}
+
+// PollInterval tells Tool.Exec how often to poll (or
+// watch) the secrets of the named provider (like
+// "vault"), rather than at the frequency of
+// RestartIfEnvChanges, StopIfEnvChanges or
+// SignalIfEnvChanges
+func PollInterval(provider string, d time.Duration) ExecOption {
+	return func(c *ExecConfig) {
+		if c.pollIntervals == nil {
+			c.pollIntervals = make(map[string]time.Duration)
+		}
+		c.pollIntervals[provider] = d
+	}
+}
+
+// KeepKeyEnv tells Tool.Exec to pass environment
+// variables which hold key material (see KeyEnvVars)
+// through to the command. By default, they are removed.
+func KeepKeyEnv(c *ExecConfig) {
+	c.keepKeyEnv = true
+}
+
+// Env tells Tool.Exec to add variables, like
+// "FOO=bar", to the command's environment, after
+// those of the current process and of any EnvFiles.
+// Like the rest of the environment, their values may
+// hold redacted tokens.
+func Env(kvs ...string) ExecOption {
+	return func(c *ExecConfig) {
+		c.env = append(c.env, kvs...)
+	}
+}
+
+// EnvFile tells Tool.Exec to add the variables in a
+// file (see exec.ParseEnvFile) to the command's
+// environment, after those of the current process.
+// Like the rest of the environment, their values may
+// hold redacted tokens.
+func EnvFile(path string) ExecOption {
+	return func(c *ExecConfig) {
+		c.envFiles = append(c.envFiles, path)
+	}
+}
+
+// SecretFiles tells Tool.Exec to deliver the secrets
+// in the command's environment in files, rather than
+// in environment variables. Each variable which holds
+// a redacted token, like FOO, is unredacted into a
+// read-only file in a private directory, and the command
+// gets FOO_FILE=<path> instead (see exec.Runner.SecretFiles).
+func SecretFiles(c *ExecConfig) {
+	c.secretFiles = true
+}
+
+// TTY tells Tool.Exec to run the command in a
+// pseudo-terminal, for interactive programs like psql
+// (see exec.Runner.TTY)
+func TTY(c *ExecConfig) {
+	c.tty = true
+}
+
+// MaskOutput tells Tool.Exec to replace unredacted
+// secrets with placeholder (like "****") wherever
+// they appear in the command's output or errors
+func MaskOutput(placeholder string) ExecOption {
+	return func(c *ExecConfig) {
+		c.maskPlaceholder = placeholder
+	}
+}
+
+// StopSignal tells Tool.Exec to stop (or restart) the
+// command by sending it sig, and to kill it if it is
+// still running after the grace period. By default,
+// commands are sent SIGTERM, and given 10 seconds.
+func StopSignal(sig os.Signal, grace time.Duration) ExecOption {
+	return func(c *ExecConfig) {
+		c.stopSignal = sig
+		c.stopGracePeriod = grace
+	}
+}
+
 // OnEnvChangeBehavior determines the behavior of the
 // Tool if it discovers that the environment has changed
 type OnEnvChangeBehavior int8
@@ -71,31 +311,77 @@ const (
 	DoNothing = OnEnvChangeBehavior(iota) // default: do nothing
 	Stop
 	Restart
+	Signal
 )
 
 // Exec runs the Runner.
 //
-// When called with the RestartIfEnvChanges or
-// StopIfEnvChanges option, Exec will periodically
-// re-evaluate the environment. If the environment
-// has changed, Exec will restart or stop the runner
-// as requested.
+// When called with the RestartIfEnvChanges,
+// StopIfEnvChanges or SignalIfEnvChanges option,
+// Exec will periodically re-evaluate the environment.
+// If the environment has changed, Exec will restart,
+// stop or signal the runner as requested.
+//
+// When called with the RestartOnFailure option, Exec
+// will run the runner again if it fails (see
+// RestartPolicy).
 func Exec(runner Runner, opts ...ExecOption) error {
 	conf := &ExecConfig{}
 	for _, o := range opts {
 		o(conf)
 	}
 
+	// ctx is cancelled when Exec returns,
+	// to shut down its goroutines
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// If the caller has requested that we periodically
 	// recheck the environment, do so in a goroutine
-	reevaluationErrChan := make(chan error)
-	if conf.reevaluationFreq > 0 && conf.onEnvChange != DoNothing {
+	reevaluationErrChan := make(chan error, 1)
+	if (conf.reevaluationFreq > 0 || conf.watching) && conf.onEnvChange != DoNothing {
+		changes := make(chan struct{}, 1)
+		changed := func() {
+			select {
+			case changes <- struct{}{}:
+			default: // a re-evaluation is already pending
+			}
+		}
+		fail := func(err error) {
+			select {
+			case reevaluationErrChan <- err:
+			default:
+			}
+		}
+
+		// Watch for changes, or poll
+		// for them every tick
+		watchers := conf.watchers
+		poll := conf.pollFreq
+		if !conf.watching {
+			poll = conf.reevaluationFreq
+		}
+		if poll > 0 {
+			watchers = append(watchers, watch.Poll(poll, func() (bool, error) { return true, nil }))
+		}
+		for _, w := range watchers {
+			go func(w watch.Watcher) {
+				if err := w.Watch(ctx, changed); err != nil {
+					fail(fmt.Errorf("failed to watch for changes: %v", err))
+				}
+			}(w)
+		}
+
 		go func() {
 			for {
-				<-time.After(conf.reevaluationFreq)
-				hasChanged, err := runner.HasConfigurationChanged()
+				select {
+				case <-ctx.Done():
+					return
+				case <-changes:
+				}
+				hasChanged, err := hasConfigurationChanged(runner, conf.onChanges)
 				if err != nil {
-					reevaluationErrChan <- fmt.Errorf("failed to determine if configuration has changed: %v", err)
+					fail(fmt.Errorf("failed to determine if configuration has changed: %v", err))
 					return
 				}
 				if hasChanged {
@@ -104,20 +390,33 @@ func Exec(runner Runner, opts ...ExecOption) error {
 						runner.Stop()
 					case conf.onEnvChange == Restart:
 						runner.Restart()
+					case conf.onEnvChange == Signal:
+						runner.Signal(conf.changeSignal)
 					}
 				}
 			}
 		}()
 	}
 
-	runErrChan := make(chan error)
+	// Stop supervising when the current process is asked
+	// to terminate. The runner forwards the signal to the
+	// command, which should exit, and is not restarted.
+	if conf.restartPolicy != nil && len(exec.TerminationSignals) > 0 {
+		term := make(chan os.Signal, 1)
+		signal.Notify(term, exec.TerminationSignals...)
+		defer signal.Stop(term)
+		go func() {
+			select {
+			case <-term:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	runErrChan := make(chan error, 1)
 	go func() {
-		err := runner.Run()
-		if err != nil {
-			runErrChan <- err
-			return
-		}
-		runErrChan <- nil
+		runErrChan <- supervise(runner, conf.restartPolicy, ctx.Done())
 	}()
 
 	// wait for an error from one of the channels
@@ -128,3 +427,79 @@ func Exec(runner Runner, opts ...ExecOption) error {
 		return err
 	}
 }
+
+// hasConfigurationChanged re-evaluates the runner's
+// configuration and, if it has changed, reports the
+// changes to onChanges (if the runner can describe them)
+func hasConfigurationChanged(runner Runner, onChanges func(exec.Changes)) (bool, error) {
+	cr, ok := runner.(ChangeReporter)
+	if !ok || onChanges == nil {
+		return runner.HasConfigurationChanged()
+	}
+	c, err := cr.ConfigurationChanges()
+	if err != nil {
+		return false, err
+	}
+	if !c.HasChanged() {
+		return false, nil
+	}
+	onChanges(c)
+	return true, nil
+}
+
+// supervise runs the runner and, if it fails, runs
+// it again as the restart policy allows, until done
+// is closed. It returns the runner's last error.
+func supervise(runner Runner, p *RestartPolicy, done <-chan struct{}) error {
+	if p == nil {
+		return runner.Run()
+	}
+
+	backoff := p.InitialBackoff
+	var failures []time.Time // recent, unhealthy runs
+	for {
+		start := time.Now()
+		err := runner.Run()
+		if err == nil {
+			return nil
+		}
+
+		// a runner which exits after being asked
+		// to terminate is not restarted
+		if ee, ok := err.(*exec.ExitError); ok && ee.Terminated {
+			return err
+		}
+		select {
+		case <-done:
+			return err
+		default:
+		}
+
+		// A run which lasted the minimum uptime was
+		// healthy, so its failure starts afresh
+		now := time.Now()
+		if p.MinUptime > 0 && now.Sub(start) >= p.MinUptime {
+			backoff = p.InitialBackoff
+			failures = nil
+		}
+		failures = append(failures, now)
+		if p.Window > 0 {
+			for len(failures) > 0 && now.Sub(failures[0]) > p.Window {
+				failures = failures[1:]
+			}
+		}
+		if p.MaxRestarts > 0 && len(failures) > p.MaxRestarts {
+			return err
+		}
+
+		select {
+		case <-done:
+			return err
+		case <-time.After(p.jitter(backoff)):
+		}
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package exec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dhoelle/redactr/escape"
+)
+
+//go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/source_replacer.go --fake-name SourceReplacer . SourceReplacer
+
+// A SourceReplacer is a SecretReplacer which can also
+// report where each secret came from, so that changes
+// to a command's configuration can be described without
+// revealing the secrets themselves.
+type SourceReplacer interface {
+	SecretReplacer
+	ReplaceSources(s string, f escape.Format) (replaced string, secrets []Secret, err error)
+}
+
+// A Secret is a secret which was unredacted
+// to render a command's inputs
+type Secret struct {
+	// Source describes where the secret came from,
+	// like "vault:secret/data/db#password". It never
+	// holds the secret itself.
+	Source string
+
+	// Value is the unredacted secret
+	Value string
+}
+
+// Changes describes how the configuration of a command
+// has changed. It names what changed, but never holds
+// the values of secrets.
+type Changes struct {
+	// Env holds the names of changed
+	// environment variables
+	Env []string
+
+	// Args holds the positions of changed args,
+	// including args which name a redacted file
+	// whose contents changed
+	Args []int
+
+	// Sources holds the sources of changed
+	// secrets (see Secret), when the Runner's
+	// Replacer is a SourceReplacer
+	Sources []string
+}
+
+// HasChanged returns true if anything has changed
+func (c Changes) HasChanged() bool {
+	return len(c.Env) > 0 || len(c.Args) > 0 || len(c.Sources) > 0
+}
+
+// String describes the changes, like
+// "env DB_PASSWORD; args 2; secrets vault:secret/data/db#password"
+func (c Changes) String() string {
+	var parts []string
+	if len(c.Env) > 0 {
+		parts = append(parts, "env "+strings.Join(c.Env, ", "))
+	}
+	if len(c.Args) > 0 {
+		args := make([]string, len(c.Args))
+		for i, a := range c.Args {
+			args[i] = fmt.Sprint(a)
+		}
+		parts = append(parts, "args "+strings.Join(args, ", "))
+	}
+	if len(c.Sources) > 0 {
+		parts = append(parts, "secrets "+strings.Join(c.Sources, ", "))
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// changesFrom describes how inputs b differ from a
+func (a commandInputs) changesFrom(b commandInputs) Changes {
+	var c Changes
+
+	// environment variables, by name, including
+	// those whose secrets are delivered in files
+	// (a command sees the last value of a name, as
+	// with Env.Get, so only that value is compared)
+	changedEnv := make(map[string]bool)
+	for _, e := range []Env{a.env, b.env} {
+		for _, v := range e {
+			if changedEnv[v.Name] {
+				continue
+			}
+			av, aok := a.env.Get(v.Name)
+			bv, bok := b.env.Get(v.Name)
+			if aok != bok || av != bv {
+				changedEnv[v.Name] = true
+				c.Env = append(c.Env, v.Name)
+			}
+		}
+	}
+	aEnvFiles, bEnvFiles := filesByEnv(a.files), filesByEnv(b.files)
+	for _, f := range a.files {
+		if f.env != "" && bEnvFiles[f.env] != f {
+			c.Env = append(c.Env, f.env)
+		}
+	}
+	for _, f := range b.files {
+		if _, ok := aEnvFiles[f.env]; f.env != "" && !ok {
+			c.Env = append(c.Env, f.env)
+		}
+	}
+
+	// args, and the redacted files named in them
+	changedArgs := make(map[int]bool)
+	for i := 0; i < len(a.args) || i < len(b.args); i++ {
+		if i >= len(a.args) || i >= len(b.args) || a.args[i] != b.args[i] {
+			changedArgs[i] = true
+		}
+	}
+	aFiles, bFiles := filesByArg(a.files), filesByArg(b.files)
+	for i, f := range aFiles {
+		if bFiles[i] != f {
+			changedArgs[i] = true
+		}
+	}
+	for i, f := range bFiles {
+		if aFiles[i] != f {
+			changedArgs[i] = true
+		}
+	}
+	for i := range changedArgs {
+		c.Args = append(c.Args, i)
+	}
+	sort.Ints(c.Args)
+
+	// secrets, by source
+	aSources, bSources := secretsBySource(a.secrets), secretsBySource(b.secrets)
+	changedSources := make(map[string]bool)
+	for s, v := range aSources {
+		if bv, ok := bSources[s]; !ok || bv != v {
+			changedSources[s] = true
+		}
+	}
+	for s := range bSources {
+		if _, ok := aSources[s]; !ok {
+			changedSources[s] = true
+		}
+	}
+	for s := range changedSources {
+		c.Sources = append(c.Sources, s)
+	}
+	sort.Strings(c.Sources)
+
+	return c
+}
+
+func filesByArg(files []renderedFile) map[int]renderedFile {
+	m := make(map[int]renderedFile, len(files))
+	for _, f := range files {
+		if f.arg >= 0 {
+			m[f.arg] = f
+		}
+	}
+	return m
+}
+
+func filesByEnv(files []renderedFile) map[string]renderedFile {
+	m := make(map[string]renderedFile, len(files))
+	for _, f := range files {
+		if f.env != "" {
+			m[f.env] = f
+		}
+	}
+	return m
+}
+
+// secretsBySource maps the source of each
+// secret with a known source to its value
+func secretsBySource(secrets []Secret) map[string]string {
+	m := make(map[string]string)
+	for _, s := range secrets {
+		if s.Source != "" {
+			m[s.Source] = s.Value
+		}
+	}
+	return m
+}
@@ -0,0 +1,87 @@
+package exec_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dhoelle/redactr/exec"
+)
+
+func TestChangesFrom(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b       []string
+		aArgs      []string
+		bArgs      []string
+		wantEnv    []string
+		wantArgs   []int
+		wantChange bool
+	}{
+		{
+			name: "no changes",
+			a:    []string{"A=1", "B=2"},
+			b:    []string{"A=1", "B=2"},
+		},
+		{
+			name:       "a changed value",
+			a:          []string{"A=1", "B=2"},
+			b:          []string{"A=1", "B=3"},
+			wantEnv:    []string{"B"},
+			wantChange: true,
+		},
+		{
+			name: "reordered variables",
+			a:    []string{"A=1", "B=2", "C=3"},
+			b:    []string{"C=3", "A=1", "B=2"},
+		},
+		{
+			name:       "an inserted variable",
+			a:          []string{"A=1", "B=2"},
+			b:          []string{"NEW=0", "A=1", "B=2"},
+			wantEnv:    []string{"NEW"},
+			wantChange: true,
+		},
+		{
+			name:       "a removed variable",
+			a:          []string{"A=1", "GONE=0", "B=2"},
+			b:          []string{"A=1", "B=2"},
+			wantEnv:    []string{"GONE"},
+			wantChange: true,
+		},
+		{
+			name: "a changed value which is overridden",
+			a:    []string{"A=1", "A=2"},
+			b:    []string{"A=3", "A=2"},
+		},
+		{
+			name:       "a changed override",
+			a:          []string{"A=1", "A=2"},
+			b:          []string{"A=1", "A=3"},
+			wantEnv:    []string{"A"},
+			wantChange: true,
+		},
+		{
+			name:       "a changed arg",
+			a:          []string{"A=1"},
+			b:          []string{"A=1"},
+			aArgs:      []string{"run", "x"},
+			bArgs:      []string{"run", "y", "z"},
+			wantArgs:   []int{1, 2},
+			wantChange: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := exec.ChangesFrom(tt.a, tt.b, tt.aArgs, tt.bArgs)
+			if !reflect.DeepEqual(c.Env, tt.wantEnv) {
+				t.Errorf("want changed env %v, got %v", tt.wantEnv, c.Env)
+			}
+			if !reflect.DeepEqual(c.Args, tt.wantArgs) {
+				t.Errorf("want changed args %v, got %v", tt.wantArgs, c.Args)
+			}
+			if c.HasChanged() != tt.wantChange {
+				t.Errorf("HasChanged(): want %v, got %v", tt.wantChange, c.HasChanged())
+			}
+		})
+	}
+}
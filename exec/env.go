@@ -0,0 +1,210 @@
+package exec
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// A Var is an environment variable
+type Var struct {
+	Name  string
+	Value string
+}
+
+// String returns the variable as NAME=value
+func (v Var) String() string {
+	return v.Name + "=" + v.Value
+}
+
+// An Env is an environment: an ordered list of variables,
+// like os.Environ(). As in the environment of a process, a
+// name may appear more than once; the last value is the
+// one which takes effect (see Get).
+type Env []Var
+
+// ParseEnv parses an environment array, of strings
+// like ["FOO=bar", "BAZ=a=b"]. Each string is split on
+// its first =, so values may hold = (like base64). An
+// entry without an = has an empty value.
+//
+// On Windows, the names of some variables start with
+// an = (like "=C:=C:\path"). The = is kept in the name.
+func ParseEnv(env []string) Env {
+	e := make(Env, 0, len(env))
+	for _, kv := range env {
+		e = append(e, parseVar(kv))
+	}
+	return e
+}
+
+func parseVar(kv string) Var {
+	// look for the = after the first character,
+	// so that a leading = stays in the name
+	i := -1
+	if len(kv) > 0 {
+		if j := strings.IndexByte(kv[1:], '='); j >= 0 {
+			i = j + 1
+		}
+	}
+	if i < 0 {
+		return Var{Name: kv}
+	}
+	return Var{Name: kv[:i], Value: kv[i+1:]}
+}
+
+// Strings returns the environment as
+// an array, like os.Environ()
+func (e Env) Strings() []string {
+	ss := make([]string, len(e))
+	for i, v := range e {
+		ss[i] = v.String()
+	}
+	return ss
+}
+
+// Get returns the value of the last variable
+// with the given name, and whether there is one
+func (e Env) Get(name string) (string, bool) {
+	for i := len(e) - 1; i >= 0; i-- {
+		if e[i].Name == name {
+			return e[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// Lookup returns the value of the named
+// variable, or "" (like os.Getenv)
+func (e Env) Lookup(name string) string {
+	v, _ := e.Get(name)
+	return v
+}
+
+// ParseEnvFile parses an environment file, of lines like:
+//
+//    # a comment
+//    FOO=bar
+//    export BAR="multiple\nlines"
+//    BAZ='single quoted' # and a comment
+//
+// Values in double quotes may use the escapes \\, \",
+// \n, \r and \$ (as escaped by escape.Dotenv). Single-
+// quoted values are read literally.
+func ParseEnvFile(r io.Reader) (Env, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %v", err)
+	}
+
+	var env Env
+	s := string(b)
+	line := 1
+	for len(s) > 0 {
+		var v *Var
+		var n int
+		v, n, err = parseEnvLine(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid env file on line %v: %v", line, err)
+		}
+		if v != nil {
+			env = append(env, *v)
+		}
+		line += strings.Count(s[:n], "\n")
+		s = s[n:]
+	}
+	return env, nil
+}
+
+// parseEnvLine parses the line at the start of s, which
+// may hold a variable, and returns the number of bytes
+// that it spans (a quoted value may span many lines)
+func parseEnvLine(s string) (*Var, int, error) {
+	end := strings.IndexByte(s, '\n')
+	if end < 0 {
+		end = len(s)
+	}
+	rest := strings.TrimLeft(s[:end], " \t")
+	if rest == "" || rest[0] == '#' {
+		return nil, skipNewline(s, end), nil
+	}
+	rest = strings.TrimPrefix(rest, "export ")
+	offset := end - len(strings.TrimLeft(rest, " \t"))
+	rest = s[offset:]
+
+	eq := strings.IndexByte(rest, '=')
+	if eq < 0 || eq > strings.IndexByte(rest+"\n", '\n') {
+		return nil, 0, fmt.Errorf("expected NAME=value")
+	}
+	name := strings.TrimSpace(rest[:eq])
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return nil, 0, fmt.Errorf("invalid name %q", name)
+	}
+	rest = rest[eq+1:]
+	offset += eq + 1
+
+	var value string
+	var n int // the length of the value, with any quotes
+	switch {
+	case strings.HasPrefix(rest, `"`):
+		var b strings.Builder
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			c := rest[i]
+			if c == '\\' && i+1 < len(rest) {
+				i++
+				switch rest[i] {
+				case 'n':
+					c = '\n'
+				case 'r':
+					c = '\r'
+				case '\\', '"', '$':
+					c = rest[i]
+				default:
+					b.WriteByte('\\')
+					c = rest[i]
+				}
+			}
+			b.WriteByte(c)
+		}
+		if i >= len(rest) {
+			return nil, 0, fmt.Errorf("unterminated double-quoted value")
+		}
+		value, n = b.String(), i+1
+	case strings.HasPrefix(rest, "'"):
+		i := strings.IndexByte(rest[1:], '\'')
+		if i < 0 {
+			return nil, 0, fmt.Errorf("unterminated single-quoted value")
+		}
+		value, n = rest[1:i+1], i+2
+	default:
+		n = strings.IndexByte(rest, '\n')
+		if n < 0 {
+			n = len(rest)
+		}
+		value = rest[:n]
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		value = strings.TrimSpace(value)
+	}
+
+	// the rest of the line may only hold a comment
+	offset += n
+	end = offset + strings.IndexByte(s[offset:]+"\n", '\n')
+	trailing := strings.TrimSpace(s[offset:end])
+	if trailing != "" && trailing[0] != '#' {
+		return nil, 0, fmt.Errorf("unexpected %q after the value of %v", trailing, name)
+	}
+	return &Var{Name: name, Value: value}, skipNewline(s, end), nil
+}
+
+// skipNewline returns the index after
+// the line break at end (if there is one)
+func skipNewline(s string, end int) int {
+	if end < len(s) {
+		return end + 1
+	}
+	return end
+}
@@ -0,0 +1,115 @@
+package exec_test
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dhoelle/redactr/exec"
+	"github.com/dhoelle/redactr/exec/fakes"
+)
+
+func TestParseEnv(t *testing.T) {
+	env := exec.ParseEnv([]string{
+		"FOO=bar",
+		"KEY=xuY6/V0ZE29RtPD3TNWga/EkdU3XYsPtBIk8U4nzZyc=",
+		"EMPTY=",
+		"NOVALUE",
+		"=C:=C:\\path",
+		"FOO=baz",
+	})
+	want := exec.Env{
+		{Name: "FOO", Value: "bar"},
+		{Name: "KEY", Value: "xuY6/V0ZE29RtPD3TNWga/EkdU3XYsPtBIk8U4nzZyc="},
+		{Name: "EMPTY", Value: ""},
+		{Name: "NOVALUE", Value: ""},
+		{Name: "=C:", Value: "C:\\path"},
+		{Name: "FOO", Value: "baz"},
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Fatalf("ParseEnv()\n\twant %#v\n\t got %#v", want, env)
+	}
+
+	if v, ok := env.Get("FOO"); !ok || v != "baz" {
+		t.Errorf(`Env.Get("FOO") = %q, %v, want the last value, "baz"`, v, ok)
+	}
+	if _, ok := env.Get("MISSING"); ok {
+		t.Errorf(`Env.Get("MISSING"): expected no variable`)
+	}
+	if got := env.Strings(); got[1] != "KEY=xuY6/V0ZE29RtPD3TNWga/EkdU3XYsPtBIk8U4nzZyc=" || got[5] != "FOO=baz" {
+		t.Errorf("Env.Strings() got %q", got)
+	}
+}
+
+func TestParseEnvFile(t *testing.T) {
+	t.Run("it should parse variables", func(t *testing.T) {
+		env, err := exec.ParseEnvFile(strings.NewReader(`# a comment
+
+FOO=bar
+  export BAR="multiple\nlines with \"quotes\" and \$HOME"
+BAZ='single # quoted \n' # and a comment
+KEY=abc= # base64
+BLOCK="a
+b"
+LAST=last`))
+		if err != nil {
+			t.Fatalf("ParseEnvFile() got err: %v", err)
+		}
+		want := exec.Env{
+			{Name: "FOO", Value: "bar"},
+			{Name: "BAR", Value: "multiple\nlines with \"quotes\" and $HOME"},
+			{Name: "BAZ", Value: `single # quoted \n`},
+			{Name: "KEY", Value: "abc="},
+			{Name: "BLOCK", Value: "a\nb"},
+			{Name: "LAST", Value: "last"},
+		}
+		if !reflect.DeepEqual(env, want) {
+			t.Errorf("ParseEnvFile()\n\twant %#v\n\t got %#v", want, env)
+		}
+	})
+
+	errs := map[string]string{
+		"no =":                  "FOO=bar\nnot a variable\n",
+		"unterminated quote":    "FOO=\"bar\n",
+		"text after the quotes": "FOO='bar' baz\n",
+		"space in name":         "MY VAR=bar\n",
+	}
+	for name, doc := range errs {
+		t.Run("it should reject a file with "+name, func(t *testing.T) {
+			if _, err := exec.ParseEnvFile(strings.NewReader(doc)); err == nil {
+				t.Errorf("ParseEnvFile(): expected an error")
+			}
+		})
+	}
+
+	t.Run("it should report the line of an error", func(t *testing.T) {
+		_, err := exec.ParseEnvFile(strings.NewReader("A=\"a\nb\"\n\nnope\n"))
+		if err == nil || !strings.Contains(err.Error(), "line 4") {
+			t.Errorf("ParseEnvFile(): expected an error on line 4, got: %v", err)
+		}
+	})
+}
+
+func TestRunner_EnvValuesWithEquals(t *testing.T) {
+	replacer := &fakes.Replacer{}
+	replacer.ReplaceStub = func(s string) (string, error) {
+		return strings.Replace(s, "~~redacted~~", "c2VjcmV0==", -1), nil
+	}
+
+	var out bytes.Buffer
+	runner := exec.NewRunner(
+		strings.NewReader(""),
+		&out,
+		os.Stderr,
+		[]string{"KEY=~~redacted~~", "PLAIN=a=b", "DUP=first", "DUP=second"},
+		replacer,
+		"echo", "$KEY", "$PLAIN", "$DUP")
+	if err := runner.Run(); err != nil {
+		t.Fatalf("Run() got err: %v", err)
+	}
+	if want := "c2VjcmV0== a=b second\n"; out.String() != want {
+		t.Errorf("Run()\n\twant %q\n\t got %q", want, out.String())
+	}
+}
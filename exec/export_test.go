@@ -0,0 +1,9 @@
+package exec
+
+// ChangesFrom describes how the environment and args
+// of inputs b differ from those of inputs a
+func ChangesFrom(aEnv, bEnv []string, aArgs, bArgs []string) Changes {
+	a := commandInputs{env: ParseEnv(aEnv), args: aArgs}
+	b := commandInputs{env: ParseEnv(bEnv), args: bArgs}
+	return a.changesFrom(b)
+}
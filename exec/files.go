@@ -0,0 +1,216 @@
+package exec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dhoelle/redactr/escape"
+)
+
+// RedactedFilePrefix marks an argument which names a
+// redacted file, like `@redacted:config.yaml.redacted`.
+// The file is unredacted into a private file, and the
+// argument is rewritten to point at it.
+//
+// The prefix may also follow an = in an argument,
+// like `--config=@redacted:config.yaml.redacted`.
+const RedactedFilePrefix = "@redacted:"
+
+//go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/format_replacer.go --fake-name FormatReplacer . FormatReplacer
+
+// A FormatReplacer is a Replacer which can escape its
+// replacements for the format of a document, like JSON.
+//
+// If the Runner's Replacer is a FormatReplacer (or a
+// SecretReplacer), redacted files are unredacted with
+// escaping for their format (as detected from the
+// file's name).
+type FormatReplacer interface {
+	Replacer
+	ReplaceFormat(s string, f escape.Format) (string, error)
+}
+
+// SecretFileEnvSuffix is added to the name of an
+// environment variable whose secret is delivered in a
+// file (see Runner.SecretFiles), like FOO_FILE, as
+// in the convention of many Docker images
+const SecretFileEnvSuffix = "_FILE"
+
+// A renderedFile is an unredacted copy of a redacted
+// file, or a secret from the environment, which is
+// written before the command runs
+type renderedFile struct {
+	arg     int    // the index of the arg which names it, or -1
+	env     string // the environment variable it replaces, if any
+	path    string
+	content string
+	mode    os.FileMode
+}
+
+// redactedFileArg splits an argument which names a redacted
+// file into the text before the file (like "--config=")
+// and the file's path
+func redactedFileArg(arg string) (before, path string, ok bool) {
+	i := strings.Index(arg, RedactedFilePrefix)
+	if i < 0 || (i > 0 && arg[i-1] != '=') {
+		return "", "", false
+	}
+	path = arg[i+len(RedactedFilePrefix):]
+	if path == "" {
+		return "", "", false
+	}
+	return arg[:i], path, true
+}
+
+// RedactedFiles returns the paths of the redacted
+// files named in args (see RedactedFilePrefix)
+func RedactedFiles(args []string) []string {
+	var paths []string
+	for _, arg := range args {
+		if _, path, ok := redactedFileArg(arg); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// renderFile unredacts a redacted file into a file
+// in the private directory, named for the argument
+// it was given in (at index i)
+func (r *Runner) renderFile(i int, path string, secrets *[]Secret) (renderedFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return renderedFile{}, fmt.Errorf("failed to read redacted file: %v", err)
+	}
+
+	content, err := r.replace(string(b), escape.FormatOf(path), secrets)
+	if err != nil {
+		return renderedFile{}, fmt.Errorf("failed to unredact %v: %v", path, err)
+	}
+
+	dir, err := r.privateDir()
+	if err != nil {
+		return renderedFile{}, err
+	}
+
+	// keep the file's name (without .redacted), so
+	// that commands can tell its format from its name
+	name := strings.TrimSuffix(filepath.Base(path), ".redacted")
+	return renderedFile{
+		arg:     i,
+		path:    filepath.Join(dir, strconv.Itoa(i), name),
+		content: content,
+		mode:    0600,
+	}, nil
+}
+
+// renderSecretFiles moves the secrets out of an
+// unredacted environment and into files: each variable
+// which held a redacted token (whose value changed when
+// it was unredacted), like FOO, is replaced with FOO_FILE,
+// which names a read-only file holding its value
+func (r *Runner) renderSecretFiles(original, env Env) (Env, []renderedFile, error) {
+	var kept Env
+	var files []renderedFile
+	for i, v := range env {
+		if i < len(original) && v == original[i] {
+			kept = append(kept, v)
+			continue
+		}
+
+		dir, err := r.privateDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		f := renderedFile{
+			arg:     -1,
+			env:     v.Name,
+			path:    filepath.Join(dir, "env", v.Name),
+			content: v.Value,
+			mode:    0400,
+		}
+		files = append(files, f)
+		kept = append(kept, Var{Name: v.Name + SecretFileEnvSuffix, Value: f.path})
+	}
+	return kept, files, nil
+}
+
+// privateDir returns the Runner's private directory,
+// creating it if needed. It is created in memory-backed
+// storage (/dev/shm), where that is available, so that
+// unredacted files are not written to disk.
+func (r *Runner) privateDir() (string, error) {
+	r.dirlock.Lock()
+	defer r.dirlock.Unlock()
+
+	if r.dir != "" {
+		return r.dir, nil
+	}
+
+	var dir string
+	var err error
+	for _, base := range privateDirBases() {
+		dir, err = ioutil.TempDir(base, "redactr-")
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create private directory: %v", err)
+	}
+
+	// TempDir creates directories with mode 0700
+	r.dir = dir
+	return dir, nil
+}
+
+// privateDirBases lists the places where
+// a private directory may be created, in
+// order of preference
+func privateDirBases() []string {
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return []string{"/dev/shm", ""}
+	}
+	return []string{""}
+}
+
+// writeFiles writes rendered files into the private
+// directory, readable only by the current user.
+// Each file is replaced atomically, so that the command
+// never reads a partly-written file.
+func (r *Runner) writeFiles(files []renderedFile) error {
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+			return fmt.Errorf("failed to create directory for %v: %v", f.path, err)
+		}
+		tmp := f.path + ".tmp"
+		os.Remove(tmp) // left behind by a failed write
+		if err := ioutil.WriteFile(tmp, []byte(f.content), f.mode); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write %v: %v", f.path, err)
+		}
+		if err := os.Rename(tmp, f.path); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write %v: %v", f.path, err)
+		}
+	}
+	return nil
+}
+
+// removeFiles removes the private directory,
+// and every file in it
+func (r *Runner) removeFiles() error {
+	r.dirlock.Lock()
+	defer r.dirlock.Unlock()
+
+	if r.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(r.dir)
+	r.dir = ""
+	return err
+}
@@ -0,0 +1,140 @@
+package exec
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A MaskingWriter writes to an underlying writer,
+// replacing secrets with a placeholder, like:
+//
+//   my password is ****
+//
+// Secrets which are split across writes are masked
+// too: the MaskingWriter holds back any output which
+// could be the start of a secret until it can tell
+// whether it is one. Call Flush when no more output
+// will be written, to write any held-back output.
+type MaskingWriter struct {
+	w           io.Writer
+	placeholder []byte
+
+	mu      sync.Mutex
+	secrets []string // longest first
+	pending []byte
+}
+
+// NewMaskingWriter creates a new MaskingWriter
+func NewMaskingWriter(w io.Writer, placeholder string) *MaskingWriter {
+	return &MaskingWriter{
+		w:           w,
+		placeholder: []byte(placeholder),
+	}
+}
+
+// AddSecrets adds secrets to be masked. Empty
+// secrets, and secrets which are already
+// masked, are ignored.
+func (m *MaskingWriter) AddSecrets(secrets ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	known := make(map[string]bool, len(m.secrets))
+	for _, s := range m.secrets {
+		known[s] = true
+	}
+	for _, s := range secrets {
+		if s == "" || known[s] {
+			continue
+		}
+		known[s] = true
+		m.secrets = append(m.secrets, s)
+	}
+
+	// match longer secrets first, so that a secret
+	// which contains another is masked whole
+	sort.SliceStable(m.secrets, func(i, j int) bool {
+		return len(m.secrets[i]) > len(m.secrets[j])
+	})
+}
+
+// Write masks secrets in p, and writes the
+// result to the underlying writer. Output which
+// could be the start of a secret is held back
+// until the next Write (or Flush).
+func (m *MaskingWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buf := append(m.pending, p...)
+	out, rest := m.mask(buf, false)
+	m.pending = append([]byte(nil), rest...)
+	if _, err := m.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush masks and writes any held-back output
+func (m *MaskingWriter) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.pending) == 0 {
+		return nil
+	}
+	out, _ := m.mask(m.pending, true)
+	m.pending = nil
+	_, err := m.w.Write(out)
+	return err
+}
+
+// mask replaces the secrets in buf with the placeholder.
+// Unless final is set, it stops at the first byte which
+// could start a secret that continues past the end of
+// buf, and returns the rest of buf to be held back.
+func (m *MaskingWriter) mask(buf []byte, final bool) (out, rest []byte) {
+	var b bytes.Buffer
+	start := 0
+	i := 0
+	for i < len(buf) {
+		if !final && m.couldStart(buf[i:]) {
+			break
+		}
+		if n := m.matchAt(buf[i:]); n > 0 {
+			b.Write(buf[start:i])
+			b.Write(m.placeholder)
+			i += n
+			start = i
+			continue
+		}
+		i++
+	}
+	b.Write(buf[start:i])
+	return b.Bytes(), buf[i:]
+}
+
+// couldStart returns true if p is the
+// start of a secret that is longer than p
+func (m *MaskingWriter) couldStart(p []byte) bool {
+	for _, s := range m.secrets {
+		if len(s) > len(p) && strings.HasPrefix(s, string(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAt returns the length of the longest
+// secret at the start of p, or 0 if there is none
+func (m *MaskingWriter) matchAt(p []byte) int {
+	for _, s := range m.secrets {
+		if len(p) >= len(s) && string(p[:len(s)]) == s {
+			return len(s)
+		}
+	}
+	return 0
+}
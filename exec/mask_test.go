@@ -0,0 +1,82 @@
+package exec_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dhoelle/redactr/exec"
+)
+
+func TestMaskingWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []string
+		writes  []string
+		want    string
+	}{
+		{
+			name:    "it should mask a secret",
+			secrets: []string{"hunter2"},
+			writes:  []string{"my password is hunter2\n"},
+			want:    "my password is ****\n",
+		},
+		{
+			name:    "it should mask a secret split across writes",
+			secrets: []string{"hunter2"},
+			writes:  []string{"my password is hun", "t", "er2\n"},
+			want:    "my password is ****\n",
+		},
+		{
+			name:    "it should write a partial match which is not a secret",
+			secrets: []string{"hunter2"},
+			writes:  []string{"my name is hun", "ter\n"},
+			want:    "my name is hunter\n",
+		},
+		{
+			name:    "it should write held-back output on flush",
+			secrets: []string{"hunter2"},
+			writes:  []string{"hunt"},
+			want:    "hunt",
+		},
+		{
+			name:    "it should mask the longest secret",
+			secrets: []string{"pass", "password"},
+			writes:  []string{"a pass", "word and a pass"},
+			want:    "a **** and a ****",
+		},
+		{
+			name:    "it should mask repeated and adjacent secrets",
+			secrets: []string{"ab", "cd"},
+			writes:  []string{"abcdab", "ab"},
+			want:    "****************",
+		},
+		{
+			name:    "it should ignore empty secrets",
+			secrets: []string{""},
+			writes:  []string{"hello"},
+			want:    "hello",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			m := exec.NewMaskingWriter(&out, "****")
+			m.AddSecrets(tt.secrets...)
+			for _, w := range tt.writes {
+				n, err := m.Write([]byte(w))
+				if err != nil {
+					t.Fatalf("Write() got err: %v", err)
+				}
+				if n != len(w) {
+					t.Errorf("Write(): want n=%v, got %v", len(w), n)
+				}
+			}
+			if err := m.Flush(); err != nil {
+				t.Fatalf("Flush() got err: %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
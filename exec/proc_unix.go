@@ -0,0 +1,77 @@
+//go:build !windows
+// +build !windows
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// ForwardedSignals are the signals which
+// redactr forwards to the commands it runs
+var ForwardedSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// TerminationSignals are the signals which ask redactr
+// to terminate. A command which exits after one of them
+// is forwarded to it is not restarted.
+var TerminationSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGQUIT,
+}
+
+// terminalSignals are signals which a terminal sends to
+// every process in its foreground process group. They
+// are not forwarded to a command in redactr's own
+// process group, which receives them already.
+var terminalSignals = map[os.Signal]bool{
+	syscall.SIGINT:  true,
+	syscall.SIGQUIT: true,
+}
+
+// defaultStopSignal is sent to a command
+// to ask it to stop
+var defaultStopSignal os.Signal = syscall.SIGTERM
+
+// signalNames maps signal names
+// (without "SIG") to signals
+var signalNames = map[string]syscall.Signal{
+	"ABRT":  syscall.SIGABRT,
+	"ALRM":  syscall.SIGALRM,
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"KILL":  syscall.SIGKILL,
+	"QUIT":  syscall.SIGQUIT,
+	"TERM":  syscall.SIGTERM,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// setProcessGroup starts the command
+// in a new process group
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcess sends a signal to a process, or,
+// if group is set, to the process group it leads
+func signalProcess(p *os.Process, sig os.Signal, group bool) error {
+	if !group {
+		return p.Signal(sig)
+	}
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return p.Signal(sig)
+	}
+	return syscall.Kill(-p.Pid, s)
+}
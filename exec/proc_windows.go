@@ -0,0 +1,51 @@
+//go:build windows
+// +build windows
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// ForwardedSignals are the signals which
+// redactr forwards to the commands it runs.
+//
+// Windows can't send signals to processes, so
+// none are forwarded (a console's Ctrl+C already
+// reaches every process attached to it).
+var ForwardedSignals []os.Signal
+
+// TerminationSignals are the signals which ask
+// redactr to terminate (like a console's Ctrl+C)
+var TerminationSignals = []os.Signal{os.Interrupt}
+
+// terminalSignals are signals which a terminal sends
+// to every process attached to it. They are not
+// forwarded.
+var terminalSignals = map[os.Signal]bool{
+	os.Interrupt: true,
+}
+
+// defaultStopSignal is sent to a command to ask it to
+// stop. Windows can only kill processes, so commands
+// are stopped immediately.
+var defaultStopSignal os.Signal = os.Kill
+
+// signalNames maps signal names
+// (without "SIG") to signals
+var signalNames = map[string]syscall.Signal{
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// setProcessGroup does nothing on Windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcess sends a signal to a process.
+// Only os.Kill is supported on Windows.
+func signalProcess(p *os.Process, sig os.Signal, group bool) error {
+	return p.Signal(sig)
+}
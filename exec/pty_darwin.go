@@ -0,0 +1,47 @@
+package exec
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ioctlReadTermios  = unix.TIOCGETA
+	ioctlWriteTermios = unix.TIOCSETA
+)
+
+// openPTY opens a new pseudo-terminal
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open /dev/ptmx: %v", err)
+	}
+
+	// grant and unlock the slave, and find its name
+	fd := master.Fd()
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, unix.TIOCPTYGRANT, 0); errno != 0 {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to grant pseudo-terminal: %v", errno)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, unix.TIOCPTYUNLK, 0); errno != 0 {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to unlock pseudo-terminal: %v", errno)
+	}
+	buf := make([]byte, 128)
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, unix.TIOCPTYGNAME, uintptr(unsafe.Pointer(&buf[0]))); errno != 0 {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to find pseudo-terminal: %v", errno)
+	}
+
+	name := string(buf[:bytes.IndexByte(buf, 0)])
+	slave, err = os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to open %v: %v", name, err)
+	}
+	return master, slave, nil
+}
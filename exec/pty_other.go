@@ -0,0 +1,24 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package exec
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+
+func attachPTY(cmd *exec.Cmd) (master, slave *os.File, err error) {
+	return nil, nil, fmt.Errorf("pseudo-terminals are not supported on %v", runtime.GOOS)
+}
+
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, fmt.Errorf("raw terminals are not supported on %v", runtime.GOOS)
+}
+
+func propagateWindowSize(from, to *os.File) (stop func()) {
+	return func() {}
+}
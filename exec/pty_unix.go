@@ -0,0 +1,97 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package exec
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+
+// attachPTY allocates a pseudo-terminal for cmd, which
+// runs in a session of its own, with the terminal as its
+// controlling terminal and its input and output. It
+// returns the terminal's master side, and its slave side,
+// which should be closed once the command has started.
+func attachPTY(cmd *exec.Cmd) (master, slave *os.File, err error) {
+	master, slave, err = openPTY()
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+		Ctty:    0, // the command's stdin
+	}
+	return master, slave, nil
+}
+
+// makeRaw puts a terminal into raw mode, so that every
+// key (including ^C) passes through it to the command's
+// pseudo-terminal, and returns a func which restores it
+func makeRaw(f *os.File) (restore func(), err error) {
+	fd := int(f.Fd())
+	old, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terminal attributes: %v", err)
+	}
+
+	// as in cfmakeraw(3)
+	raw := *old
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, &raw); err != nil {
+		return nil, fmt.Errorf("failed to set terminal attributes: %v", err)
+	}
+	return func() { unix.IoctlSetTermios(fd, ioctlWriteTermios, old) }, nil
+}
+
+// copyWindowSize sets the window size
+// of terminal to to that of from
+func copyWindowSize(from, to *os.File) error {
+	ws, err := unix.IoctlGetWinsize(int(from.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return fmt.Errorf("failed to read window size: %v", err)
+	}
+	if err := unix.IoctlSetWinsize(int(to.Fd()), unix.TIOCSWINSZ, ws); err != nil {
+		return fmt.Errorf("failed to set window size: %v", err)
+	}
+	return nil
+}
+
+// propagateWindowSize copies the window size of terminal
+// from to terminal to, now and whenever it changes,
+// until stop is called
+func propagateWindowSize(from, to *os.File) (stop func()) {
+	copyWindowSize(from, to)
+
+	winch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(winch, unix.SIGWINCH)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-winch:
+				copyWindowSize(from, to)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(winch)
+		close(done)
+	}
+}
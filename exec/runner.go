@@ -3,14 +3,15 @@
 package exec
 
 import (
-	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
-	"strings"
+	"os/signal"
 	"sync"
 	"time"
+
+	"github.com/dhoelle/redactr/escape"
 )
 
 //go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/replacer.go --fake-name Replacer . Replacer
@@ -20,26 +21,95 @@ type Replacer interface {
 	Replace(string) (string, error)
 }
 
+//go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/secret_replacer.go --fake-name SecretReplacer . SecretReplacer
+
+// A SecretReplacer is a Replacer which can report the
+// secrets that it puts in place of redacted values,
+// so that they can be masked in a command's output.
+// Like a FormatReplacer, it escapes its replacements
+// for the given format.
+type SecretReplacer interface {
+	Replacer
+	ReplaceSecrets(s string, f escape.Format) (replaced string, secrets []string, err error)
+}
+
+//go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/consistent_replacer.go --fake-name ConsistentReplacer . ConsistentReplacer
+
+// A ConsistentReplacer is a Replacer whose replacements
+// can change over time, like dynamic secrets whose
+// leases are replaced. The Runner calls BeginRender
+// before it renders a command's inputs, and the function
+// that it returns afterwards; replacements made in
+// between are consistent with each other.
+type ConsistentReplacer interface {
+	Replacer
+	BeginRender() (end func())
+}
+
+//go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/releasing_replacer.go --fake-name ReleasingReplacer . ReleasingReplacer
+
+// A ReleasingReplacer is a Replacer whose replacements
+// hold resources which outlive the command that used
+// them, like the leases of dynamic secrets. Each time
+// that the Runner renders the inputs of a command which
+// it is about to start (when no earlier command is
+// running), it calls ReleaseUnused before the render
+// ends, so that replacements which the command won't
+// use can be released.
+type ReleasingReplacer interface {
+	Replacer
+	ReleaseUnused()
+}
+
 // A Runner runs commands with `os/exec.Cmd`s
 type Runner struct {
-	args          []string
-	in            io.Reader
-	name          string
-	originalEnv   []string
-	out           io.Writer
-	replacer      Replacer
+	args        []string
+	in          io.Reader
+	name        string
+	originalEnv Env
+	out         io.Writer
+	errOut      io.Writer
+	replacer    Replacer
+
+	// runningInputs are the inputs of the running
+	// command (guarded by inputlock)
+	inputlock     sync.Mutex
 	runningInputs commandInputs
 	started       bool
 
+	// maskPlaceholder, if set, replaces
+	// secrets in the command's output
+	maskPlaceholder string
+
+	// secretFiles, if set, delivers secrets
+	// from the environment in files
+	secretFiles bool
+
+	// tty, if set, runs the command
+	// in a pseudo-terminal
+	tty bool
+
+	forwardSignals  []os.Signal
+	stopSignal      os.Signal
+	stopGracePeriod time.Duration
+
+	// dir is a private directory holding unredacted
+	// copies of redacted files named in args
+	dir     string
+	dirlock sync.Mutex
+
 	reqlock        sync.Mutex
 	stopRequest    chan struct{}
 	restartRequest chan struct{}
+	signalRequest  chan os.Signal
 }
 
-// NewRunner creates a new Runner
+// NewRunner creates a new Runner. The command's
+// output is written to out, and its errors to errOut.
 func NewRunner(
 	in io.Reader,
 	out io.Writer,
+	errOut io.Writer,
 	env []string,
 	replacer Replacer,
 	name string,
@@ -47,9 +117,11 @@ func NewRunner(
 	return &Runner{
 		stopRequest:    make(chan struct{}, 100),
 		restartRequest: make(chan struct{}, 100),
+		signalRequest:  make(chan os.Signal, 100),
 		in:             in,
 		out:            out,
-		originalEnv:    env,
+		errOut:         errOut,
+		originalEnv:    ParseEnv(env),
 		replacer:       replacer,
 		name:           name,
 		args:           args,
@@ -57,97 +129,355 @@ func NewRunner(
 	}
 }
 
+// MaskOutput tells the Runner to replace the secrets
+// that it unredacted with placeholder, wherever they
+// appear in the command's output or errors. It must
+// be called before Run, and requires a SecretReplacer.
+func (r *Runner) MaskOutput(placeholder string) {
+	r.maskPlaceholder = placeholder
+}
+
+// SecretFiles tells the Runner to deliver secrets from
+// the environment in files, rather than in environment
+// variables (which can leak through /proc/<pid>/environ,
+// crash dumps and child processes). Each variable which
+// holds a redacted token, like FOO, is unredacted into a
+// read-only file in the Runner's private directory, and
+// the command gets FOO_FILE=<path> instead. The files are
+// rewritten atomically whenever the command's inputs are
+// rendered again (on Restart or Signal). It must be
+// called before Run.
+func (r *Runner) SecretFiles() {
+	r.secretFiles = true
+}
+
+// TTY tells the Runner to run the command in a
+// pseudo-terminal, so that interactive programs (like
+// psql) behave as they do in a terminal. If the Runner's
+// input is a terminal, it is put into raw mode while the
+// command runs, and its window size is passed on to the
+// command's terminal. The command's output and errors
+// are both written to out. It must be called before Run.
+//
+// Pseudo-terminals are supported on Linux and macOS.
+func (r *Runner) TTY() {
+	r.tty = true
+}
+
+// ForwardSignals tells the Runner to forward the given
+// signals to the command, when the current process
+// receives them. The command runs in its own process
+// group (unless its input is a terminal), and signals
+// are sent to the whole group. It must be called
+// before Run.
+func (r *Runner) ForwardSignals(sigs ...os.Signal) {
+	r.forwardSignals = sigs
+}
+
+// StopSignal sets the signal which the Runner sends
+// to ask the command to stop (on Stop or Restart),
+// and how long it waits for the command to exit
+// before killing it. By default, the Runner sends
+// SIGTERM, and waits DefaultStopGracePeriod.
+func (r *Runner) StopSignal(sig os.Signal, grace time.Duration) {
+	r.stopSignal = sig
+	r.stopGracePeriod = grace
+}
+
+// Run runs the command until it exits, or is stopped.
+//
+// If the command exits with a non-zero status, or is
+// killed by a signal (other than the Runner's stop
+// signal), Run returns an *ExitError. If it exits after
+// a termination signal was forwarded to it, the error's
+// Terminated field is set.
 func (r *Runner) Run() error {
-	runErrChan := make(chan error)
+	// remove unredacted files when the command exits
+	defer r.removeFiles()
+
+	stdout, stderr := r.out, r.errOut
+	var masks []*MaskingWriter
+	if r.maskPlaceholder != "" {
+		if _, ok := r.replacer.(SecretReplacer); !ok {
+			return fmt.Errorf("failed to mask output: the replacer does not report secrets")
+		}
+		stdout = NewMaskingWriter(r.out, r.maskPlaceholder)
+		stderr = NewMaskingWriter(r.errOut, r.maskPlaceholder)
+		masks = []*MaskingWriter{stdout.(*MaskingWriter), stderr.(*MaskingWriter)}
+	}
+
+	// forward signals to the command
+	var sigs chan os.Signal
+	if len(r.forwardSignals) > 0 {
+		sigs = make(chan os.Signal, 16)
+		signal.Notify(sigs, r.forwardSignals...)
+		defer signal.Stop(sigs)
+	}
+
+	// A command which reads from a terminal stays in our
+	// process group, so that it can read from the terminal.
+	// Otherwise (or if it has a pseudo-terminal, and so a
+	// session of its own), it gets a group of its own, so
+	// that signals reach any processes that it starts.
+	group := r.tty || !isTerminal(r.in)
+
+	// In a pseudo-terminal, every key (including ^C)
+	// is passed through to the command
+	if r.tty && isTerminal(r.in) {
+		restore, err := makeRaw(r.in.(*os.File))
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+
+	// Input which isn't a file is read by a single pump,
+	// so that it isn't lost when the command restarts. A
+	// file is passed to each command as it is.
+	var pump *stdinPump
+	if _, isFile := r.in.(*os.File); r.in != nil && (r.tty || !isFile) {
+		pump = newStdinPump(r.in)
+	}
+
 	for {
 		// render inputs. Note: the inputs may be
 		// dynamic, so this may change on each
 		// iteration of the loop
-		inputs, err := r.renderInputs()
+		inputs, err := r.renderInputs(true)
 		if err != nil {
 			return fmt.Errorf("failed to render command inputs: %v", err)
 		}
-		r.runningInputs = inputs
+		r.setRunningInputs(inputs)
 
-		// Create a new command
-		// Note: we create a context here so that
-		// we can cancel the command if asked.
-		ctx, cancel := context.WithCancel(context.Background())
-		cmd := exec.CommandContext(ctx, inputs.name, inputs.args...)
-		cmd.Env = inputs.env
-		cmd.Stdin = r.in
-		cmd.Stdout = r.out
+		// mask every secret that has been unredacted,
+		// including those from previous runs
+		for _, m := range masks {
+			m.AddSecrets(inputs.secretValues()...)
+		}
+
+		// write unredacted copies of redacted files
+		// named in args (re-rendered on each restart)
+		if err := r.writeFiles(inputs.files); err != nil {
+			return fmt.Errorf("failed to write redacted files: %v", err)
+		}
 
 		// Run the command
-		r.started = true
-		cancelled := false
-		go func() {
-			err := cmd.Run()
-
-			// Ignore "signal: killed" errors, which will
-			// fire when we cancel the command context.
-			//TODO(donald): find a cleaner way to determine the error type
-			if err != nil && !(cancelled && err.Error() == "signal: killed") {
-				runErrChan <- fmt.Errorf("error running command: %v", err)
-				return
+		p, runErrChan, err := r.start(inputs, stdout, stderr, group, pump, masks)
+		if err != nil {
+			return err
+		}
+
+		restart, err := r.wait(p, group, sigs, masks, runErrChan)
+		if err != nil || !restart {
+			return err
+		}
+	}
+}
+
+// start starts a command with the given inputs. The
+// command's result is sent on the returned channel once
+// it has exited, and all of its output has been written.
+func (r *Runner) start(inputs commandInputs, stdout, stderr io.Writer, group bool, pump *stdinPump, masks []*MaskingWriter) (*os.Process, chan error, error) {
+	cmd := exec.Command(inputs.name, inputs.args...)
+	cmd.Env = inputs.env.Strings()
+
+	var tty *os.File
+	var stdin io.Writer
+	eof := func() {}
+	if r.tty {
+		var slave *os.File
+		var err error
+		tty, slave, err = attachPTY(cmd)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to allocate a pseudo-terminal: %v", err)
+		}
+		defer slave.Close() // the command has its own copy
+
+		// ^D ends the input of a terminal
+		stdin = tty
+		eof = func() { tty.Write([]byte{4}) }
+	} else {
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		if group {
+			setProcessGroup(cmd)
+		}
+		if pump != nil {
+			pipe, err := cmd.StdinPipe()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to connect command input: %v", err)
 			}
-			runErrChan <- nil
+			stdin = pipe
+			eof = func() { pipe.Close() }
+		} else {
+			cmd.Stdin = r.in
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		if tty != nil {
+			tty.Close()
+		}
+		return nil, nil, fmt.Errorf("error running command: %v", err)
+	}
+
+	stopInput := func() {}
+	if pump != nil {
+		stopInput = pump.feed(stdin, eof)
+	}
+	stopResize := func() {}
+	if tty != nil && isTerminal(r.in) {
+		stopResize = propagateWindowSize(r.in.(*os.File), tty)
+	}
+
+	// copy the output of a pseudo-terminal
+	copied := make(chan struct{})
+	if tty != nil {
+		go func() {
+			io.Copy(stdout, tty) // fails once the terminal is closed
+			close(copied)
 		}()
+	} else {
+		close(copied)
+	}
+
+	runErrChan := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
 
+		if tty != nil {
+			// wait for the command's last output, unless
+			// another process holds its terminal open
+			select {
+			case <-copied:
+			case <-time.After(100 * time.Millisecond):
+			}
+			stopResize()
+			tty.Close()
+		}
+		stopInput()
+
+		// write any output held back by the masks
+		for _, m := range masks {
+			m.Flush()
+		}
+		runErrChan <- err
+	}()
+	return cmd.Process, runErrChan, nil
+}
+
+// wait waits for a running command to exit, forwarding
+// signals to it, and stopping it if asked. It returns
+// true if the command should be restarted.
+func (r *Runner) wait(p *os.Process, group bool, sigs chan os.Signal, masks []*MaskingWriter, runErrChan chan error) (bool, error) {
+	terminated := false // a termination signal was forwarded
+	for {
 		select {
 		case err := <-runErrChan:
 			// command finished on its own
-			cancel()
-			return err
-		case <-r.stopRequest:
-			cancelled = true
-			cancel()
-			// wait for the running command to exit
-			timeout := time.After(5 * time.Second)
-			select {
-			case <-timeout:
-				return fmt.Errorf("timed out waiting for command to cancel")
-			case err := <-runErrChan:
-				if err != nil {
-					return fmt.Errorf("error from cancelled command: %v", err)
+			if err != nil {
+				err = exitError(err)
+				if ee, ok := err.(*ExitError); ok {
+					ee.Terminated = terminated
 				}
+				return false, err
 			}
+			return false, nil
 
-			// close and rebuild request channels
-			r.reqlock.Lock()
-			close(r.stopRequest)
-			close(r.restartRequest)
-			r.stopRequest = make(chan struct{}, 100)
-			r.restartRequest = make(chan struct{}, 100)
-			r.reqlock.Unlock()
+		case sig := <-sigs:
+			if isTerminationSignal(sig) {
+				terminated = true
+			}
+			if !group && terminalSignals[sig] {
+				continue // the command has received it already
+			}
+			signalProcess(p, sig, group)
 
-			return nil
+		case sig := <-r.signalRequest:
+			if err := r.reload(p, group, sig, masks); err != nil {
+				return false, err
+			}
+
+		case <-r.stopRequest:
+			if err := r.stop(p, group, runErrChan); err != nil {
+				return false, err
+			}
+			r.resetRequests()
+			return false, nil
 
 		case <-r.restartRequest:
-			cancelled = true
-			cancel()
-			// wait for the running command to exit
-			timeout := time.After(5 * time.Second)
-			select {
-			case <-timeout:
-				return fmt.Errorf("timed out waiting for command to cancel")
-			case err := <-runErrChan:
-				if err != nil {
-					return fmt.Errorf("error from cancelled command: %v", err)
-				}
+			if err := r.stop(p, group, runErrChan); err != nil {
+				return false, err
 			}
+			r.resetRequests()
+			return true, nil
+		}
+	}
+}
 
-			// close and rebuild request channels
-			r.reqlock.Lock()
-			close(r.stopRequest)
-			close(r.restartRequest)
-			r.stopRequest = make(chan struct{}, 100)
-			r.restartRequest = make(chan struct{}, 100)
-			r.reqlock.Unlock()
+// stop asks a running command to stop with the stop
+// signal, and kills it if it is still running after
+// the grace period. The command's exit status is
+// ignored, since we asked it to exit.
+func (r *Runner) stop(p *os.Process, group bool, runErrChan chan error) error {
+	sig, grace := r.stopSignal, r.stopGracePeriod
+	if sig == nil {
+		sig, grace = defaultStopSignal, DefaultStopGracePeriod
+	}
 
-			continue
+	if err := signalProcess(p, sig, group); err == nil && sig != os.Kill {
+		select {
+		case <-runErrChan:
+			return nil
+		case <-time.After(grace):
 		}
 	}
+
+	signalProcess(p, os.Kill, group)
+	select {
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("timed out waiting for command to stop")
+	case <-runErrChan:
+		return nil
+	}
+}
+
+// reload re-renders the command's inputs, rewrites
+// its redacted files, and sends it sig, so that it
+// can reload them without restarting
+func (r *Runner) reload(p *os.Process, group bool, sig os.Signal, masks []*MaskingWriter) error {
+	inputs, err := r.renderInputs(false)
+	if err != nil {
+		return fmt.Errorf("failed to render command inputs: %v", err)
+	}
+	for _, m := range masks {
+		m.AddSecrets(inputs.secretValues()...)
+	}
+	if err := r.writeFiles(inputs.files); err != nil {
+		return fmt.Errorf("failed to write redacted files: %v", err)
+	}
+
+	// The command keeps its environment and args,
+	// but the new inputs are treated as running,
+	// so that a change is only signalled once
+	r.setRunningInputs(inputs)
+
+	// if the command has exited, wait will see it
+	signalProcess(p, sig, group)
+	return nil
+}
+
+// resetRequests closes and rebuilds
+// the request channels
+func (r *Runner) resetRequests() {
+	r.reqlock.Lock()
+	close(r.stopRequest)
+	close(r.restartRequest)
+	close(r.signalRequest)
+	r.stopRequest = make(chan struct{}, 100)
+	r.restartRequest = make(chan struct{}, 100)
+	r.signalRequest = make(chan os.Signal, 100)
+	r.reqlock.Unlock()
 }
 
 // HasConfigurationChanged returns true if the
@@ -158,74 +488,140 @@ func (r *Runner) Run() error {
 // If the command is not running,
 // HasConfigurationChanged returns false.
 func (r *Runner) HasConfigurationChanged() (bool, error) {
-	if !r.started {
-		return false, nil
+	c, err := r.ConfigurationChanges()
+	if err != nil {
+		return false, err
+	}
+	return c.HasChanged(), nil
+}
+
+// ConfigurationChanges describes how the configuration,
+// evaluated now, differs from the configuration that
+// was used to run the command (see HasConfigurationChanged).
+func (r *Runner) ConfigurationChanges() (Changes, error) {
+	r.inputlock.Lock()
+	running, started := r.runningInputs, r.started
+	r.inputlock.Unlock()
+
+	if !started {
+		return Changes{}, nil
 	}
-	newInputs, err := r.renderInputs()
+	newInputs, err := r.renderInputs(false)
 	if err != nil {
-		return false, fmt.Errorf("failed to render command inputs: %v", err)
+		return Changes{}, fmt.Errorf("failed to render command inputs: %v", err)
 	}
 
-	return r.runningInputs.differsFrom(newInputs), nil
+	return running.changesFrom(newInputs), nil
+}
+
+// setRunningInputs records the inputs
+// of the running command
+func (r *Runner) setRunningInputs(inputs commandInputs) {
+	r.inputlock.Lock()
+	r.runningInputs = inputs
+	r.started = true
+	r.inputlock.Unlock()
 }
 
 type commandInputs struct {
-	env  []string
-	args []string
-	name string
+	env   Env
+	args  []string
+	name  string
+	files []renderedFile
+
+	// secrets are the secrets that were unredacted
+	// to render the inputs (if the replacer can
+	// report them)
+	secrets []Secret
 }
 
-func (a commandInputs) differsFrom(b commandInputs) bool {
-	if a.name != b.name {
-		return true
-	}
-	if len(a.env) != len(b.env) {
-		return true
+// secretValues returns the values of the
+// secrets which were unredacted
+func (a commandInputs) secretValues() []string {
+	values := make([]string, len(a.secrets))
+	for i, s := range a.secrets {
+		values[i] = s.Value
 	}
-	for i, v := range a.env {
-		if b.env[i] != v {
-			return true
-		}
-	}
-	if len(a.args) != len(b.args) {
-		return true
+	return values
+}
+
+// renderInputs renders the command's inputs. If starting,
+// they are the inputs of a command which is about to start,
+// and a ReleasingReplacer may release the replacements
+// which they don't use.
+func (r *Runner) renderInputs(starting bool) (commandInputs, error) {
+	if cr, ok := r.replacer.(ConsistentReplacer); ok {
+		end := cr.BeginRender()
+		defer end()
 	}
-	for i, v := range a.args {
-		if b.args[i] != v {
-			return true
-		}
+	if rr, ok := r.replacer.(ReleasingReplacer); ok && starting {
+		// deferred, to run before the render ends
+		defer rr.ReleaseUnused()
 	}
-	return false
-}
 
-func (r *Runner) renderInputs() (commandInputs, error) {
+	var secrets []Secret
+
 	// replace all values in the environment
-	env, err := replaceStrings(r.originalEnv, r.replacer)
+	env, err := r.replaceEnv(r.originalEnv, &secrets)
 	if err != nil {
 		return commandInputs{}, fmt.Errorf("failed to replace values in the environment: %v", err)
 	}
 
+	// deliver the secrets in the environment
+	// in files, if requested
+	var files []renderedFile
+	if r.secretFiles {
+		env, files, err = r.renderSecretFiles(r.originalEnv, env)
+		if err != nil {
+			return commandInputs{}, fmt.Errorf("failed to render secret files: %v", err)
+		}
+	}
+
 	// Many commands will include uninterpolated
 	// variables, like `echo $FOO $BAR`.
 	// We should re-interpolate those variables
 	// with the newly-replaced environment
+	//
+	// A script run by a shell (like `sh -c 'echo "$FOO"'`)
+	// is expanded with each value escaped for the
+	// quotes around it.
 	args := make([]string, len(r.args))
 	copy(args, r.args)
-	m := envMap(env)
+	script := shellScriptIndex(r.name, args)
 	for i, arg := range args {
-		args[i] = os.Expand(arg, func(s string) string { return m[s] })
+		if i == script {
+			args[i], err = expandShellScript(arg, env)
+			if err != nil {
+				return commandInputs{}, fmt.Errorf("failed to expand shell script: %v", err)
+			}
+			continue
+		}
+		args[i] = os.Expand(arg, env.Lookup)
 	}
 
-	// TODO(donald): if the args contain a .redacted
-	// filename, like `cat myconfig.yaml.redacted`,
-	// we should attempt to create an in-memory file
-	// with replaced contents, and change the
-	// reference in the command to point to it
+	// Args which name a redacted file, like
+	// `cat @redacted:myconfig.yaml.redacted`,
+	// point instead to an unredacted copy of
+	// the file in a private directory
+	for i, arg := range args {
+		before, path, ok := redactedFileArg(arg)
+		if !ok {
+			continue
+		}
+		f, err := r.renderFile(i, path, &secrets)
+		if err != nil {
+			return commandInputs{}, fmt.Errorf("failed to render redacted file in arg %v: %v", i, err)
+		}
+		files = append(files, f)
+		args[i] = before + f.path
+	}
 
 	return commandInputs{
-		env:  env,
-		args: args,
-		name: r.name,
+		env:     env,
+		args:    args,
+		name:    r.name,
+		files:   files,
+		secrets: secrets,
 	}, nil
 }
 
@@ -239,31 +635,52 @@ func (r *Runner) Restart() {
 	r.restartRequest <- struct{}{}
 }
 
-// replaceStrings runs the Replacer
-// on all strings in an array (map fn)
-func replaceStrings(ss []string, r Replacer) ([]string, error) {
-	replaced := make([]string, len(ss))
-	for i, s := range ss {
-		rs, err := r.Replace(s)
+// Signal re-renders any redacted files named in the
+// command's args, and sends sig to the running command
+// (without restarting it), so that it can reload them.
+// The command's environment is not changed.
+func (r *Runner) Signal(sig os.Signal) {
+	r.signalRequest <- sig
+}
+
+// replaceEnv runs the Replacer on the
+// value of each variable in env
+func (r *Runner) replaceEnv(env Env, secrets *[]Secret) (Env, error) {
+	replaced := make(Env, len(env))
+	for i, v := range env {
+		value, err := r.replace(v.Value, escape.Raw, secrets)
 		if err != nil {
-			return nil, fmt.Errorf(`failed to replace string %v ("%s"): %v`, i, s, err)
+			return nil, fmt.Errorf(`failed to replace the value of %v (variable %v): %v`, v.Name, i, err)
 		}
-		replaced[i] = rs
+		replaced[i] = Var{Name: v.Name, Value: value}
 	}
 	return replaced, nil
 }
 
-// envMap breaks an environment array, an array
-// of strings like ["FOO=bar", "BAZ=bop"])
-// into a map like {"FOO": "bar", "BAZ": "bop"}
-func envMap(env []string) map[string]string {
-	m := make(map[string]string)
-	for _, s := range env {
-		ss := strings.Split(s, "=")
-		if len(ss) != 2 {
-			continue
+// replace runs the Replacer on s, escaping replacements
+// for the format f (if the Replacer can), and adding any
+// secrets which the Replacer reports to secrets
+func (r *Runner) replace(s string, f escape.Format, secrets *[]Secret) (string, error) {
+	switch rep := r.replacer.(type) {
+	case SourceReplacer:
+		replaced, ss, err := rep.ReplaceSources(s, f)
+		if err != nil {
+			return "", err
+		}
+		*secrets = append(*secrets, ss...)
+		return replaced, nil
+	case SecretReplacer:
+		replaced, ss, err := rep.ReplaceSecrets(s, f)
+		if err != nil {
+			return "", err
+		}
+		for _, v := range ss {
+			*secrets = append(*secrets, Secret{Value: v})
 		}
-		m[ss[0]] = ss[1]
+		return replaced, nil
+	case FormatReplacer:
+		return rep.ReplaceFormat(s, f)
+	default:
+		return rep.Replace(s)
 	}
-	return m
 }
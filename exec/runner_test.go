@@ -0,0 +1,232 @@
+package exec_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dhoelle/redactr/escape"
+	"github.com/dhoelle/redactr/exec"
+	"github.com/dhoelle/redactr/exec/fakes"
+)
+
+func TestRunner_ShellScripts(t *testing.T) {
+	secret := `it's "quoted" with \ and $HOME and ` + "`id`\nand a line break"
+	replacer := &fakes.Replacer{}
+	replacer.ReplaceStub = func(s string) (string, error) {
+		return strings.Replace(s, "~~redacted~~", secret, -1), nil
+	}
+
+	scripts := map[string]string{
+		"unquoted":        `printf %s $PASSWORD`,
+		"double-quoted":   `printf %s "$PASSWORD"`,
+		"single-quoted":   `printf %s '$PASSWORD'`,
+		"braced":          `printf %s "${PASSWORD}"`,
+		"with other args": `printf '%s %s' "$PASSWORD" "$1"`,
+	}
+	for name, script := range scripts {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			runner := exec.NewRunner(
+				strings.NewReader(""),
+				&out,
+				os.Stderr,
+				[]string{"PASSWORD=~~redacted~~"},
+				replacer,
+				"sh",
+				"-e", "-c", script, "sh", "arg1")
+			if err := runner.Run(); err != nil {
+				t.Fatalf("Run() got err: %v", err)
+			}
+
+			want := secret
+			if name == "with other args" {
+				want += " arg1"
+			}
+			if got := out.String(); got != want {
+				t.Errorf("Run()\n\twant %q\n\t got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestRunner_RedactedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json.redacted")
+	if err := ioutil.WriteFile(path, []byte(`{"password": "~~redacted~~"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	replacer := &fakes.FormatReplacer{}
+	replacer.ReplaceStub = func(s string) (string, error) { return s, nil }
+	replacer.ReplaceFormatStub = func(s string, f escape.Format) (string, error) {
+		if f != escape.JSON {
+			t.Errorf("ReplaceFormat(): want format %v, got %v", escape.JSON, f)
+		}
+		return strings.Replace(s, "~~redacted~~", `hunter\"2`, -1), nil
+	}
+
+	for _, arg := range []string{"@redacted:" + path, "--config=@redacted:" + path} {
+		t.Run(arg, func(t *testing.T) {
+			var out bytes.Buffer
+			runner := exec.NewRunner(
+				strings.NewReader(""),
+				&out,
+				os.Stderr,
+				nil,
+				replacer,
+				"sh",
+				"-c", `f="${1#--config=}"; ls -l "$f" | cut -c1-10; cat "$f"; echo; echo "$1"`, "sh", arg)
+			if err := runner.Run(); err != nil {
+				t.Fatalf("Run() got err: %v", err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != 3 {
+				t.Fatalf("Run(): unexpected output %q", out.String())
+			}
+			if want := "-rw-------"; lines[0] != want {
+				t.Errorf("Run(): want file mode %v, got %v", want, lines[0])
+			}
+			if want := `{"password": "hunter\"2"}`; lines[1] != want {
+				t.Errorf("Run(): want file contents %v, got %v", want, lines[1])
+			}
+			rendered := strings.TrimPrefix(lines[2], "--config=")
+			if filepath.Base(rendered) != "config.json" {
+				t.Errorf("Run(): want a file named config.json, got %v", lines[2])
+			}
+			if _, err := os.Stat(rendered); !os.IsNotExist(err) {
+				t.Errorf("Run(): expected %v to be removed, got err: %v", rendered, err)
+			}
+		})
+	}
+}
+
+func TestRunner_MaskOutput(t *testing.T) {
+	replacer := &fakes.SecretReplacer{}
+	replacer.ReplaceSecretsStub = func(s string, f escape.Format) (string, []string, error) {
+		if !strings.Contains(s, "~~redacted~~") {
+			return s, nil, nil
+		}
+		return strings.Replace(s, "~~redacted~~", "hunter2", -1), []string{"hunter2"}, nil
+	}
+
+	var out, errOut bytes.Buffer
+	runner := exec.NewRunner(
+		strings.NewReader(""),
+		&out,
+		&errOut,
+		[]string{"PASSWORD=~~redacted~~"},
+		replacer,
+		"sh",
+		"-c", `printf 'password: %s\n' "$PASSWORD"; printf '%s' "$PASSWORD" | fold -w 3 >&2`)
+	runner.MaskOutput("****")
+	if err := runner.Run(); err != nil {
+		t.Fatalf("Run() got err: %v", err)
+	}
+
+	if want := "password: ****\n"; out.String() != want {
+		t.Errorf("Run(): want output %q, got %q", want, out.String())
+	}
+	if strings.Contains(errOut.String(), "hunter2") {
+		t.Errorf("Run(): expected errors to be masked, got %q", errOut.String())
+	}
+
+	t.Run("it should fail if the replacer can't report secrets", func(t *testing.T) {
+		runner := exec.NewRunner(nil, &out, &errOut, nil, &fakes.Replacer{}, "true")
+		runner.MaskOutput("****")
+		if err := runner.Run(); err == nil {
+			t.Errorf("Run(): expected an error")
+		}
+	})
+}
+
+func TestRunner_SecretFiles(t *testing.T) {
+	replacer := &fakes.Replacer{}
+	replacer.ReplaceStub = func(s string) (string, error) {
+		return strings.Replace(s, "~~redacted~~", "hunter2", -1), nil
+	}
+
+	var out bytes.Buffer
+	runner := exec.NewRunner(
+		strings.NewReader(""),
+		&out,
+		os.Stderr,
+		[]string{"PASSWORD=~~redacted~~", "PLAIN=plain"},
+		replacer,
+		"sh",
+		"-c", `echo "[$PASSWORD] $PLAIN $1"; cat "$PASSWORD_FILE"; echo; ls -l "$PASSWORD_FILE" | cut -c1-10; echo "$PASSWORD_FILE"`,
+		"sh", "$PASSWORD")
+	runner.SecretFiles()
+	if err := runner.Run(); err != nil {
+		t.Fatalf("Run() got err: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Run(): want 4 lines of output, got %q", out.String())
+	}
+	if want := "[] plain "; lines[0] != want {
+		t.Errorf("Run(): want the secret out of the environment and args (%q), got %q", want, lines[0])
+	}
+	if want := "hunter2"; lines[1] != want {
+		t.Errorf("Run(): want file contents %q, got %q", want, lines[1])
+	}
+	if want := "-r--------"; lines[2] != want {
+		t.Errorf("Run(): want file mode %v, got %v", want, lines[2])
+	}
+	if filepath.Base(lines[3]) != "PASSWORD" {
+		t.Errorf("Run(): want a file named PASSWORD, got %v", lines[3])
+	}
+	if _, err := os.Stat(lines[3]); !os.IsNotExist(err) {
+		t.Errorf("Run(): expected %v to be removed, got err: %v", lines[3], err)
+	}
+}
+
+func TestRunner_ConsistentReplacer(t *testing.T) {
+	var rendering, outside, ended int
+	replacer := &fakes.ConsistentReplacer{}
+	replacer.BeginRenderStub = func() func() {
+		rendering++
+		return func() {
+			rendering--
+			ended++
+		}
+	}
+	replacer.ReplaceStub = func(s string) (string, error) {
+		if rendering != 1 {
+			outside++
+		}
+		return strings.Replace(s, "~~redacted~~", "hunter2", -1), nil
+	}
+
+	var out bytes.Buffer
+	runner := exec.NewRunner(
+		strings.NewReader(""),
+		&out,
+		os.Stderr,
+		[]string{"USERNAME=~~redacted~~", "PASSWORD=~~redacted~~"},
+		replacer,
+		"sh",
+		"-c", `printf '%s %s' "$USERNAME" "$PASSWORD"`)
+	if err := runner.Run(); err != nil {
+		t.Fatalf("Run() got err: %v", err)
+	}
+	if want := "hunter2 hunter2"; out.String() != want {
+		t.Errorf("Run() output want %q, got %q", want, out.String())
+	}
+	if n := replacer.BeginRenderCallCount(); n != 1 || ended != 1 {
+		t.Errorf("want 1 render to begin and end, got %v begun and %v ended", n, ended)
+	}
+	if outside > 0 {
+		t.Errorf("want every replacement within a render, got %v outside", outside)
+	}
+}
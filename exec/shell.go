@@ -0,0 +1,91 @@
+package exec
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dhoelle/redactr/escape"
+)
+
+// shells are the names of shells which run
+// a script given with -c, like `sh -c 'echo $FOO'`
+var shells = map[string]bool{
+	"sh":   true,
+	"ash":  true,
+	"bash": true,
+	"dash": true,
+	"ksh":  true,
+	"zsh":  true,
+}
+
+// shellScriptIndex returns the index, in args, of the
+// script which a shell will run (like `echo $FOO` in
+// `bash -e -c 'echo $FOO'`), or -1 if there is none
+func shellScriptIndex(name string, args []string) int {
+	if !shells[strings.TrimSuffix(filepath.Base(name), ".exe")] {
+		return -1
+	}
+
+	sawC := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			continue
+		case arg == "-o" || arg == "+o":
+			i++ // skip the option's argument, like -o pipefail
+		case len(arg) > 1 && (arg[0] == '-' || arg[0] == '+') && arg[1] != '-':
+			if strings.ContainsRune(arg[1:], 'c') {
+				sawC = true
+			}
+		case strings.HasPrefix(arg, "--"):
+		default:
+			if sawC {
+				return i
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+// shellVarRE matches variables in a shell script,
+// like $FOO or ${FOO}
+var shellVarRE = regexp.MustCompile(`\$(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// expandShellScript expands the variables in a shell script,
+// like os.Expand, but escapes each value for the quotes
+// around it, so that values with quotes or other special
+// characters don't break the script. Variables which are
+// not in the environment are left for the shell.
+func expandShellScript(script string, env Env) (string, error) {
+	sc := escape.NewScanner(escape.Shell)
+
+	var b strings.Builder
+	prev := 0
+	for _, m := range shellVarRE.FindAllStringSubmatchIndex(script, -1) {
+		name := ""
+		if m[2] >= 0 {
+			name = script[m[2]:m[3]]
+		} else {
+			name = script[m[4]:m[5]]
+		}
+		value, ok := env.Get(name)
+		if !ok {
+			continue
+		}
+
+		sc.Scan(script[prev:m[0]])
+		escaped, err := sc.Escape(value, escape.RestOfLine(script, m[1]))
+		if err != nil {
+			return "", fmt.Errorf("failed to escape $%v: %v", name, err)
+		}
+		b.WriteString(script[prev:m[0]])
+		b.WriteString(escaped)
+		prev = m[1]
+	}
+	b.WriteString(script[prev:])
+	return b.String(), nil
+}
@@ -0,0 +1,119 @@
+package exec
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultStopGracePeriod is how long a Runner waits
+// for a command to exit after sending it the stop
+// signal, before killing it
+const DefaultStopGracePeriod = 10 * time.Second
+
+// An ExitError reports that a command exited
+// with a non-zero status, or was killed by a
+// signal
+type ExitError struct {
+	// Code is the command's exit status, or 128
+	// plus the signal which killed the command
+	// (like a shell's $?)
+	Code int
+
+	// Signal is the signal which killed
+	// the command, if any
+	Signal os.Signal
+
+	// Terminated is set if the command exited after a
+	// termination signal (see TerminationSignals) was
+	// forwarded to it, so it should not be restarted
+	Terminated bool
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != nil {
+		return fmt.Sprintf("command was killed by signal: %v", e.Signal)
+	}
+	return fmt.Sprintf("command exited with status %v", e.Code)
+}
+
+// ExitCode returns the exit code
+// which best describes the error
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// exitError converts an error from running a
+// command to an ExitError, where it can
+func exitError(err error) error {
+	ee, ok := err.(*exec.ExitError)
+	if !ok {
+		return fmt.Errorf("error running command: %v", err)
+	}
+	ws, ok := ee.Sys().(syscall.WaitStatus)
+	if !ok {
+		return &ExitError{Code: ee.ExitCode()}
+	}
+	if ws.Signaled() {
+		return &ExitError{Code: 128 + int(ws.Signal()), Signal: ws.Signal()}
+	}
+	return &ExitError{Code: ws.ExitStatus()}
+}
+
+// isTerminationSignal reports whether
+// sig is one of the TerminationSignals
+func isTerminationSignal(sig os.Signal) bool {
+	for _, s := range TerminationSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSignal parses the name of a signal, like
+// "TERM", "SIGTERM" or "15"
+func ParseSignal(s string) (os.Signal, error) {
+	name := strings.TrimPrefix(strings.ToUpper(s), "SIG")
+	if sig, ok := signalNames[name]; ok {
+		return sig, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		for _, sig := range signalNames {
+			if int(sig) == n {
+				return sig, nil
+			}
+		}
+	}
+
+	var names []string
+	for name := range signalNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown signal %q (choices: %v)", s, names)
+}
+
+// isTerminal returns true if r is a terminal
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	// /dev/null is a character device, but not a terminal
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, null) {
+		return false
+	}
+	return true
+}
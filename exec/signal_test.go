@@ -0,0 +1,405 @@
+//go:build !windows
+// +build !windows
+
+package exec_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dhoelle/redactr/escape"
+	"github.com/dhoelle/redactr/exec"
+	"github.com/dhoelle/redactr/exec/fakes"
+)
+
+// startScript runs a shell script with a Runner, and
+// returns a channel of the lines that it writes
+func startScript(t *testing.T, configure func(*exec.Runner), script string, args ...string) (*exec.Runner, <-chan string, <-chan error) {
+	return startScriptWith(t, identityReplacer(), configure, script, args...)
+}
+
+// startScriptWith runs a shell script, like startScript,
+// with the given Replacer
+func startScriptWith(t *testing.T, replacer exec.Replacer, configure func(*exec.Runner), script string, args ...string) (*exec.Runner, <-chan string, <-chan error) {
+	pr, pw := io.Pipe()
+	args = append([]string{"-c", script, "sh"}, args...)
+	runner := exec.NewRunner(strings.NewReader(""), pw, os.Stderr, nil, replacer, "sh", args...)
+	configure(runner)
+
+	lines := make(chan string, 100)
+	go func() {
+		s := bufio.NewScanner(pr)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+		close(lines)
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		err := runner.Run()
+		pw.Close()
+		errs <- err
+	}()
+	return runner, lines, errs
+}
+
+// identityReplacer replaces nothing
+func identityReplacer() *fakes.Replacer {
+	replacer := &fakes.Replacer{}
+	replacer.ReplaceStub = func(s string) (string, error) { return s, nil }
+	return replacer
+}
+
+// expectLine waits for a line from a script
+func expectLine(t *testing.T, lines <-chan string, want string) {
+	select {
+	case got := <-lines:
+		if got != want {
+			t.Fatalf("want line %q, got %q", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for line %q", want)
+	}
+}
+
+// expectRunErr waits for Run to return
+func expectRunErr(t *testing.T, errs <-chan error) error {
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for Run() to return")
+		return nil
+	}
+}
+
+func TestRunner_ExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		wantCode int
+		wantSig  os.Signal
+	}{
+		{
+			name:     "it should return the command's exit status",
+			script:   "exit 3",
+			wantCode: 3,
+		},
+		{
+			name:     "it should return 128+signal if the command is killed",
+			script:   "kill -TERM $$",
+			wantCode: 128 + int(syscall.SIGTERM),
+			wantSig:  syscall.SIGTERM,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, errs := startScript(t, func(*exec.Runner) {}, tt.script)
+			err := expectRunErr(t, errs)
+			ee, ok := err.(*exec.ExitError)
+			if !ok {
+				t.Fatalf("Run(): want an *exec.ExitError, got %T: %v", err, err)
+			}
+			if ee.ExitCode() != tt.wantCode {
+				t.Errorf("Run(): want exit code %v, got %v", tt.wantCode, ee.ExitCode())
+			}
+			if ee.Signal != tt.wantSig {
+				t.Errorf("Run(): want signal %v, got %v", tt.wantSig, ee.Signal)
+			}
+		})
+	}
+}
+
+func TestRunner_Stop(t *testing.T) {
+	t.Run("it should send the stop signal", func(t *testing.T) {
+		runner, lines, errs := startScript(t,
+			func(r *exec.Runner) { r.StopSignal(syscall.SIGUSR2, time.Minute) },
+			`trap 'echo stopping; exit 0' USR2; echo ready; while :; do sleep 0.01; done`)
+		expectLine(t, lines, "ready")
+		runner.Stop()
+		expectLine(t, lines, "stopping")
+		if err := expectRunErr(t, errs); err != nil {
+			t.Errorf("Run() got err: %v", err)
+		}
+	})
+
+	t.Run("it should kill the command after the grace period", func(t *testing.T) {
+		runner, lines, errs := startScript(t,
+			func(r *exec.Runner) { r.StopSignal(syscall.SIGTERM, 100*time.Millisecond) },
+			`trap '' TERM; echo ready; sleep 60`)
+		expectLine(t, lines, "ready")
+		runner.Stop()
+		if err := expectRunErr(t, errs); err != nil {
+			t.Errorf("Run() got err: %v", err)
+		}
+	})
+}
+
+func TestRunner_ForwardSignals(t *testing.T) {
+	_, lines, errs := startScript(t,
+		func(r *exec.Runner) { r.ForwardSignals(syscall.SIGUSR1) },
+		`trap 'echo got USR1; exit 7' USR1; echo ready; while :; do sleep 0.01; done`)
+	expectLine(t, lines, "ready")
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	expectLine(t, lines, "got USR1")
+
+	err := expectRunErr(t, errs)
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != 7 {
+		t.Errorf("Run(): want exit code 7, got %v", err)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for _, s := range []string{"TERM", "SIGTERM", "term", "15"} {
+		sig, err := exec.ParseSignal(s)
+		if err != nil {
+			t.Errorf("ParseSignal(%q) got err: %v", s, err)
+			continue
+		}
+		if sig != syscall.SIGTERM {
+			t.Errorf("ParseSignal(%q): want %v, got %v", s, syscall.SIGTERM, sig)
+		}
+	}
+	if _, err := exec.ParseSignal("NOPE"); err == nil {
+		t.Errorf(`ParseSignal("NOPE"): expected an error`)
+	}
+}
+
+func TestRunner_Signal(t *testing.T) {
+	f, err := ioutil.TempFile("", "runner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("password: ~~redacted~~")
+	f.Close()
+
+	// each render unredacts a new secret
+	var renders int32
+	replacer := &fakes.Replacer{}
+	replacer.ReplaceStub = func(s string) (string, error) {
+		n := atomic.AddInt32(&renders, 1)
+		return strings.Replace(s, "~~redacted~~", fmt.Sprintf("secret-%v", n), -1), nil
+	}
+
+	runner, lines, errs := startScriptWith(t, replacer,
+		func(*exec.Runner) {},
+		`trap 'cat "$1"; echo' HUP; echo ready; cat "$1"; echo; while :; do sleep 0.01; done`,
+		"@redacted:"+f.Name())
+	expectLine(t, lines, "ready")
+	expectLine(t, lines, "password: secret-1")
+
+	runner.Signal(syscall.SIGHUP)
+	expectLine(t, lines, "password: secret-2")
+
+	changed, err := runner.HasConfigurationChanged()
+	if err != nil {
+		t.Fatalf("HasConfigurationChanged() got err: %v", err)
+	}
+	if !changed {
+		t.Errorf("HasConfigurationChanged(): expected a changed configuration")
+	}
+
+	runner.Stop()
+	if err := expectRunErr(t, errs); err != nil {
+		t.Errorf("Run() got err: %v", err)
+	}
+}
+
+func TestRunner_ReleasingReplacer(t *testing.T) {
+	replacer := &fakes.ReleasingReplacer{}
+	replacer.ReplaceStub = func(s string) (string, error) { return s, nil }
+
+	runner, lines, errs := startScriptWith(t, replacer,
+		func(*exec.Runner) {},
+		`trap 'echo reloaded' HUP; echo ready; while :; do sleep 0.01; done`)
+	expectLine(t, lines, "ready")
+	if n := replacer.ReleaseUnusedCallCount(); n != 1 {
+		t.Errorf("want ReleaseUnused to be called when the command starts, got %v calls", n)
+	}
+
+	// the running command may use its replacements
+	if _, err := runner.HasConfigurationChanged(); err != nil {
+		t.Fatalf("HasConfigurationChanged() got err: %v", err)
+	}
+	runner.Signal(syscall.SIGHUP)
+	expectLine(t, lines, "reloaded")
+	if n := replacer.ReleaseUnusedCallCount(); n != 1 {
+		t.Errorf("want no release while the command runs, got %v calls", n)
+	}
+
+	runner.Restart()
+	expectLine(t, lines, "ready")
+	if n := replacer.ReleaseUnusedCallCount(); n != 2 {
+		t.Errorf("want ReleaseUnused to be called when the command restarts, got %v calls", n)
+	}
+
+	runner.Stop()
+	if err := expectRunErr(t, errs); err != nil {
+		t.Errorf("Run() got err: %v", err)
+	}
+}
+
+func TestRunner_ConfigurationChanges(t *testing.T) {
+	f, err := ioutil.TempFile("", "runner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("token: ~~vault:token~~")
+	f.Close()
+
+	// secrets, by source, which change during the test
+	var lock sync.Mutex
+	secrets := map[string]string{"vault:db": "hunter2", "vault:token": "t0", "vault:other": "o0"}
+	replacer := &fakes.SourceReplacer{}
+	replacer.ReplaceSourcesStub = func(s string, f escape.Format) (string, []exec.Secret, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		var found []exec.Secret
+		for source, value := range secrets {
+			token := "~~" + source + "~~"
+			if strings.Contains(s, token) {
+				s = strings.Replace(s, token, value, -1)
+				found = append(found, exec.Secret{Source: source, Value: value})
+			}
+		}
+		return s, found, nil
+	}
+	change := func(source, value string) {
+		lock.Lock()
+		secrets[source] = value
+		lock.Unlock()
+	}
+
+	pr, pw := io.Pipe()
+	runner := exec.NewRunner(
+		strings.NewReader(""),
+		pw,
+		os.Stderr,
+		[]string{"DB_PASSWORD=~~vault:db~~", "OTHER=~~vault:other~~", "PLAIN=plain"},
+		replacer,
+		"sh",
+		"-c", `echo ready; while :; do sleep 0.01; done`, "sh", "$OTHER", "@redacted:"+f.Name())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- runner.Run()
+		pw.Close()
+	}()
+	lines := make(chan string, 10)
+	go func() {
+		s := bufio.NewScanner(pr)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+	expectLine(t, lines, "ready")
+
+	changes, err := runner.ConfigurationChanges()
+	if err != nil {
+		t.Fatalf("ConfigurationChanges() got err: %v", err)
+	}
+	if changes.HasChanged() {
+		t.Errorf("ConfigurationChanges(): expected no changes, got %v", changes)
+	}
+
+	change("vault:db", "swordfish")
+	change("vault:token", "t1")
+	changes, err = runner.ConfigurationChanges()
+	if err != nil {
+		t.Fatalf("ConfigurationChanges() got err: %v", err)
+	}
+	want := exec.Changes{
+		Env:     []string{"DB_PASSWORD"},
+		Args:    []int{4},
+		Sources: []string{"vault:db", "vault:token"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("ConfigurationChanges()\n\twant %#v\n\t got %#v", want, changes)
+	}
+	if s := changes.String(); strings.Contains(s, "swordfish") || strings.Contains(s, "t1") {
+		t.Errorf("Changes.String(): expected no secrets, got %q", s)
+	}
+
+	change("vault:other", "o1")
+	changes, err = runner.ConfigurationChanges()
+	if err != nil {
+		t.Fatalf("ConfigurationChanges() got err: %v", err)
+	}
+	if want := "env DB_PASSWORD, OTHER; args 3, 4; secrets vault:db, vault:other, vault:token"; changes.String() != want {
+		t.Errorf("Changes.String()\n\twant %v\n\t got %v", want, changes.String())
+	}
+
+	runner.Stop()
+	if err := expectRunErr(t, errs); err != nil {
+		t.Errorf("Run() got err: %v", err)
+	}
+}
+
+func TestRunner_SecretFilesRefresh(t *testing.T) {
+	// each render unredacts a new secret
+	var renders int32
+	replacer := &fakes.Replacer{}
+	replacer.ReplaceStub = func(s string) (string, error) {
+		if !strings.Contains(s, "~~redacted~~") {
+			return s, nil
+		}
+		n := atomic.AddInt32(&renders, 1)
+		return strings.Replace(s, "~~redacted~~", fmt.Sprintf("secret-%v", n), -1), nil
+	}
+
+	pr, pw := io.Pipe()
+	runner := exec.NewRunner(
+		strings.NewReader(""),
+		pw,
+		os.Stderr,
+		[]string{"PASSWORD=~~redacted~~"},
+		replacer,
+		"sh",
+		"-c", `trap 'cat "$PASSWORD_FILE"; echo' HUP; cat "$PASSWORD_FILE"; echo; while :; do sleep 0.01; done`)
+	runner.SecretFiles()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- runner.Run()
+		pw.Close()
+	}()
+	lines := make(chan string, 10)
+	go func() {
+		s := bufio.NewScanner(pr)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+	expectLine(t, lines, "secret-1")
+
+	// the file changes, but the environment does not
+	changes, err := runner.ConfigurationChanges()
+	if err != nil {
+		t.Fatalf("ConfigurationChanges() got err: %v", err)
+	}
+	if want := []string{"PASSWORD"}; !reflect.DeepEqual(changes.Env, want) {
+		t.Errorf("ConfigurationChanges(): want changed env %v, got %v", want, changes.Env)
+	}
+
+	runner.Signal(syscall.SIGHUP)
+	expectLine(t, lines, "secret-3")
+
+	runner.Stop()
+	if err := expectRunErr(t, errs); err != nil {
+		t.Errorf("Run() got err: %v", err)
+	}
+}
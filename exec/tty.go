@@ -0,0 +1,62 @@
+package exec
+
+import (
+	"io"
+)
+
+// A stdinPump copies a Runner's input to each command
+// that it runs, in turn. It reads the input for as long
+// as the Runner runs, so that input which arrives while
+// a command is restarted is kept for the next command,
+// rather than swallowed by the last one.
+type stdinPump struct {
+	chunks chan []byte
+}
+
+// newStdinPump starts reading in
+func newStdinPump(in io.Reader) *stdinPump {
+	p := &stdinPump{chunks: make(chan []byte)}
+	go func() {
+		for {
+			buf := make([]byte, 32*1024)
+			n, err := in.Read(buf)
+			if n > 0 {
+				p.chunks <- buf[:n]
+			}
+			if err != nil {
+				close(p.chunks)
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// feed writes the input to w until stop is called. If
+// the input runs out, feed calls eof. Input which is
+// being written to w when it fails is lost.
+func (p *stdinPump) feed(w io.Writer, eof func()) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case b, ok := <-p.chunks:
+				if !ok {
+					eof()
+					return
+				}
+				if _, err := w.Write(b); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
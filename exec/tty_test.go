@@ -0,0 +1,80 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package exec_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dhoelle/redactr/exec"
+)
+
+func TestRunner_TTY(t *testing.T) {
+	var out bytes.Buffer
+	runner := exec.NewRunner(
+		strings.NewReader("hello\n"),
+		&out,
+		os.Stderr,
+		nil,
+		identityReplacer(),
+		"sh",
+		"-c", `test -t 0 && test -t 1 && test -t 2 && echo "is a tty"; read line; echo "got $line"; echo "an error" >&2`)
+	runner.TTY()
+	if err := runner.Run(); err != nil {
+		t.Fatalf("Run() got err: %v", err)
+	}
+
+	got := strings.Replace(out.String(), "\r\n", "\n", -1)
+	for _, want := range []string{"is a tty\n", "got hello\n", "an error\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Run(): want output with %q, got %q", want, got)
+		}
+	}
+}
+
+func TestRunner_InputSurvivesRestarts(t *testing.T) {
+	pr, pw := io.Pipe()
+	outR, outW := io.Pipe()
+	runner := exec.NewRunner(
+		pr,
+		outW,
+		os.Stderr,
+		nil,
+		identityReplacer(),
+		"sh",
+		"-c", `echo ready; read line; echo "got $line"; while :; do sleep 0.01; done`)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- runner.Run()
+		outW.Close()
+	}()
+	lines := make(chan string, 10)
+	go func() {
+		s := bufio.NewScanner(outR)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+
+	expectLine(t, lines, "ready")
+	pw.Write([]byte("first\n"))
+	expectLine(t, lines, "got first")
+
+	// the last command must not swallow
+	// input meant for the next one
+	runner.Restart()
+	expectLine(t, lines, "ready")
+	pw.Write([]byte("second\n"))
+	expectLine(t, lines, "got second")
+
+	runner.Stop()
+	if err := expectRunErr(t, errs); err != nil {
+		t.Errorf("Run() got err: %v", err)
+	}
+	pw.Close()
+}
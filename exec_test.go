@@ -1,13 +1,26 @@
 package redactr_test
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/dhoelle/redactr"
+	"github.com/dhoelle/redactr/exec"
+	execfakes "github.com/dhoelle/redactr/exec/fakes"
 	"github.com/dhoelle/redactr/fakes"
+	"github.com/dhoelle/redactr/watch"
 )
 
 func Test_Exec(t *testing.T) {
@@ -102,4 +115,467 @@ func Test_Exec(t *testing.T) {
 			return
 		}
 	})
+	t.Run("when called with the SignalIfEnvChanges option, it should signal the command when the running configuration has changed", func(t *testing.T) {
+		runner := &fakes.Runner{}
+
+		signalled := make(chan os.Signal)
+		runner.RunStub = func() error {
+			timeout := time.After(1 * time.Second)
+			select {
+			case <-timeout:
+				return fmt.Errorf("timeout")
+			case sig := <-signalled:
+				if sig != syscall.SIGHUP {
+					return fmt.Errorf("expected SIGHUP, got %v", sig)
+				}
+				return nil
+			}
+		}
+		runner.SignalStub = func(sig os.Signal) {
+			signalled <- sig
+		}
+		runner.HasConfigurationChangedReturns(true, nil)
+
+		err := redactr.Exec(runner, redactr.SignalIfEnvChanges(100*time.Millisecond, syscall.SIGHUP))
+		if err != nil {
+			t.Errorf("Exec() got err: %v", err)
+			return
+		}
+		if runner.RestartCallCount() != 0 || runner.StopCallCount() != 0 {
+			t.Errorf("Exec() expected the command not to be restarted or stopped")
+			return
+		}
+	})
+	t.Run("when called with the WatchChanges option, it should re-evaluate the environment when a watcher reports a change", func(t *testing.T) {
+		runner := &fakes.Runner{}
+
+		restarted := make(chan struct{})
+		runner.RunStub = func() error {
+			select {
+			case <-time.After(1 * time.Second):
+				return fmt.Errorf("timeout")
+			case <-restarted:
+				return nil
+			}
+		}
+		runner.RestartStub = func() {
+			restarted <- struct{}{}
+		}
+		runner.HasConfigurationChangedReturns(true, nil)
+
+		changeOnce := watch.Func(func(ctx context.Context, changed func()) error {
+			time.Sleep(10 * time.Millisecond)
+			changed()
+			<-ctx.Done()
+			return nil
+		})
+
+		// re-evaluate only on changes, never on a timer
+		err := redactr.Exec(runner, redactr.RestartIfEnvChanges(time.Hour), redactr.WatchChanges(0, changeOnce))
+		if err != nil {
+			t.Errorf("Exec() got err: %v", err)
+			return
+		}
+		if runner.HasConfigurationChangedCallCount() != 1 {
+			t.Errorf("Exec() expected HasConfigurationChanged() to be called one time, got %v", runner.HasConfigurationChangedCallCount())
+			return
+		}
+	})
+
+	t.Run("if a watcher fails, it should return an error", func(t *testing.T) {
+		runner := &fakes.Runner{}
+		runner.RunStub = func() error {
+			time.Sleep(1 * time.Second)
+			return nil
+		}
+		failing := watch.Func(func(ctx context.Context, changed func()) error {
+			return fmt.Errorf("all is lost")
+		})
+
+		err := redactr.Exec(runner, redactr.RestartIfEnvChanges(time.Hour), redactr.WatchChanges(0, failing))
+		if err == nil || !strings.Contains(err.Error(), "all is lost") {
+			t.Errorf(`Exec(): expected error with "all is lost", got: %v`, err)
+		}
+	})
+
+	t.Run("when called with the ReportChanges option, it should report how the configuration changed", func(t *testing.T) {
+		runner := &changeReportingRunner{Runner: &fakes.Runner{}}
+		runner.changes = exec.Changes{Env: []string{"DB_PASSWORD"}, Sources: []string{"vault:secret/data/db#password"}}
+
+		restarted := make(chan struct{})
+		runner.RunStub = func() error {
+			select {
+			case <-time.After(1 * time.Second):
+				return fmt.Errorf("timeout")
+			case <-restarted:
+				return nil
+			}
+		}
+		runner.RestartStub = func() {
+			restarted <- struct{}{}
+		}
+
+		var reported []exec.Changes
+		err := redactr.Exec(runner,
+			redactr.RestartIfEnvChanges(10*time.Millisecond),
+			redactr.ReportChanges(func(c exec.Changes) { reported = append(reported, c) }))
+		if err != nil {
+			t.Errorf("Exec() got err: %v", err)
+			return
+		}
+		if len(reported) != 1 || !reflect.DeepEqual(reported[0], runner.changes) {
+			t.Errorf("Exec() expected the changes to be reported once, got %v", reported)
+		}
+		if runner.HasConfigurationChangedCallCount() != 0 {
+			t.Errorf("Exec() expected HasConfigurationChanged() not to be called")
+		}
+	})
+
+	t.Run("it should stop re-evaluating the environment when the runner finishes", func(t *testing.T) {
+		runner := &fakes.Runner{}
+		runner.RunStub = func() error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}
+
+		err := redactr.Exec(runner, redactr.RestartIfEnvChanges(5*time.Millisecond))
+		if err != nil {
+			t.Errorf("Exec() got err: %v", err)
+			return
+		}
+		calls := runner.HasConfigurationChangedCallCount()
+		time.Sleep(50 * time.Millisecond)
+		if got := runner.HasConfigurationChangedCallCount(); got != calls {
+			t.Errorf("Exec() expected re-evaluation to stop, but HasConfigurationChanged() was called %v more times", got-calls)
+		}
+	})
+}
+
+// changeReportingRunner is a fake Runner
+// which can describe its changes
+type changeReportingRunner struct {
+	*fakes.Runner
+	changes exec.Changes
+}
+
+func (r *changeReportingRunner) ConfigurationChanges() (exec.Changes, error) {
+	return r.changes, nil
+}
+
+func Test_Exec_RestartOnFailure(t *testing.T) {
+	policy := redactr.RestartPolicy{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     4 * time.Millisecond,
+		Jitter:         0.5,
+		MaxRestarts:    3,
+		MinUptime:      30 * time.Millisecond,
+	}
+
+	t.Run("it should restart a failing runner until it succeeds", func(t *testing.T) {
+		runner := &fakes.Runner{}
+		runner.RunReturnsOnCall(0, fmt.Errorf("crash 1"))
+		runner.RunReturnsOnCall(1, fmt.Errorf("crash 2"))
+		runner.RunReturnsOnCall(2, nil)
+
+		err := redactr.Exec(runner, redactr.RestartOnFailure(policy))
+		if err != nil {
+			t.Errorf("Exec() got err: %v", err)
+		}
+		if runner.RunCallCount() != 3 {
+			t.Errorf("Exec() expected Run() to be called 3 times, got %v", runner.RunCallCount())
+		}
+	})
+
+	t.Run("it should give up after the maximum number of restarts", func(t *testing.T) {
+		runner := &fakes.Runner{}
+		runner.RunReturns(fmt.Errorf("all is lost"))
+
+		err := redactr.Exec(runner, redactr.RestartOnFailure(policy))
+		if err == nil || !strings.Contains(err.Error(), "all is lost") {
+			t.Errorf(`Exec(): expected error with "all is lost", got: %v`, err)
+		}
+		if runner.RunCallCount() != 4 {
+			t.Errorf("Exec() expected Run() to be called 4 times, got %v", runner.RunCallCount())
+		}
+	})
+
+	t.Run("it should count every failure when there is no minimum uptime", func(t *testing.T) {
+		runner := &fakes.Runner{}
+		var waits []time.Duration
+		last := time.Now()
+		runner.RunStub = func() error {
+			now := time.Now()
+			waits = append(waits, now.Sub(last))
+			last = now
+			return fmt.Errorf("all is lost")
+		}
+
+		noUptime := redactr.RestartPolicy{
+			InitialBackoff: 20 * time.Millisecond,
+			MaxRestarts:    2,
+		}
+		err := redactr.Exec(runner, redactr.RestartOnFailure(noUptime))
+		if err == nil || !strings.Contains(err.Error(), "all is lost") {
+			t.Errorf(`Exec(): expected error with "all is lost", got: %v`, err)
+		}
+		if runner.RunCallCount() != 3 {
+			t.Fatalf("Exec() expected Run() to be called 3 times, got %v", runner.RunCallCount())
+		}
+		if waits[2] < 40*time.Millisecond {
+			t.Errorf("Exec() expected the backoff to double, waited %v", waits[2])
+		}
+	})
+
+	t.Run("it should only count failures within the window", func(t *testing.T) {
+		runner := &fakes.Runner{}
+		runner.RunStub = func() error {
+			if runner.RunCallCount() > 8 {
+				return nil
+			}
+			time.Sleep(10 * time.Millisecond)
+			return fmt.Errorf("crash")
+		}
+
+		windowed := policy
+		windowed.Window = 25 * time.Millisecond
+		err := redactr.Exec(runner, redactr.RestartOnFailure(windowed))
+		if err != nil {
+			t.Errorf("Exec() got err: %v", err)
+		}
+	})
+
+	t.Run("it should reset the count of failures after a healthy run", func(t *testing.T) {
+		runner := &fakes.Runner{}
+		runner.RunStub = func() error {
+			n := runner.RunCallCount()
+			switch {
+			case n == 9:
+				return nil
+			case n%3 == 0:
+				// every third run is healthy
+				time.Sleep(policy.MinUptime)
+			}
+			return fmt.Errorf("crash")
+		}
+
+		err := redactr.Exec(runner, redactr.RestartOnFailure(policy))
+		if err != nil {
+			t.Errorf("Exec() got err: %v", err)
+		}
+		if runner.RunCallCount() != 9 {
+			t.Errorf("Exec() expected Run() to be called 9 times, got %v", runner.RunCallCount())
+		}
+	})
+
+	t.Run("it should not restart a command which exits after a forwarded termination signal", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("Windows can't send signals to processes")
+		}
+		replacer := &execfakes.Replacer{}
+		replacer.ReplaceStub = func(s string) (string, error) { return s, nil }
+		pr, pw := io.Pipe()
+		runner := exec.NewRunner(strings.NewReader(""), pw, os.Stderr, nil, replacer, "sh", "-c", "echo started; sleep 30")
+		runner.ForwardSignals(exec.ForwardedSignals...)
+
+		lines := make(chan string, 10)
+		go func() {
+			s := bufio.NewScanner(pr)
+			for s.Scan() {
+				lines <- s.Text()
+			}
+		}()
+		errs := make(chan error, 1)
+		go func() {
+			errs <- redactr.Exec(runner, redactr.RestartOnFailure(policy))
+			pw.Close()
+		}()
+
+		select {
+		case <-lines:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the command to start")
+		}
+		p, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Signal(syscall.SIGTERM); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case err := <-errs:
+			if ee, ok := err.(*exec.ExitError); !ok || !ee.Terminated || ee.Signal != syscall.SIGTERM {
+				t.Errorf("Exec(): want a command terminated by SIGTERM, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Exec() was still running 5s after SIGTERM")
+		}
+		select {
+		case line := <-lines:
+			t.Errorf("Exec(): expected no restart, got output %q", line)
+		default:
+		}
+	})
+
+	t.Run("it should not restart a runner which succeeds", func(t *testing.T) {
+		runner := &fakes.Runner{}
+		err := redactr.Exec(runner, redactr.RestartOnFailure(policy))
+		if err != nil {
+			t.Errorf("Exec() got err: %v", err)
+		}
+		if runner.RunCallCount() != 1 {
+			t.Errorf("Exec() expected Run() to be called one time, got %v", runner.RunCallCount())
+		}
+	})
+}
+
+// rotatingProvider is a provider of leased secrets,
+// whose secrets change each time they are read. Its
+// watcher reports one change, and it records the
+// revocation of its leases.
+type rotatingProvider struct {
+	reverseProvider
+	mu    sync.Mutex
+	reads int
+	log   []string
+}
+
+func (p *rotatingProvider) Unredact(s string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reads++
+	return fmt.Sprintf("%v-%v", s, p.reads), nil
+}
+
+func (p *rotatingProvider) WatchPayloads(payloads []string, interval time.Duration) (watch.Watcher, error) {
+	return watch.Func(func(ctx context.Context, changed func()) error {
+		select {
+		case <-time.After(100 * time.Millisecond):
+			changed()
+		case <-ctx.Done():
+		}
+		<-ctx.Done()
+		return nil
+	}), nil
+}
+
+func (p *rotatingProvider) RevokeLeases() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log = append(p.log, "revoke")
+	return nil
+}
+
+func (p *rotatingProvider) RevokeRetiredLeases() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log = append(p.log, "revoke retired")
+	return nil
+}
+
+func Test_ToolExec_Leases(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test command is a shell script")
+	}
+
+	t.Run("it should restart a command when its leased secrets change, and revoke the replaced leases", func(t *testing.T) {
+		tool, err := redactr.New()
+		if err != nil {
+			t.Fatalf("New() got err: %v", err)
+		}
+		p := &rotatingProvider{}
+		if err := tool.Providers.Register("lease", p); err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.TempFile("", "exec-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Close()
+		defer os.Remove(out.Name())
+
+		// the first command runs until it is restarted
+		err = tool.Exec("sh", []string{"-c", `echo "$SECRET" >> "$OUT"; [ "$SECRET" != secret-1 ] || sleep 5`},
+			redactr.Env("SECRET=~~redacted-lease:secret~~", "OUT="+out.Name()))
+		if err != nil {
+			t.Fatalf("Exec() got err: %v", err)
+		}
+
+		b, err := ioutil.ReadFile(out.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "secret-1\nsecret-3\n"; string(b) != want {
+			t.Errorf("Exec(): want commands run with\n%q\ngot\n%q", want, b)
+		}
+		want := []string{"revoke retired", "revoke retired", "revoke"}
+		if !reflect.DeepEqual(p.log, want) {
+			t.Errorf("want calls\n\t%v\ngot\n\t%v", want, p.log)
+		}
+	})
+}
+
+func Test_ToolExec_KeyFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test command is a shell script")
+	}
+
+	t.Run("it should load keys which are added to a key file, and re-evaluate the environment", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "redactr-exec")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		keyFile := filepath.Join(dir, "key")
+		secretFile := filepath.Join(dir, "secret.redacted")
+		out := filepath.Join(dir, "out")
+
+		redact := func(key, secret string) string {
+			t.Helper()
+			tool, err := redactr.New(redactr.AESKey(key))
+			if err != nil {
+				t.Fatalf("New() got err: %v", err)
+			}
+			redacted, err := tool.RedactTokens("~~redact:" + secret + "~~")
+			if err != nil {
+				t.Fatalf("RedactTokens() got err: %v", err)
+			}
+			return redacted
+		}
+		if err := ioutil.WriteFile(keyFile, []byte(testOldKey), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(secretFile, []byte(redact(testOldKey, "old")), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		tool, err := redactr.New(redactr.AESKeyFile(keyFile))
+		if err != nil {
+			t.Fatalf("New() got err: %v", err)
+		}
+
+		// rotate the key, then the secret
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			ioutil.WriteFile(keyFile, []byte(testOldKey+"\n"+testNewKey), 0600)
+			time.Sleep(200 * time.Millisecond)
+			ioutil.WriteFile(secretFile, []byte(redact(testNewKey, "new")), 0600)
+		}()
+
+		// the first command runs until it is restarted
+		err = tool.Exec("sh", []string{"-c", `cat "$1" >> "$OUT"; echo >> "$OUT"; [ "$(cat "$1")" = new ] || sleep 5`, "sh", "@redacted:" + secretFile},
+			redactr.Env("OUT="+out), redactr.RestartIfEnvChanges(time.Hour))
+		if err != nil {
+			t.Fatalf("Exec() got err: %v", err)
+		}
+
+		b, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "old\nnew\n"; string(b) != want {
+			t.Errorf("Exec(): want commands run with\n%q\ngot\n%q", want, b)
+		}
+	})
 }
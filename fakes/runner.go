@@ -2,6 +2,7 @@
 package fakes
 
 import (
+	"os"
 	"sync"
 
 	"github.com/dhoelle/redactr"
@@ -34,6 +35,11 @@ type Runner struct {
 	runReturnsOnCall map[int]struct {
 		result1 error
 	}
+	SignalStub        func(os.Signal)
+	signalMutex       sync.RWMutex
+	signalArgsForCall []struct {
+		arg1 os.Signal
+	}
 	StopStub        func()
 	stopMutex       sync.RWMutex
 	stopArgsForCall []struct {
@@ -172,6 +178,37 @@ func (fake *Runner) RunReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *Runner) Signal(arg1 os.Signal) {
+	fake.signalMutex.Lock()
+	fake.signalArgsForCall = append(fake.signalArgsForCall, struct {
+		arg1 os.Signal
+	}{arg1})
+	fake.recordInvocation("Signal", []interface{}{arg1})
+	fake.signalMutex.Unlock()
+	if fake.SignalStub != nil {
+		fake.SignalStub(arg1)
+	}
+}
+
+func (fake *Runner) SignalCallCount() int {
+	fake.signalMutex.RLock()
+	defer fake.signalMutex.RUnlock()
+	return len(fake.signalArgsForCall)
+}
+
+func (fake *Runner) SignalCalls(stub func(os.Signal)) {
+	fake.signalMutex.Lock()
+	defer fake.signalMutex.Unlock()
+	fake.SignalStub = stub
+}
+
+func (fake *Runner) SignalArgsForCall(i int) os.Signal {
+	fake.signalMutex.RLock()
+	defer fake.signalMutex.RUnlock()
+	argsForCall := fake.signalArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *Runner) Stop() {
 	fake.stopMutex.Lock()
 	fake.stopArgsForCall = append(fake.stopArgsForCall, struct {
@@ -204,6 +241,8 @@ func (fake *Runner) Invocations() map[string][][]interface{} {
 	defer fake.restartMutex.RUnlock()
 	fake.runMutex.RLock()
 	defer fake.runMutex.RUnlock()
+	fake.signalMutex.RLock()
+	defer fake.signalMutex.RUnlock()
 	fake.stopMutex.RLock()
 	defer fake.stopMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
@@ -3,7 +3,13 @@ module github.com/dhoelle/redactr
 go 1.12
 
 require (
+	github.com/fsnotify/fsnotify v1.4.7
+	github.com/hashicorp/go-hclog v0.8.0
+	github.com/hashicorp/go-plugin v1.0.0
 	github.com/hashicorp/vault/api v1.0.1
 	github.com/maxbrunsfeld/counterfeiter/v6 v6.2.2
 	github.com/urfave/cli v1.20.0
+	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
+	golang.org/x/sys v0.0.0-20190626221950-04f50cda93cb
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,212 @@
+package redactr
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/dhoelle/redactr/aes"
+
+	goexec "os/exec"
+)
+
+// A keySource loads AES key specs (see parseKeySpec)
+type keySource func() ([]string, error)
+
+// keysFromFile loads keys from a file, which must
+// only be accessible by its owner
+func keysFromFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key file: %v", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat key file %v: %v", filename, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("key file %v is not a regular file", filename)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("key file %v is accessible by other users (mode %v); restrict it with `chmod 600 %v`", filename, info.Mode().Perm(), filename)
+	}
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %v: %v", filename, err)
+	}
+	specs := splitKeySpecs(string(b))
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("key file %v is empty", filename)
+	}
+	return specs, nil
+}
+
+// keysFromFD loads keys from an inherited file
+// descriptor, which is read to EOF and closed
+func keysFromFD(fd int) ([]string, error) {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %v", fd))
+	if f == nil {
+		return nil, fmt.Errorf("invalid key file descriptor %v", fd)
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key from file descriptor %v: %v", fd, err)
+	}
+	specs := splitKeySpecs(string(b))
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no key was read from file descriptor %v", fd)
+	}
+	return specs, nil
+}
+
+// keysFromCommand loads keys from the
+// stdout of a shell command
+func keysFromCommand(command string) ([]string, error) {
+	cmd := goexec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("key command failed: %v", err)
+	}
+	specs := splitKeySpecs(string(b))
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("key command did not output a key")
+	}
+	return specs, nil
+}
+
+// loadKeyFiles adds the keys in the Tool's AES key files
+// (see AESKeyFile) which are not yet in its keyring. Keys
+// which were removed from the files are kept until the
+// Tool is created again.
+func (t *Tool) loadKeyFiles() error {
+	for _, filename := range t.aesKeyFiles {
+		specs, err := keysFromFile(filename)
+		if err != nil {
+			return fmt.Errorf("failed to reload AES keys: %v", err)
+		}
+		for _, spec := range specs {
+			id, key, err := parseKeySpec(spec)
+			if err != nil {
+				return fmt.Errorf("failed to parse AES keys in %v: %v", filename, err)
+			}
+			if err := addKey(t.aesKeys, id, key); err != nil {
+				return fmt.Errorf("failed to add AES key from %v: %v", filename, err)
+			}
+		}
+	}
+	return nil
+}
+
+// newKeyring creates an AES keyring from key specs
+// (see parseKeySpec). If primary is not empty, it
+// becomes the keyring's primary key; otherwise the
+// first of the other keys is primary.
+func newKeyring(primary string, others ...string) (*aes.Keyring, error) {
+	keyring := aes.NewKeyring()
+
+	specs := others
+	if primary != "" {
+		specs = append([]string{primary}, others...)
+	}
+	for _, spec := range specs {
+		id, key, err := parseKeySpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if err := addKey(keyring, id, key); err != nil {
+			return nil, err
+		}
+	}
+	return keyring, nil
+}
+
+// addKey adds a key to a keyring. It tolerates the same
+// key appearing more than once, e.g. as both the
+// primary key and in the keyring.
+func addKey(keyring *aes.Keyring, id string, key *[32]byte) error {
+	if id == "" {
+		id = aes.KeyID(key)
+	}
+	if existing, ok := keyring.Key(id); ok && *existing == *key {
+		return nil
+	}
+	return keyring.Add(id, key)
+}
+
+// passphraseKey derives a key from a passphrase, using
+// the KDF parameters in a key descriptor file
+func passphraseKey(passphrase, descriptorFile string) (string, *[32]byte, error) {
+	if descriptorFile == "" {
+		return "", nil, fmt.Errorf("a key descriptor file is required to derive a key from a passphrase")
+	}
+	b, err := ioutil.ReadFile(descriptorFile)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read key descriptor: %v", err)
+	}
+	d, err := aes.ParseKeyDescriptor(b)
+	if err != nil {
+		return "", nil, fmt.Errorf("%v: %v", descriptorFile, err)
+	}
+	key, err := d.DeriveKey(passphrase)
+	if err != nil {
+		return "", nil, err
+	}
+	return d.ID, key, nil
+}
+
+// parseKeySpec parses a key spec: a base64-encoded key,
+// optionally prefixed with an ID, like:
+//
+//    my-key:xuY6/V0ZE29RtPD3TNWga/EkdU3XYsPtBIk8U4nzZyc=
+//
+func parseKeySpec(spec string) (string, *[32]byte, error) {
+	var id string
+	spec = strings.TrimSpace(spec)
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		id, spec = spec[:i], spec[i+1:]
+		if id == "" {
+			return "", nil, fmt.Errorf("empty key ID")
+		}
+	}
+
+	key, err := keyFromString(spec)
+	if err != nil {
+		if id != "" {
+			return "", nil, fmt.Errorf("key %q: %v", id, err)
+		}
+		return "", nil, err
+	}
+	return id, key, nil
+}
+
+// splitKeySpecs splits a list of key specs
+// separated by commas or whitespace
+func splitKeySpecs(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+}
+
+func keyFromString(s string) (*[32]byte, error) {
+	// keys should be base64 redacted
+	d, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("could not base64-unredact key: %v", err)
+	}
+
+	if len(d) != 32 {
+		return nil, fmt.Errorf("key must be exactly 32 bytes (got %v)", len(d))
+	}
+	b := &[32]byte{}
+	copy(b[:], d)
+	return b, nil
+}
@@ -0,0 +1,98 @@
+package redactr_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dhoelle/redactr"
+)
+
+func TestNew_KeySources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redactr-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte(testOldKey+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	openKeyFile := filepath.Join(dir, "open-key")
+	if err := ioutil.WriteFile(openKeyFile, []byte(testOldKey+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(openKeyFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		opts        []redactr.NewToolOption
+		wantErrText string
+	}{
+		{
+			name: "key file",
+			opts: []redactr.NewToolOption{redactr.AESKeyFile(keyFile)},
+		},
+		{
+			name:        "key file readable by others",
+			opts:        []redactr.NewToolOption{redactr.AESKeyFile(openKeyFile)},
+			wantErrText: "chmod 600",
+		},
+		{
+			name:        "missing key file",
+			opts:        []redactr.NewToolOption{redactr.AESKeyFile(filepath.Join(dir, "nope"))},
+			wantErrText: "failed to open key file",
+		},
+		{
+			name: "key command",
+			opts: []redactr.NewToolOption{redactr.AESKeyCommand("echo " + testOldKey)},
+		},
+		{
+			name:        "failing key command",
+			opts:        []redactr.NewToolOption{redactr.AESKeyCommand("exit 3")},
+			wantErrText: "key command failed",
+		},
+		{
+			name:        "empty key command",
+			opts:        []redactr.NewToolOption{redactr.AESKeyCommand("true")},
+			wantErrText: "did not output a key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, err := redactr.New(tt.opts...)
+			if tt.wantErrText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Fatalf("New(): expected error with %q, got: %v", tt.wantErrText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() got err: %v", err)
+			}
+
+			// the loaded key should decrypt secrets
+			// redacted with testOldKey
+			other, err := redactr.New(redactr.AESKey(testOldKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			redacted, err := other.RedactTokens("~~redact:hunter2~~")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tool.UnredactTokens(redacted)
+			if err != nil {
+				t.Fatalf("UnredactTokens() got err: %v", err)
+			}
+			if got != "hunter2" {
+				t.Errorf("UnredactTokens()\n\twant %v\n\t got %v", "hunter2", got)
+			}
+		})
+	}
+}
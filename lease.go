@@ -0,0 +1,78 @@
+package redactr
+
+import "fmt"
+
+// A LeaseRevoker is a Provider whose secrets are leased,
+// like the dynamic secrets of the "vault-dynamic" provider.
+// Exec revokes the leases when the command that it runs
+// exits.
+type LeaseRevoker interface {
+	RevokeLeases() error
+}
+
+// A RetiredLeaseRevoker is a LeaseRevoker whose leases
+// can be replaced while a command runs. Exec revokes the
+// leases which were replaced each time that it (re)starts
+// the command, with the secrets of the new leases.
+type RetiredLeaseRevoker interface {
+	RevokeRetiredLeases() error
+}
+
+// A ConsistentUnredacter is a Provider whose secrets can
+// change from one unredaction to the next, like dynamic
+// secrets whose leases are replaced. While a command's
+// inputs are rendered (between a call to BeginRender, and
+// a call to the function that it returns), the secrets
+// that it unredacts are consistent with each other.
+type ConsistentUnredacter interface {
+	BeginRender() (end func())
+}
+
+// RevokeLeases revokes the leases of every
+// provider which is a LeaseRevoker
+func (r *Registry) RevokeLeases() error {
+	var firstErr error
+	for _, name := range r.Names() {
+		lr, ok := r.providers[name].(LeaseRevoker)
+		if !ok {
+			continue
+		}
+		if err := lr.RevokeLeases(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to revoke the leases of provider %v: %v", name, err)
+		}
+	}
+	return firstErr
+}
+
+// RevokeRetiredLeases revokes the replaced leases of
+// every provider which is a RetiredLeaseRevoker
+func (r *Registry) RevokeRetiredLeases() error {
+	var firstErr error
+	for _, name := range r.Names() {
+		lr, ok := r.providers[name].(RetiredLeaseRevoker)
+		if !ok {
+			continue
+		}
+		if err := lr.RevokeRetiredLeases(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to revoke the retired leases of provider %v: %v", name, err)
+		}
+	}
+	return firstErr
+}
+
+// BeginRender begins a render with every provider which
+// is a ConsistentUnredacter, and returns a function
+// which ends it
+func (r *Registry) BeginRender() (end func()) {
+	var ends []func()
+	for _, name := range r.Names() {
+		if cu, ok := r.providers[name].(ConsistentUnredacter); ok {
+			ends = append(ends, cu.BeginRender())
+		}
+	}
+	return func() {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i]()
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+)
+
+// A Client is a Provider which runs in a plugin.
+//
+// The plugin is launched the first time that it is
+// needed, and relaunched if it exits. Close stops it.
+type Client struct {
+	name string
+	path string
+
+	mu       sync.Mutex
+	client   *goplugin.Client
+	provider *RPCClient
+}
+
+// NewClient creates a Client for the plugin
+// executable at path
+func NewClient(name, path string) *Client {
+	return &Client{
+		name: name,
+		path: path,
+	}
+}
+
+// Redact redacts a secret
+func (c *Client) Redact(secret string) (string, error) {
+	return c.RedactWithContext(secret, "")
+}
+
+// Unredact unredacts a secret
+func (c *Client) Unredact(redacted string) (string, error) {
+	return c.UnredactWithContext(redacted, "")
+}
+
+// RedactWithContext redacts a secret, bound to a context label
+func (c *Client) RedactWithContext(secret, context string) (string, error) {
+	p, err := c.start()
+	if err != nil {
+		return "", err
+	}
+	return p.RedactWithContext(secret, context)
+}
+
+// UnredactWithContext unredacts a secret, bound to a context label
+func (c *Client) UnredactWithContext(redacted, context string) (string, error) {
+	p, err := c.start()
+	if err != nil {
+		return "", err
+	}
+	return p.UnredactWithContext(redacted, context)
+}
+
+// Close stops the plugin, if it is running
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		c.client.Kill()
+		c.client = nil
+		c.provider = nil
+	}
+	return nil
+}
+
+// start launches the plugin, unless it
+// is already running
+func (c *Client) start() (*RPCClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil && !c.client.Exited() {
+		return c.provider, nil
+	}
+	if c.client != nil {
+		c.client.Kill()
+		c.client = nil
+	}
+
+	client := goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig: Handshake,
+		Plugins: map[string]goplugin.Plugin{
+			pluginName: &ProviderPlugin{},
+		},
+		Cmd:              exec.Command(c.path),
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolNetRPC},
+
+		// errors from the plugin are returned by each
+		// call; go-plugin's own logs would only clutter
+		// stderr (including a spurious error on Kill)
+		Logger: hclog.NewNullLogger(),
+	})
+
+	rpcClient, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("failed to start plugin %v (%v): %v", c.name, c.path, err)
+	}
+	raw, err := rpcClient.Dispense(pluginName)
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("failed to connect to plugin %v (%v): %v", c.name, c.path, err)
+	}
+	provider, ok := raw.(*RPCClient)
+	if !ok {
+		client.Kill()
+		return nil, fmt.Errorf("plugin %v (%v) dispensed an unexpected type %T", c.name, c.path, raw)
+	}
+
+	c.client = client
+	c.provider = provider
+	return provider, nil
+}
@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// BinaryPrefix prefixes the names of plugin executables
+const BinaryPrefix = "redactr-provider-"
+
+// nameRE matches valid plugin names
+var nameRE = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// Discover finds plugins in the given directories, and then
+// on PATH. It returns the path of each plugin's executable,
+// keyed by plugin name (the part of the executable's name
+// after "redactr-provider-").
+//
+// If two plugins have the same name, the first one found
+// is used. Directories which don't exist are skipped.
+//
+// Like exec.LookPath, Discover skips empty and relative
+// entries on PATH (which name the current directory, or
+// one inside it), so that running redactr in a directory
+// never runs the plugins that it holds.
+func Discover(dirs ...string) (map[string]string, error) {
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir != "" && filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	plugins := make(map[string]string)
+	for _, dir := range dirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, info := range infos {
+			name, ok := pluginNameOf(info)
+			if !ok {
+				continue
+			}
+			if _, ok := plugins[name]; ok {
+				continue
+			}
+			plugins[name] = filepath.Join(dir, info.Name())
+		}
+	}
+	return plugins, nil
+}
+
+// pluginNameOf returns the name of the plugin in a file,
+// if the file is an executable plugin
+func pluginNameOf(info os.FileInfo) (string, bool) {
+	filename := info.Name()
+	if !strings.HasPrefix(filename, BinaryPrefix) {
+		return "", false
+	}
+	if info.IsDir() {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(filename, BinaryPrefix)
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, ".exe")
+	} else if info.Mode().Perm()&0111 == 0 {
+		return "", false
+	}
+	if !nameRE.MatchString(name) {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,42 @@
+// Command redactr-provider-rot13 is an example redactr
+// provider plugin. It "redacts" secrets with ROT13,
+// which offers no protection at all: use it to learn
+// how plugins work, not to hide secrets.
+//
+// Build it onto your PATH, then use it like:
+//
+//    $ go build -o ~/bin/redactr-provider-rot13 ./plugin/example/redactr-provider-rot13
+//    $ redactr redact "~~redact-rot13:hunter2~~"
+//    ~~redacted-rot13:uhagre2~~
+//
+package main
+
+import (
+	"strings"
+
+	"github.com/dhoelle/redactr/plugin"
+)
+
+func main() {
+	plugin.Serve(rot13Provider{})
+}
+
+type rot13Provider struct{}
+
+func (rot13Provider) Redact(secret string) (string, error) {
+	return strings.Map(rot13, secret), nil
+}
+
+func (rot13Provider) Unredact(redacted string) (string, error) {
+	return strings.Map(rot13, redacted), nil
+}
+
+func rot13(r rune) rune {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return 'a' + (r-'a'+13)%26
+	case r >= 'A' && r <= 'Z':
+		return 'A' + (r-'A'+13)%26
+	}
+	return r
+}
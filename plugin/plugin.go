@@ -0,0 +1,78 @@
+// Package plugin runs redactr providers out-of-process,
+// as hashicorp/go-plugin plugins.
+//
+// A plugin is an executable named redactr-provider-<name>,
+// which calls Serve from its main function. redactr finds
+// plugins on PATH (or in a plugins directory), and hands them
+// tokens with their name, like ~~redacted-<name>:...~~.
+package plugin
+
+import (
+	"net/rpc"
+	"os"
+
+	goplugin "github.com/hashicorp/go-plugin"
+)
+
+// Handshake is shared by redactr and its plugins.
+// A plugin will not run unless it is launched by redactr.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "REDACTR_PLUGIN",
+	MagicCookieValue: "b1c7a3e4-provider",
+}
+
+// pluginName is the name that providers are dispensed under
+const pluginName = "provider"
+
+// A Provider redacts and unredacts secrets.
+//
+// A Provider may also support context labels (see
+// redactr.ContextRedacter and redactr.ContextUnredacter),
+// by implementing RedactWithContext and UnredactWithContext.
+type Provider interface {
+	Redact(string) (string, error)
+	Unredact(string) (string, error)
+}
+
+// A contextProvider is a Provider
+// which supports context labels
+type contextProvider interface {
+	RedactWithContext(secret, context string) (string, error)
+	UnredactWithContext(redacted, context string) (string, error)
+}
+
+// Serve serves a Provider as a plugin. It should be
+// called from the plugin's main function, and does
+// not return.
+//
+// If the executable is run directly (rather than by
+// redactr), Serve prints a message and exits.
+func Serve(p Provider) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins: map[string]goplugin.Plugin{
+			pluginName: &ProviderPlugin{Impl: p},
+		},
+	})
+	os.Exit(0)
+}
+
+// ProviderPlugin serves and dispenses Providers
+// over net/rpc. It implements goplugin.Plugin.
+type ProviderPlugin struct {
+	// Impl is the Provider that is served.
+	// It is only needed by the plugin.
+	Impl Provider
+}
+
+// Server returns an RPC server for the Provider
+func (p *ProviderPlugin) Server(*goplugin.MuxBroker) (interface{}, error) {
+	return &RPCServer{Impl: p.Impl}, nil
+}
+
+// Client returns a Provider which calls
+// the plugin over RPC
+func (p *ProviderPlugin) Client(b *goplugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	return &RPCClient{client: c}, nil
+}
@@ -0,0 +1,138 @@
+package plugin_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dhoelle/redactr"
+	"github.com/dhoelle/redactr/plugin"
+)
+
+// buildExample builds the example plugin into a
+// temporary directory, which it returns
+func buildExample(t *testing.T) string {
+	if testing.Short() {
+		t.Skip("skipping plugin build in short mode")
+	}
+	dir, err := ioutil.TempDir("", "redactr-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "build", "-o", filepath.Join(dir, plugin.BinaryPrefix+"rot13"), "./example/redactr-provider-rot13")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to build example plugin: %v\n%s", err, out)
+	}
+	return dir
+}
+
+func TestDiscover(t *testing.T) {
+	dir := buildExample(t)
+	defer os.RemoveAll(dir)
+
+	// files which aren't executable plugins are skipped
+	if err := ioutil.WriteFile(filepath.Join(dir, plugin.BinaryPrefix+"readme"), []byte("hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "redactr"), []byte("hi"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	plugins, err := plugin.Discover(dir, filepath.Join(dir, "does-not-exist"))
+	if err != nil {
+		t.Fatalf("Discover() got err: %v", err)
+	}
+	if got, want := plugins["rot13"], filepath.Join(dir, plugin.BinaryPrefix+"rot13"); got != want {
+		t.Errorf("Discover(): expected rot13 at %v, got %v", want, got)
+	}
+	if _, ok := plugins["readme"]; ok {
+		t.Errorf("Discover(): expected non-executable files to be skipped")
+	}
+}
+
+func TestDiscover_RelativePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redactr-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{plugin.BinaryPrefix + "here", filepath.Join("bin", plugin.BinaryPrefix+"below")} {
+		if err := ioutil.WriteFile(filepath.Join(dir, path), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", strings.Join([]string{"", ".", "bin"}, string(os.PathListSeparator)))
+
+	plugins, err := plugin.Discover()
+	if err != nil {
+		t.Fatalf("Discover() got err: %v", err)
+	}
+	if len(plugins) != 0 {
+		t.Errorf("Discover(): expected empty and relative PATH entries to be skipped, got %v", plugins)
+	}
+}
+
+func TestTool_Plugins(t *testing.T) {
+	dir := buildExample(t)
+	defer os.RemoveAll(dir)
+
+	tool, err := redactr.New(redactr.DiscoverPlugins(dir))
+	if err != nil {
+		t.Fatalf("New() got err: %v", err)
+	}
+	defer tool.Close()
+
+	redacted, err := tool.RedactTokens("password: ~~redact-rot13:hunter2~~")
+	if err != nil {
+		t.Fatalf("Tool.RedactTokens() got err: %v", err)
+	}
+	if want := "password: ~~redacted-rot13:uhagre2~~"; redacted != want {
+		t.Errorf("Tool.RedactTokens()\n\twant %v\n\t got %v", want, redacted)
+	}
+
+	got, err := tool.UnredactTokens(redacted, redactr.WrapTokens)
+	if err != nil {
+		t.Fatalf("Tool.UnredactTokens() got err: %v", err)
+	}
+	if want := "password: ~~redact-rot13:hunter2~~"; got != want {
+		t.Errorf("Tool.UnredactTokens()\n\twant %v\n\t got %v", want, got)
+	}
+
+	t.Run("it should pass errors back from the plugin", func(t *testing.T) {
+		_, err := tool.RedactTokens("~~redact-rot13[label]:hunter2~~")
+		if err == nil {
+			t.Errorf("Tool.RedactTokens(): expected an error for a context label")
+		}
+	})
+
+	t.Run("it should relaunch the plugin after it is closed", func(t *testing.T) {
+		if err := tool.Close(); err != nil {
+			t.Fatalf("Tool.Close() got err: %v", err)
+		}
+		got, err := tool.UnredactTokens(redacted)
+		if err != nil {
+			t.Fatalf("Tool.UnredactTokens() got err: %v", err)
+		}
+		if want := "password: hunter2"; got != want {
+			t.Errorf("Tool.UnredactTokens()\n\twant %v\n\t got %v", want, got)
+		}
+	})
+}
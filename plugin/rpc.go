@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"fmt"
+	"net/rpc"
+)
+
+// Args are the arguments to a call to a plugin
+type Args struct {
+	Payload string
+
+	// Context is the label that the token is bound
+	// to, or empty for tokens without a label
+	Context string
+}
+
+// RPCServer serves a Provider over net/rpc
+type RPCServer struct {
+	Impl Provider
+}
+
+// Redact redacts a secret
+func (s *RPCServer) Redact(args Args, resp *string) error {
+	var err error
+	if args.Context == "" {
+		*resp, err = s.Impl.Redact(args.Payload)
+		return err
+	}
+	cp, ok := s.Impl.(contextProvider)
+	if !ok {
+		return fmt.Errorf("provider does not support context labels (token is labelled %q)", args.Context)
+	}
+	*resp, err = cp.RedactWithContext(args.Payload, args.Context)
+	return err
+}
+
+// Unredact unredacts a secret
+func (s *RPCServer) Unredact(args Args, resp *string) error {
+	var err error
+	if args.Context == "" {
+		*resp, err = s.Impl.Unredact(args.Payload)
+		return err
+	}
+	cp, ok := s.Impl.(contextProvider)
+	if !ok {
+		return fmt.Errorf("provider does not support context labels (token is labelled %q)", args.Context)
+	}
+	*resp, err = cp.UnredactWithContext(args.Payload, args.Context)
+	return err
+}
+
+// RPCClient calls a Provider over net/rpc
+type RPCClient struct {
+	client *rpc.Client
+}
+
+// Redact redacts a secret
+func (c *RPCClient) Redact(secret string) (string, error) {
+	return c.RedactWithContext(secret, "")
+}
+
+// Unredact unredacts a secret
+func (c *RPCClient) Unredact(redacted string) (string, error) {
+	return c.UnredactWithContext(redacted, "")
+}
+
+// RedactWithContext redacts a secret, bound to a context label
+func (c *RPCClient) RedactWithContext(secret, context string) (string, error) {
+	var resp string
+	if err := c.client.Call("Plugin.Redact", Args{Payload: secret, Context: context}, &resp); err != nil {
+		return "", err
+	}
+	return resp, nil
+}
+
+// UnredactWithContext unredacts a secret, bound to a context label
+func (c *RPCClient) UnredactWithContext(redacted, context string) (string, error) {
+	var resp string
+	if err := c.client.Call("Plugin.Unredact", Args{Payload: redacted, Context: context}, &resp); err != nil {
+		return "", err
+	}
+	return resp, nil
+}
@@ -0,0 +1,565 @@
+package redactr
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dhoelle/redactr/escape"
+)
+
+// A Provider redacts and unredacts the secrets in tokens
+// with its name, like "vault" in:
+//
+//    ~~redact-vault:path/to/secret#key#value~~
+//    ~~redacted-vault:path/to/secret#key~~
+//
+// A Provider may also be:
+//
+//  - a ContextRedacter and ContextUnredacter, to support
+//    tokens which are bound to a context label
+//
+//  - a PayloadMatcher, to only handle some payloads
+//
+//  - a PayloadWrapper, to control the payloads of
+//    unredacted tokens (see WrapTokens)
+//
+//  - a PayloadWatcher, to watch the secrets behind
+//    redacted tokens for changes (see Exec)
+//
+//  - a LeaseRevoker, RetiredLeaseRevoker and
+//    ConsistentUnredacter, for secrets which are
+//    leased (see Exec)
+//
+//  - a BatchRedacter and BatchUnredacter, to handle the
+//    tokens in a text in one batch, and a PayloadRewrapper,
+//    to rewrap them after a key is rotated (see RewrapTokens)
+type Provider interface {
+	Redacter
+	Unredacter
+}
+
+// A PayloadMatcher is a Provider which only handles
+// some payloads. Tokens with other payloads are
+// left as they are.
+type PayloadMatcher interface {
+	MatchUnredactedPayload(payload string) bool
+	MatchRedactedPayload(payload string) bool
+}
+
+// A PayloadWrapper is a Provider which builds the payload
+// of an unredacted token (when unredacting with the
+// WrapTokens option). By default, the payload is the
+// unredacted secret.
+type PayloadWrapper interface {
+	WrapUnredactedPayload(secret, redactedPayload string) string
+}
+
+// providerNameRE matches valid provider names,
+// like "aes" or "vault-transit"
+var providerNameRE = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// providerTokenRE matches the start of the tokens of
+// every provider, redacted and unredacted, like:
+//
+//    ~~redact:hunter2~~
+//    ~~redact[db-password]:hunter2~~
+//    ~~redact-vault:path/to/secret#key#value~~
+//    ~~redacted-aes[db-password]:v2:8a4f3c1e:...~~
+//    ~~redact+base64:AAECAwQ=~~
+//    ~~redact<<EOF
+//    multiple
+//    lines
+//    EOF~~
+//
+// Its groups capture "redact" or "redacted", the provider
+// name (if any), the +base64 modifier (if any), the context
+// label (if any) and the delimiter of a block token (if any).
+// The payload follows the match: up to the next ~~ on the
+// same line or, in a block token, up to the line which
+// holds only the delimiter (and the closing ~~).
+var providerTokenRE = regexp.MustCompile(`~~(redacted|redact)(?:-([a-z0-9]+(?:-[a-z0-9]+)*))?(\+base64)?(?:\[([^\[\]\s~]+)\])?(?::|<<([A-Za-z_][A-Za-z0-9_]*)\n)`)
+
+// A Registry holds Providers by name. It redacts and
+// unredacts text in a single pass, handing each token
+// to its provider exactly once.
+//
+// Tokens without a provider name (like ~~redact:hunter2~~)
+// are handled by the default provider. Tokens for providers
+// which are not registered are left as they are.
+type Registry struct {
+	providers   map[string]Provider
+	defaultName string
+}
+
+// NewRegistry creates an empty Registry, whose default
+// provider is named defaultName
+func NewRegistry(defaultName string) *Registry {
+	return &Registry{
+		providers:   make(map[string]Provider),
+		defaultName: defaultName,
+	}
+}
+
+// Register adds a Provider to the registry. Names are made
+// of lowercase letters and digits, and may contain dashes.
+func (r *Registry) Register(name string, p Provider) error {
+	if !providerNameRE.MatchString(name) {
+		return fmt.Errorf("invalid provider name %q", name)
+	}
+	if _, ok := r.providers[name]; ok {
+		return fmt.Errorf("provider %q is already registered", name)
+	}
+	r.providers[name] = p
+	return nil
+}
+
+// Provider returns the provider with the given name
+func (r *Registry) Provider(name string) (Provider, bool) {
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Names returns the names of all registered providers
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close closes every provider which is an io.Closer
+// (like plugins, which are stopped)
+func (r *Registry) Close() error {
+	var firstErr error
+	for _, name := range r.Names() {
+		c, ok := r.providers[name].(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close provider %v: %v", name, err)
+		}
+	}
+	return firstErr
+}
+
+// A providerToken describes the location of a
+// token, and the provider that handles it
+type providerToken struct {
+	ContextTokenLocation
+	provider string
+	redacted bool
+	base64   bool // the payload is base64-encoded
+}
+
+// locate finds every token which a registered
+// provider will handle, in a single scan
+func (r *Registry) locate(s string) []providerToken {
+	var tokens []providerToken
+	for pos := 0; pos < len(s); {
+		m := providerTokenRE.FindStringSubmatchIndex(s[pos:])
+		if m == nil {
+			break
+		}
+		for i := range m {
+			if m[i] >= 0 {
+				m[i] += pos
+			}
+		}
+
+		t := providerToken{
+			ContextTokenLocation: ContextTokenLocation{
+				EnvelopeStart: m[0],
+				PayloadStart:  m[1],
+			},
+			provider: r.defaultName,
+			redacted: s[m[2]:m[3]] == "redacted",
+			base64:   m[6] >= 0,
+		}
+		if m[4] >= 0 {
+			t.provider = s[m[4]:m[5]]
+		}
+		if m[8] >= 0 {
+			t.Context = s[m[8]:m[9]]
+		}
+
+		var ok bool
+		if m[10] >= 0 {
+			t.PayloadEnd, t.EnvelopeEnd, ok = blockPayloadEnd(s, m[1], s[m[10]:m[11]])
+		} else {
+			t.PayloadEnd, t.EnvelopeEnd, ok = linePayloadEnd(s, m[1])
+		}
+
+		if !ok || !r.accepts(t, s[t.PayloadStart:t.PayloadEnd]) {
+			// the text may still hold a token which
+			// starts inside this one
+			pos = t.EnvelopeStart + 1
+			continue
+		}
+		tokens = append(tokens, t)
+		pos = t.EnvelopeEnd
+	}
+	return tokens
+}
+
+// linePayloadEnd finds the end of a payload which starts
+// at start, and ends at the next ~~ on the same line.
+// The payload can't be empty.
+func linePayloadEnd(s string, start int) (payloadEnd, envelopeEnd int, ok bool) {
+	if start >= len(s) || s[start] == '\n' {
+		return 0, 0, false
+	}
+	i := strings.Index(s[start+1:], "~~")
+	if i < 0 {
+		return 0, 0, false
+	}
+	payloadEnd = start + 1 + i
+	if strings.IndexByte(s[start:payloadEnd], '\n') >= 0 {
+		return 0, 0, false
+	}
+	return payloadEnd, payloadEnd + len("~~"), true
+}
+
+// blockPayloadEnd finds the end of a block payload which
+// starts at start, and ends at a line which holds only
+// the delimiter and the closing ~~. The payload can't
+// be empty.
+func blockPayloadEnd(s string, start int, delimiter string) (payloadEnd, envelopeEnd int, ok bool) {
+	end := "\n" + delimiter + "~~"
+	i := strings.Index(s[start:], end)
+	if i <= 0 {
+		return 0, 0, false
+	}
+	return start + i, start + i + len(end), true
+}
+
+// accepts reports whether a token's provider
+// is registered, and will handle its payload
+func (r *Registry) accepts(t providerToken, payload string) bool {
+	p, ok := r.providers[t.provider]
+	if !ok {
+		return false
+	}
+	if t.base64 {
+		if t.redacted {
+			// redacted payloads are text
+			return false
+		}
+		decoded, err := decodeBase64Payload(payload)
+		if err != nil {
+			// let RedactTokens report the error
+			return true
+		}
+		payload = decoded
+	}
+	m, ok := p.(PayloadMatcher)
+	if !ok {
+		return true
+	}
+	if t.redacted {
+		return m.MatchRedactedPayload(payload)
+	}
+	return m.MatchUnredactedPayload(payload)
+}
+
+// decodeBase64Payload decodes the payload of a +base64
+// token. Whitespace (like the line breaks in a block
+// token) is ignored.
+func decodeBase64Payload(payload string) (string, error) {
+	payload = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, payload)
+	b, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// RedactTokens redacts every unredacted token in s
+func (r *Registry) RedactTokens(s string) (string, error) {
+	var tokens []providerToken
+	var payloads []string
+	for _, t := range r.locate(s) {
+		if t.redacted {
+			continue
+		}
+		payload := s[t.PayloadStart:t.PayloadEnd]
+		if t.base64 {
+			decoded, err := decodeBase64Payload(payload)
+			if err != nil {
+				return "", fmt.Errorf("failed to decode the base64 payload of a %v token: %v", t.provider, err)
+			}
+			payload = decoded
+		}
+		tokens = append(tokens, t)
+		payloads = append(payloads, payload)
+	}
+
+	batched, err := batchPayloads(tokens, payloads, "redact", func(t providerToken) func([]string) ([]string, error) {
+		if br, ok := r.providers[t.provider].(BatchRedacter); ok && t.Context == "" {
+			return br.RedactBatch
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var locations []ContextTokenLocation
+	var replacements []string
+	for i, t := range tokens {
+		redacted, ok := batched[i]
+		if !ok {
+			redacted, err = redactInContext(r.providers[t.provider], payloads[i], t.Context)
+			if err != nil {
+				return "", fmt.Errorf("failed to redact %v token: %v", t.provider, err)
+			}
+		}
+		locations = append(locations, t.ContextTokenLocation)
+		replacements = append(replacements, r.wrap(true, t.provider, t.Context, redacted))
+	}
+
+	return replaceLocations(s, locations, replacements), nil
+}
+
+// UnredactTokens unredacts every redacted token in s
+func (r *Registry) UnredactTokens(s string, opts ...UnredactTokensOption) (string, error) {
+	conf := newUnredactTokensConfig(opts...)
+	return r.unredactTokens(s, conf, escape.NewScanner(conf.format))
+}
+
+// unredactTokens unredacts every redacted token in
+// s, which continues the document followed by sc
+func (r *Registry) unredactTokens(s string, conf *UnredactTokensConfig, sc *escape.Scanner) (string, error) {
+	tokens := r.locate(s)
+	payloads := make([]string, len(tokens))
+	for i, t := range tokens {
+		payloads[i] = s[t.PayloadStart:t.PayloadEnd]
+	}
+
+	batched, err := batchPayloads(tokens, payloads, "unredact", func(t providerToken) func([]string) ([]string, error) {
+		if bu, ok := r.providers[t.provider].(BatchUnredacter); ok && t.redacted && t.Context == "" {
+			return bu.UnredactBatch
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var locations []ContextTokenLocation
+	var replacements []string
+	var skip []bool
+	for i, t := range tokens {
+		if !t.redacted {
+			// keep unredacted tokens, so that
+			// escaping can skip over them
+			locations = append(locations, t.ContextTokenLocation)
+			replacements = append(replacements, s[t.EnvelopeStart:t.EnvelopeEnd])
+			skip = append(skip, true)
+			continue
+		}
+		p := r.providers[t.provider]
+		payload := payloads[i]
+		secret, ok := batched[i]
+		if !ok {
+			secret, err = unredactInContext(p, payload, t.Context)
+			if err != nil {
+				return "", fmt.Errorf("failed to unredact %v token %v: %v", t.provider, s[t.EnvelopeStart:t.EnvelopeEnd], err)
+			}
+		}
+		conf.reportSecret(tokenSource(t.provider, t.Context, payload), secret)
+
+		if conf.wrapTokens {
+			if pw, ok := p.(PayloadWrapper); ok {
+				secret = pw.WrapUnredactedPayload(secret, payload)
+			}
+			secret = r.wrap(false, t.provider, t.Context, secret)
+		}
+		locations = append(locations, t.ContextTokenLocation)
+		replacements = append(replacements, secret)
+		skip = append(skip, conf.wrapTokens)
+	}
+
+	if err := escapeReplacements(sc, s, locations, replacements, skip); err != nil {
+		return "", err
+	}
+	return replaceLocations(s, locations, replacements), nil
+}
+
+// RedactStream redacts every unredacted token in a stream.
+// Its output is the same as from RedactTokens, but it reads
+// r through a bounded buffer, rather than all at once.
+func (r *Registry) RedactStream(in io.Reader, out io.Writer) error {
+	return streamTokens(in, out, registryLocator{r}, r.RedactTokens)
+}
+
+// UnredactStream unredacts every redacted token in a stream.
+// Its output is the same as from UnredactTokens, but it reads
+// r through a bounded buffer, rather than all at once.
+func (r *Registry) UnredactStream(in io.Reader, out io.Writer, opts ...UnredactTokensOption) error {
+	conf := newUnredactTokensConfig(opts...)
+	sc := escape.NewScanner(conf.format)
+	return streamTokens(in, out, registryLocator{r}, func(s string) (string, error) {
+		return r.unredactTokens(s, conf, sc)
+	})
+}
+
+// wrap builds a token for a provider. Unredacted tokens
+// for the default provider are written without a name,
+// like ~~redact:hunter2~~.
+//
+// The payload is written in a block token if it doesn't
+// fit on one line, and unredacted payloads which aren't
+// text (like binary data) are written in base64.
+func (r *Registry) wrap(redacted bool, provider, context, payload string) string {
+	prefix := "~~redact"
+	if redacted {
+		prefix = "~~redacted-" + provider
+	} else if provider != r.defaultName {
+		prefix += "-" + provider
+	}
+	if !redacted && !isText(payload) {
+		prefix += "+base64"
+		payload = base64.StdEncoding.EncodeToString([]byte(payload))
+	}
+	if context != "" {
+		prefix += "[" + context + "]"
+	}
+
+	if fitsOnLine(payload) {
+		return prefix + ":" + payload + "~~"
+	}
+	delimiter := blockDelimiter(payload)
+	return prefix + "<<" + delimiter + "\n" + payload + "\n" + delimiter + "~~"
+}
+
+// tokenSource describes the source of a redacted
+// token's secret, like "vault:secret/data/db#password"
+// or "aes[db-password]:v2:8a4f3c1e:..."
+func tokenSource(provider, context, payload string) string {
+	if context != "" {
+		provider += "[" + context + "]"
+	}
+	return provider + ":" + payload
+}
+
+// isText reports whether a payload is text, which can be
+// written into a token as it is: valid UTF-8, without
+// control characters other than tabs and line breaks
+func isText(payload string) bool {
+	if !utf8.ValidString(payload) {
+		return false
+	}
+	for _, r := range payload {
+		if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// fitsOnLine reports whether a payload can be
+// written into a one-line token, like ~~redact:hunter2~~
+func fitsOnLine(payload string) bool {
+	return !strings.ContainsAny(payload, "\r\n") &&
+		!strings.Contains(payload, "~~") &&
+		!strings.HasSuffix(payload, "~")
+}
+
+// blockDelimiter chooses a delimiter for a block
+// token, which doesn't appear in its payload
+func blockDelimiter(payload string) string {
+	delimiter := "EOF"
+	for i := 2; strings.Contains("\n"+payload+"\n", "\n"+delimiter+"~~"); i++ {
+		delimiter = fmt.Sprintf("EOF%v", i)
+	}
+	return delimiter
+}
+
+// registryLocator locates the tokens
+// handled by a Registry's providers
+type registryLocator struct {
+	r *Registry
+}
+
+func (l registryLocator) LocateTokens(s string) ([]struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }, error) {
+	tokens := l.r.locate(s)
+	sls := make([]struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }, len(tokens))
+	for i, t := range tokens {
+		sls[i] = struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }{
+			EnvelopeStart: t.EnvelopeStart,
+			PayloadStart:  t.PayloadStart,
+			PayloadEnd:    t.PayloadEnd,
+			EnvelopeEnd:   t.EnvelopeEnd,
+		}
+	}
+	return sls, nil
+}
+
+func (l registryLocator) LocateContextTokens(s string) ([]ContextTokenLocation, error) {
+	tokens := l.r.locate(s)
+	locations := make([]ContextTokenLocation, len(tokens))
+	for i, t := range tokens {
+		locations[i] = t.ContextTokenLocation
+	}
+	return locations, nil
+}
+
+// redactedLocator locates the redacted
+// tokens of one of a Registry's providers
+type redactedLocator struct {
+	r        *Registry
+	provider string
+}
+
+func (l redactedLocator) LocateTokens(s string) ([]struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }, error) {
+	locations, _ := l.LocateContextTokens(s)
+	sls := make([]struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }, len(locations))
+	for i, t := range locations {
+		sls[i] = struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }{
+			EnvelopeStart: t.EnvelopeStart,
+			PayloadStart:  t.PayloadStart,
+			PayloadEnd:    t.PayloadEnd,
+			EnvelopeEnd:   t.EnvelopeEnd,
+		}
+	}
+	return sls, nil
+}
+
+func (l redactedLocator) LocateContextTokens(s string) ([]ContextTokenLocation, error) {
+	var locations []ContextTokenLocation
+	for _, t := range l.r.locate(s) {
+		if t.redacted && t.provider == l.provider {
+			locations = append(locations, t.ContextTokenLocation)
+		}
+	}
+	return locations, nil
+}
+
+// redactedWrapper wraps redacted tokens for one of a
+// Registry's providers, as its RedactTokens does
+type redactedWrapper struct {
+	r        *Registry
+	provider string
+}
+
+func (w redactedWrapper) WrapToken(token, originalPayload, originalEnvelope string) string {
+	return w.r.wrap(true, w.provider, "", token)
+}
+
+func (w redactedWrapper) WrapContextToken(token, context, originalPayload, originalEnvelope string) string {
+	return w.r.wrap(true, w.provider, context, token)
+}
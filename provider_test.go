@@ -0,0 +1,356 @@
+package redactr_test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhoelle/redactr"
+	"github.com/dhoelle/redactr/watch"
+)
+
+// reverseProvider "redacts" secrets by reversing them
+type reverseProvider struct {
+	calls int
+}
+
+func (p *reverseProvider) Redact(s string) (string, error) {
+	p.calls++
+	return reverse(s), nil
+}
+
+func (p *reverseProvider) Unredact(s string) (string, error) {
+	p.calls++
+	return reverse(s), nil
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+// digitsProvider only handles payloads made of digits
+type digitsProvider struct {
+	reverseProvider
+}
+
+func (p *digitsProvider) MatchUnredactedPayload(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
+
+func (p *digitsProvider) MatchRedactedPayload(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
+
+// mapProvider unredacts secrets by looking them up
+type mapProvider map[string]string
+
+func (p mapProvider) Redact(s string) (string, error)   { return "", fmt.Errorf("not supported") }
+func (p mapProvider) Unredact(s string) (string, error) { return p[s], nil }
+
+// watchingProvider is a reverseProvider which
+// records the payloads that it is asked to watch
+type watchingProvider struct {
+	reverseProvider
+	payloads []string
+	interval time.Duration
+}
+
+func (p *watchingProvider) WatchPayloads(payloads []string, interval time.Duration) (watch.Watcher, error) {
+	p.payloads, p.interval = payloads, interval
+	return watch.Never(), nil
+}
+
+// leasingProvider is a reverseProvider which
+// records renders and the revocation of its leases
+type leasingProvider struct {
+	reverseProvider
+	log  *[]string
+	name string
+}
+
+func (p *leasingProvider) BeginRender() func() {
+	*p.log = append(*p.log, "begin "+p.name)
+	return func() { *p.log = append(*p.log, "end "+p.name) }
+}
+
+func (p *leasingProvider) RevokeLeases() error {
+	*p.log = append(*p.log, "revoke "+p.name)
+	return nil
+}
+
+func (p *leasingProvider) RevokeRetiredLeases() error {
+	*p.log = append(*p.log, "revoke retired "+p.name)
+	return nil
+}
+
+// batchingProvider is a reverseProvider which redacts,
+// unredacts and rewraps payloads in batches, and records
+// the batches. It rewraps payloads by appending a "+".
+type batchingProvider struct {
+	reverseProvider
+	batches [][]string
+}
+
+func (p *batchingProvider) RedactBatch(payloads []string) ([]string, error) {
+	return p.batch(payloads, reverse), nil
+}
+
+func (p *batchingProvider) UnredactBatch(payloads []string) ([]string, error) {
+	return p.batch(payloads, reverse), nil
+}
+
+func (p *batchingProvider) RewrapPayloads(payloads []string) ([]string, error) {
+	return p.batch(payloads, func(s string) string { return s + "+" }), nil
+}
+
+func (p *batchingProvider) batch(payloads []string, f func(string) string) []string {
+	p.batches = append(p.batches, payloads)
+	var out []string
+	for _, s := range payloads {
+		out = append(out, f(s))
+	}
+	return out
+}
+
+func TestRegistry(t *testing.T) {
+	newRegistry := func() (*redactr.Registry, *reverseProvider, *digitsProvider) {
+		r := redactr.NewRegistry("rev")
+		rev, digits := &reverseProvider{}, &digitsProvider{}
+		if err := r.Register("rev", rev); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Register("digits", digits); err != nil {
+			t.Fatal(err)
+		}
+		return r, rev, digits
+	}
+
+	t.Run("it should dispatch tokens to providers by name", func(t *testing.T) {
+		r, _, _ := newRegistry()
+		got, err := r.RedactTokens("a ~~redact:abc~~ b ~~redact-rev:def~~ c ~~redact-digits:123~~ d ~~redact-nope:xyz~~")
+		if err != nil {
+			t.Fatalf("Registry.RedactTokens() got err: %v", err)
+		}
+		want := "a ~~redacted-rev:cba~~ b ~~redacted-rev:fed~~ c ~~redacted-digits:321~~ d ~~redact-nope:xyz~~"
+		if got != want {
+			t.Errorf("Registry.RedactTokens()\n\twant %v\n\t got %v", want, got)
+		}
+	})
+
+	t.Run("it should hand each token to its provider exactly once", func(t *testing.T) {
+		r, _, digits := newRegistry()
+
+		// the secret itself looks like a redacted token
+		if err := r.Register("map", mapProvider{"k": "~~redacted-digits:123~~"}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := r.UnredactTokens("~~redacted-map:k~~")
+		if err != nil {
+			t.Fatalf("Registry.UnredactTokens() got err: %v", err)
+		}
+		if want := "~~redacted-digits:123~~"; got != want {
+			t.Errorf("Registry.UnredactTokens()\n\twant %v\n\t got %v", want, got)
+		}
+		if digits.calls != 0 {
+			t.Errorf("Registry.UnredactTokens(): expected no calls to digits, got %v", digits.calls)
+		}
+	})
+
+	t.Run("it should skip payloads that a provider doesn't match", func(t *testing.T) {
+		r, _, _ := newRegistry()
+		got, err := r.RedactTokens("~~redact-digits:12 ~~redact-digits:34~~")
+		if err != nil {
+			t.Fatalf("Registry.RedactTokens() got err: %v", err)
+		}
+		if want := "~~redact-digits:12 ~~redacted-digits:43~~"; got != want {
+			t.Errorf("Registry.RedactTokens()\n\twant %v\n\t got %v", want, got)
+		}
+	})
+
+	t.Run("it should wrap unredacted tokens", func(t *testing.T) {
+		r, _, _ := newRegistry()
+		got, err := r.UnredactTokens("~~redacted-rev[label]:cba~~ ~~redacted-digits:321~~", redactr.WrapTokens)
+		if err == nil || !strings.Contains(err.Error(), "context labels") {
+			t.Fatalf("Registry.UnredactTokens(): expected an error about context labels, got: %v (%v)", err, got)
+		}
+
+		got, err = r.UnredactTokens("~~redacted-rev:cba~~ ~~redacted-digits:321~~", redactr.WrapTokens)
+		if err != nil {
+			t.Fatalf("Registry.UnredactTokens() got err: %v", err)
+		}
+		if want := "~~redact:abc~~ ~~redact-digits:123~~"; got != want {
+			t.Errorf("Registry.UnredactTokens()\n\twant %v\n\t got %v", want, got)
+		}
+	})
+
+	t.Run("it should stream tokens", func(t *testing.T) {
+		r, _, _ := newRegistry()
+		var out bytes.Buffer
+		if err := r.RedactStream(strings.NewReader("~~redact:abc~~ ~~redact-digits:123~~"), &out); err != nil {
+			t.Fatalf("Registry.RedactStream() got err: %v", err)
+		}
+		if want := "~~redacted-rev:cba~~ ~~redacted-digits:321~~"; out.String() != want {
+			t.Errorf("Registry.RedactStream()\n\twant %v\n\t got %v", want, out.String())
+		}
+	})
+
+	t.Run("it should report the source of each secret, without the secret", func(t *testing.T) {
+		r, _, _ := newRegistry()
+		var sources, secrets []string
+		_, err := r.UnredactTokens("~~redacted-rev:cba~~ ~~redacted-digits:321~~",
+			redactr.ReportSecretSources(func(source, secret string) {
+				sources = append(sources, source)
+				secrets = append(secrets, secret)
+			}))
+		if err != nil {
+			t.Fatalf("Registry.UnredactTokens() got err: %v", err)
+		}
+		if want := []string{"rev:cba", "digits:321"}; !reflect.DeepEqual(sources, want) {
+			t.Errorf("ReportSecretSources() sources\n\twant %v\n\t got %v", want, sources)
+		}
+		if want := []string{"abc", "123"}; !reflect.DeepEqual(secrets, want) {
+			t.Errorf("ReportSecretSources() secrets\n\twant %v\n\t got %v", want, secrets)
+		}
+	})
+
+	t.Run("it should watch the tokens of providers which can watch them", func(t *testing.T) {
+		r, _, _ := newRegistry()
+		w := &watchingProvider{}
+		if err := r.Register("watching", w); err != nil {
+			t.Fatal(err)
+		}
+		docs := []string{
+			"A=~~redacted-watching:a#b~~ ~~redacted-rev:cba~~",
+			"~~redacted-watching:c~~ ~~redact-digits:123~~",
+		}
+		interval := func(provider string) time.Duration {
+			if provider == "watching" {
+				return time.Minute
+			}
+			return time.Second
+		}
+		watchers, unwatched, err := r.Watchers(docs, interval)
+		if err != nil {
+			t.Fatalf("Registry.Watchers() got err: %v", err)
+		}
+		if len(watchers) != 1 {
+			t.Errorf("Registry.Watchers(): expected 1 watcher, got %v", len(watchers))
+		}
+		if want := []string{"rev"}; !reflect.DeepEqual(unwatched, want) {
+			t.Errorf("Registry.Watchers() unwatched\n\twant %v\n\t got %v", want, unwatched)
+		}
+		if want := []string{"a#b", "c"}; !reflect.DeepEqual(w.payloads, want) {
+			t.Errorf("Registry.Watchers() payloads\n\twant %v\n\t got %v", want, w.payloads)
+		}
+		if w.interval != time.Minute {
+			t.Errorf("Registry.Watchers() interval: want %v, got %v", time.Minute, w.interval)
+		}
+	})
+
+	t.Run("it should begin renders and revoke leases with every provider which can", func(t *testing.T) {
+		r, _, _ := newRegistry()
+		var log []string
+		for _, name := range []string{"lease-a", "lease-b"} {
+			if err := r.Register(name, &leasingProvider{log: &log, name: name}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r.BeginRender()()
+		if err := r.RevokeRetiredLeases(); err != nil {
+			t.Fatalf("Registry.RevokeRetiredLeases() got err: %v", err)
+		}
+		if err := r.RevokeLeases(); err != nil {
+			t.Fatalf("Registry.RevokeLeases() got err: %v", err)
+		}
+		want := []string{"begin lease-a", "begin lease-b", "end lease-b", "end lease-a", "revoke retired lease-a", "revoke retired lease-b", "revoke lease-a", "revoke lease-b"}
+		if !reflect.DeepEqual(log, want) {
+			t.Errorf("want calls\n\t%v\ngot\n\t%v", want, log)
+		}
+	})
+
+	t.Run("it should hand tokens to providers which can batch them in one batch", func(t *testing.T) {
+		r, rev, _ := newRegistry()
+		batching := &batchingProvider{}
+		if err := r.Register("batch", batching); err != nil {
+			t.Fatal(err)
+		}
+
+		redacted, err := r.RedactTokens("a: ~~redact-batch:abc~~ b: ~~redact:xyz~~ c: ~~redact-batch:def~~")
+		if err != nil {
+			t.Fatalf("Registry.RedactTokens() got err: %v", err)
+		}
+		want := "a: ~~redacted-batch:cba~~ b: ~~redacted-rev:zyx~~ c: ~~redacted-batch:fed~~"
+		if redacted != want {
+			t.Errorf("Registry.RedactTokens() want %v, got %v", want, redacted)
+		}
+
+		unredacted, err := r.UnredactTokens(redacted)
+		if err != nil {
+			t.Fatalf("Registry.UnredactTokens() got err: %v", err)
+		}
+		if want := "a: abc b: xyz c: def"; unredacted != want {
+			t.Errorf("Registry.UnredactTokens() want %v, got %v", want, unredacted)
+		}
+
+		rewrapped, n, err := r.RewrapTokens(redacted)
+		if err != nil {
+			t.Fatalf("Registry.RewrapTokens() got err: %v", err)
+		}
+		want = "a: ~~redacted-batch:cba+~~ b: ~~redacted-rev:zyx~~ c: ~~redacted-batch:fed+~~"
+		if rewrapped != want || n != 2 {
+			t.Errorf("Registry.RewrapTokens() want %v (2 tokens), got %v (%v tokens)", want, rewrapped, n)
+		}
+
+		wantBatches := [][]string{{"abc", "def"}, {"cba", "fed"}, {"cba", "fed"}}
+		if !reflect.DeepEqual(batching.batches, wantBatches) {
+			t.Errorf("want batches %v, got %v", wantBatches, batching.batches)
+		}
+		if batching.calls != 0 || rev.calls != 2 {
+			t.Errorf("want tokens to be redacted and unredacted one at a time only by rev, got %v calls to batch and %v to rev", batching.calls, rev.calls)
+		}
+	})
+
+	t.Run("it should reject invalid and duplicate names", func(t *testing.T) {
+		r, _, _ := newRegistry()
+		if err := r.Register("Not Valid", &reverseProvider{}); err == nil {
+			t.Errorf("Registry.Register(): expected an error for an invalid name")
+		}
+		if err := r.Register("rev", &reverseProvider{}); err == nil {
+			t.Errorf("Registry.Register(): expected an error for a duplicate name")
+		}
+	})
+}
+
+func TestRegisterProvider(t *testing.T) {
+	tool, err := redactr.New(
+		redactr.AESKey(testOldKey),
+		redactr.RegisterProvider("rev", &reverseProvider{}),
+	)
+	if err != nil {
+		t.Fatalf("New() got err: %v", err)
+	}
+
+	redacted, err := tool.RedactTokens("~~redact:hunter2~~ ~~redact-rev:swordfish~~")
+	if err != nil {
+		t.Fatalf("Tool.RedactTokens() got err: %v", err)
+	}
+	if !strings.HasPrefix(redacted, "~~redacted-aes:") || !strings.HasSuffix(redacted, " ~~redacted-rev:hsifdrows~~") {
+		t.Errorf("Tool.RedactTokens(): unexpected output: %v", redacted)
+	}
+
+	got, err := tool.UnredactTokens(redacted)
+	if err != nil {
+		t.Fatalf("Tool.UnredactTokens() got err: %v", err)
+	}
+	if want := "hunter2 swordfish"; got != want {
+		t.Errorf("Tool.UnredactTokens()\n\twant %v\n\t got %v", want, got)
+	}
+}
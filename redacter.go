@@ -13,3 +13,16 @@ type Redacter interface {
 type Unredacter interface {
 	Unredact(string) (string, error)
 }
+
+// A ContextRedacter redacts secrets which are bound to a
+// context label. The redacted secret should only unredact
+// in the same context.
+type ContextRedacter interface {
+	RedactWithContext(secret, context string) (string, error)
+}
+
+// A ContextUnredacter unredacts secrets which are
+// bound to a context label
+type ContextUnredacter interface {
+	UnredactWithContext(redacted, context string) (string, error)
+}
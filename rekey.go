@@ -0,0 +1,252 @@
+package redactr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dhoelle/redactr/aes"
+)
+
+// A CompositeTokenRekeyer looks for redacted secret tokens
+// within text, unredacts them with one Unredacter and
+// redacts them again with another Redacter.
+//
+// Secrets are only ever held in memory. Context labels
+// are kept: a labelled token is unredacted and redacted
+// again in the same context.
+type CompositeTokenRekeyer struct {
+	Locator    TokenLocator
+	Unredacter Unredacter
+	Redacter   Redacter
+	Wrapper    TokenWrapper
+}
+
+// RekeyTokens looks for redacted secret tokens within text,
+// and re-redacts them. It returns the rekeyed text and the
+// number of tokens that were rekeyed.
+//
+// If any token fails to unredact or redact, RekeyTokens
+// returns an error and no text.
+func (k *CompositeTokenRekeyer) RekeyTokens(s string) (string, int, error) {
+	locations, err := locateContextTokens(k.Locator, s)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to locate tokens: %v", err)
+	}
+
+	// walk through the matches in reverse order;
+	// we'll be cutting and inserting, and this
+	// simplifies the calculation
+	for i := len(locations) - 1; i >= 0; i-- {
+		location := locations[i]
+		payload := s[location.PayloadStart:location.PayloadEnd]
+		envelope := s[location.EnvelopeStart:location.EnvelopeEnd]
+
+		unredacted, err := unredactInContext(k.Unredacter, payload, location.Context)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to unredact token %v: %v", i, err)
+		}
+
+		redacted, err := redactInContext(k.Redacter, unredacted, location.Context)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to redact token %v: %v", i, err)
+		}
+
+		wrappedToken, err := wrapInContext(k.Wrapper, redacted, location.Context, payload, envelope)
+		if err != nil {
+			return "", 0, err
+		}
+		s = s[:location.EnvelopeStart] + wrappedToken + s[location.EnvelopeEnd:]
+	}
+
+	return s, len(locations), nil
+}
+
+// A RekeyResult describes the outcome of rekeying one file
+type RekeyResult struct {
+	Filename string
+	Tokens   int
+}
+
+// RekeyTokens re-encrypts every AES token in a string
+// (tokens like ~~redacted-aes:...~~, in any form that the
+// Tool's Providers read, including block tokens), which
+// must have been encrypted with one of the Tool's AES
+// keys, under new keys.
+//
+// The new keys are configured with the same options as
+// the Tool's own keys (AESKey, AESKeyring, AESKeyFile,
+// AESKeyFD, AESKeyCommand or AESPassphrase). Tokens are
+// encrypted with the new primary key.
+//
+// It returns the rekeyed string and the number
+// of tokens that were rekeyed.
+func (t *Tool) RekeyTokens(s string, newKeys ...NewToolOption) (string, int, error) {
+	k, err := t.aesRekeyer(newKeys)
+	if err != nil {
+		return "", 0, err
+	}
+	return k.RekeyTokens(s)
+}
+
+// RekeyFiles re-encrypts every AES token in the named files
+// under new keys (see RekeyTokens). Directories are walked
+// recursively.
+//
+// All files are rekeyed in memory before any of them are
+// written. If any token fails to decrypt with the Tool's
+// keys, RekeyFiles returns an error and leaves every file
+// untouched. Files which do not contain any tokens are not
+// rewritten.
+func (t *Tool) RekeyFiles(paths []string, newKeys ...NewToolOption) ([]RekeyResult, error) {
+	k, err := t.aesRekeyer(newKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return rewriteFiles(paths, "rekey", k.RekeyTokens)
+}
+
+// RewrapTokens rewraps every token in a string whose
+// provider can rewrap its secrets after a key is rotated
+// (see PayloadRewrapper), like ~~redacted-vault-transit:...~~
+// tokens. Secrets are re-encrypted without being unredacted.
+//
+// It returns the rewrapped string and the number
+// of tokens that were rewrapped.
+func (t *Tool) RewrapTokens(s string) (string, int, error) {
+	return t.Providers.RewrapTokens(s)
+}
+
+// RewrapFiles rewraps the tokens in the named files (see
+// RewrapTokens). Directories are walked recursively.
+//
+// As with RekeyFiles, no file is written unless
+// every token in every file is rewrapped.
+func (t *Tool) RewrapFiles(paths []string) ([]RekeyResult, error) {
+	return rewriteFiles(paths, "rewrap", t.Providers.RewrapTokens)
+}
+
+// rewriteFiles rewrites the tokens in the named files with
+// f, which returns the new text and the number of tokens that
+// it rewrote. Every file is rewritten in memory before any of
+// them are written, and files whose tokens are unchanged are
+// not written.
+func rewriteFiles(paths []string, verb string, f func(string) (string, int, error)) ([]RekeyResult, error) {
+	filenames, err := walkFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []RekeyResult
+	rewritten := make(map[string]string)
+	for _, filename := range filenames {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %v: %v", filename, err)
+		}
+		s, n, err := f(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed to %v %v: %v", verb, filename, err)
+		}
+		results = append(results, RekeyResult{Filename: filename, Tokens: n})
+		if n > 0 {
+			rewritten[filename] = s
+		}
+	}
+
+	for _, filename := range filenames {
+		s, ok := rewritten[filename]
+		if !ok {
+			continue
+		}
+		if err := replaceFile(filename, []byte(s)); err != nil {
+			return nil, fmt.Errorf("failed to write %v: %v", filename, err)
+		}
+	}
+
+	return results, nil
+}
+
+// aesRekeyer rekeys AES tokens from the Tool's
+// keys to the keys configured by newKeys
+func (t *Tool) aesRekeyer(newKeys []NewToolOption) (*CompositeTokenRekeyer, error) {
+	if t.aesKeys == nil {
+		return nil, fmt.Errorf("missing old AES key")
+	}
+	c := &NewToolConfig{}
+	for _, o := range newKeys {
+		o(c)
+	}
+	keyring, err := c.aesKeyring()
+	if err != nil {
+		return nil, fmt.Errorf("new AES key: %v", err)
+	}
+	if keyring == nil {
+		return nil, fmt.Errorf("missing new AES key")
+	}
+
+	return &CompositeTokenRekeyer{
+		Locator:    redactedLocator{t.Providers, "aes"},
+		Unredacter: &aes.KeyringRedacter{Keyring: t.aesKeys},
+		Redacter:   &aes.KeyringRedacter{Keyring: keyring},
+		Wrapper:    redactedWrapper{t.Providers, "aes"},
+	}, nil
+}
+
+// walkFiles returns the regular files named by paths,
+// descending into directories. Version control
+// directories (like .git) are skipped.
+func walkFiles(paths []string) ([]string, error) {
+	var filenames []string
+	for _, p := range paths {
+		err := filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				switch info.Name() {
+				case ".git", ".hg", ".svn":
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.Mode().IsRegular() {
+				filenames = append(filenames, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %v: %v", p, err)
+		}
+	}
+	return filenames, nil
+}
+
+// replaceFile atomically replaces the contents of a file,
+// keeping its permissions
+func replaceFile(filename string, b []byte) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	tf, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tf.Name())
+
+	if _, err := tf.Write(b); err != nil {
+		tf.Close()
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tf.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tf.Name(), filename)
+}
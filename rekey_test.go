@@ -0,0 +1,232 @@
+package redactr_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dhoelle/redactr"
+)
+
+const (
+	testOldKey = "xuY6/V0ZE29RtPD3TNWga/EkdU3XYsPtBIk8U4nzZyc="
+	testNewKey = "AQEBAQICAgIDAwMDBAQEBAUFBQUGBgYGBwcHBwgICAg="
+)
+
+func TestTool_RekeyTokens(t *testing.T) {
+	t.Run("it should re-encrypt tokens under the new key", func(t *testing.T) {
+		oldTool, err := redactr.New(redactr.AESKey(testOldKey))
+		if err != nil {
+			t.Fatalf("New() got err: %v", err)
+		}
+		newTool, err := redactr.New(redactr.AESKey(testNewKey))
+		if err != nil {
+			t.Fatalf("New() got err: %v", err)
+		}
+
+		redacted, err := oldTool.RedactTokens("a: ~~redact:hunter2~~\nb: ~~redact:swordfish~~\n")
+		if err != nil {
+			t.Fatalf("RedactTokens() got err: %v", err)
+		}
+
+		rekeyed, n, err := oldTool.RekeyTokens(redacted, redactr.AESKey(testNewKey))
+		if err != nil {
+			t.Fatalf("RekeyTokens() got err: %v", err)
+		}
+		if n != 2 {
+			t.Errorf("RekeyTokens() want 2 tokens rekeyed, got %v", n)
+		}
+
+		want := "a: hunter2\nb: swordfish\n"
+		got, err := newTool.UnredactTokens(rekeyed)
+		if err != nil {
+			t.Fatalf("UnredactTokens() with new key got err: %v", err)
+		}
+		if got != want {
+			t.Errorf("UnredactTokens() with new key\n\twant %q\n\t got %q", want, got)
+		}
+
+		if _, err := oldTool.UnredactTokens(rekeyed); err == nil {
+			t.Errorf("UnredactTokens() with old key: expected an error, got none")
+		}
+	})
+
+	t.Run("it should load the new keys like the Tool's keys", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "redactr-rekey")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		keyFile := filepath.Join(dir, "new.key")
+		writeFile(t, keyFile, "new:"+testNewKey+"\n")
+
+		oldTool, err := redactr.New(redactr.AESKey(testOldKey))
+		if err != nil {
+			t.Fatalf("New() got err: %v", err)
+		}
+		redacted, err := oldTool.RedactTokens("a: ~~redact:hunter2~~")
+		if err != nil {
+			t.Fatalf("RedactTokens() got err: %v", err)
+		}
+
+		// the old key may be any key in the keyring
+		tool, err := redactr.New(redactr.AESKeyring(testNewKey, testOldKey))
+		if err != nil {
+			t.Fatalf("New() got err: %v", err)
+		}
+		rekeyed, _, err := tool.RekeyTokens(redacted, redactr.AESKeyFile(keyFile))
+		if err != nil {
+			t.Fatalf("RekeyTokens() got err: %v", err)
+		}
+		if !strings.HasPrefix(rekeyed, "a: ~~redacted-aes:v2:new:") {
+			t.Errorf("RekeyTokens() want a token under the key in %v, got %v", keyFile, rekeyed)
+		}
+
+		if _, _, err := tool.RekeyTokens(redacted); err == nil {
+			t.Errorf("RekeyTokens() without new keys: expected an error, got none")
+		}
+		if _, _, err := tool.RekeyTokens(redacted, redactr.AESKeyFile(filepath.Join(dir, "missing"))); err == nil {
+			t.Errorf("RekeyTokens() with a missing key file: expected an error, got none")
+		}
+	})
+}
+
+func TestTool_RekeyTokens_Forms(t *testing.T) {
+	tool, err := redactr.New(redactr.AESKey(testOldKey))
+	if err != nil {
+		t.Fatalf("New() got err: %v", err)
+	}
+	newTool, err := redactr.New(redactr.AESKey(testNewKey))
+	if err != nil {
+		t.Fatalf("New() got err: %v", err)
+	}
+	redact := func(s string) string {
+		t.Helper()
+		redacted, err := tool.RedactTokens(s)
+		if err != nil {
+			t.Fatalf("RedactTokens() got err: %v", err)
+		}
+		return redacted
+	}
+
+	// a redacted token may be written as a block
+	line := redact("~~redact:hunter2~~")
+	block := strings.Replace(line, "~~redacted-aes:", "~~redacted-aes<<EOF\n", 1)
+	block = strings.TrimSuffix(block, "~~") + "\nEOF~~"
+
+	// unredacted tokens, and the tokens of other
+	// providers, are left as they are
+	kept := "~~redact+base64:aHVudGVyMg==~~ ~~redact<<EOF\nswordfish\nEOF~~ ~~redacted-vault:secret/data/db#password~~"
+
+	in := strings.Join([]string{block, redact("~~redact[db]:swordfish~~"), kept}, "\n")
+	rekeyed, n, err := tool.RekeyTokens(in, redactr.AESKey(testNewKey))
+	if err != nil {
+		t.Fatalf("RekeyTokens() got err: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("RekeyTokens() want 2 tokens rekeyed, got %v", n)
+	}
+	if !strings.HasSuffix(rekeyed, "\n"+kept) {
+		t.Errorf("RekeyTokens() want %q kept, got %q", kept, rekeyed)
+	}
+
+	got, err := newTool.UnredactTokens(strings.TrimSuffix(rekeyed, "\n"+kept))
+	if err != nil {
+		t.Fatalf("UnredactTokens() with new key got err: %v", err)
+	}
+	if want := "hunter2\nswordfish"; got != want {
+		t.Errorf("UnredactTokens() with new key\n\twant %q\n\t got %q", want, got)
+	}
+}
+
+func TestTool_RekeyFiles(t *testing.T) {
+	tool, err := redactr.New(redactr.AESKey(testOldKey))
+	if err != nil {
+		t.Fatalf("New() got err: %v", err)
+	}
+	newTool, err := redactr.New(redactr.AESKey(testNewKey))
+	if err != nil {
+		t.Fatalf("New() got err: %v", err)
+	}
+	redacted, err := tool.RedactTokens("password: ~~redact:hunter2~~\n")
+	if err != nil {
+		t.Fatalf("RedactTokens() got err: %v", err)
+	}
+
+	t.Run("it should rekey files in directories, and report the number of tokens in each", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "redactr-rekey")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		a := filepath.Join(dir, "a.yaml")
+		b := filepath.Join(dir, "nested", "b.yaml")
+		writeFile(t, a, redacted+redacted)
+		writeFile(t, b, "nothing to see here\n")
+
+		results, err := tool.RekeyFiles([]string{dir}, redactr.AESKey(testNewKey))
+		if err != nil {
+			t.Fatalf("RekeyFiles() got err: %v", err)
+		}
+		want := map[string]int{a: 2, b: 0}
+		if len(results) != len(want) {
+			t.Fatalf("RekeyFiles() want %v results, got %v", len(want), results)
+		}
+		for _, r := range results {
+			if want[r.Filename] != r.Tokens {
+				t.Errorf("RekeyFiles() want %v tokens in %v, got %v", want[r.Filename], r.Filename, r.Tokens)
+			}
+		}
+
+		got, _, err := newTool.RekeyTokens(readFile(t, a), redactr.AESKey(testOldKey))
+		if err != nil {
+			t.Fatalf("RekeyTokens() back to the old key got err: %v", err)
+		}
+		if unredacted, _ := tool.UnredactTokens(got); unredacted != "password: hunter2\npassword: hunter2\n" {
+			t.Errorf("RekeyFiles() wrote unexpected content: %q", unredacted)
+		}
+	})
+
+	t.Run("if any token fails to decrypt, it should leave every file untouched", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "redactr-rekey")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		good := filepath.Join(dir, "good.yaml")
+		bad := filepath.Join(dir, "bad.yaml")
+		writeFile(t, good, redacted)
+		writeFile(t, bad, "password: ~~redacted-aes:bm90IGEgdmFsaWQgY2lwaGVydGV4dA==~~\n")
+
+		_, err = tool.RekeyFiles([]string{good, bad}, redactr.AESKey(testNewKey))
+		if err == nil || !strings.Contains(err.Error(), bad) {
+			t.Fatalf("RekeyFiles(): expected an error naming %v, got: %v", bad, err)
+		}
+		if got := readFile(t, good); got != redacted {
+			t.Errorf("RekeyFiles() changed %v\n\twant %q\n\t got %q", good, redacted, got)
+		}
+	})
+}
+
+func writeFile(t *testing.T, filename, s string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, []byte(s), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, filename string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,151 @@
+package redactr
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MaxStreamTokenSize is the size, in bytes, of the longest
+// token that is guaranteed to be found when redacting
+// or unredacting a stream.
+const MaxStreamTokenSize = 64 * 1024
+
+// A TokenStreamRedacter can redact tokens in a stream
+type TokenStreamRedacter interface {
+	RedactStream(r io.Reader, w io.Writer) error
+}
+
+// A TokenStreamUnredacter can unredact tokens in a stream
+type TokenStreamUnredacter interface {
+	UnredactStream(r io.Reader, w io.Writer, opts ...UnredactTokensOption) error
+}
+
+// streamTokens reads r through a bounded buffer, and
+// writes it to w after passing it through process.
+//
+// Each chunk that is passed to process ends at a
+// point which no token (of at most MaxStreamTokenSize)
+// straddles, so the output is the same as if all
+// of r had been processed at once.
+func streamTokens(r io.Reader, w io.Writer, l TokenLocator, process func(string) (string, error)) error {
+	buf := make([]byte, 0, 4*MaxStreamTokenSize)
+	chunk := make([]byte, MaxStreamTokenSize)
+	for {
+		n, readErr := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		eof := readErr == io.EOF
+		if readErr != nil && !eof {
+			return fmt.Errorf("failed to read input: %v", readErr)
+		}
+		if !eof && len(buf) < 3*MaxStreamTokenSize {
+			continue
+		}
+
+		cut := len(buf)
+		if !eof {
+			var err error
+			cut, err = safeCut(l, string(buf), len(buf)-MaxStreamTokenSize)
+			if err != nil {
+				return err
+			}
+		}
+
+		out, err := process(string(buf[:cut]))
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, out); err != nil {
+			return fmt.Errorf("failed to write output: %v", err)
+		}
+
+		buf = append(buf[:0], buf[cut:]...)
+		if eof {
+			return nil
+		}
+	}
+}
+
+// safeCut finds a point, at or after min, where s
+// can be cut without splitting a token. Tokens which
+// start before min are kept whole, before the cut. A
+// block token which isn't finished in s is kept whole
+// after the cut (even if it starts before min).
+//
+// Where it can, safeCut cuts at the end of a line, so
+// that each chunk holds the whole line around each of
+// its tokens (which escaping may look at).
+func safeCut(l TokenLocator, s string, min int) (int, error) {
+	locations, err := locateContextTokens(l, s)
+	if err != nil {
+		return 0, fmt.Errorf("failed to locate tokens: %v", err)
+	}
+
+	cut := min
+	for _, location := range locations {
+		if location.EnvelopeStart >= min {
+			break
+		}
+		if location.EnvelopeEnd > cut {
+			cut = location.EnvelopeEnd
+		}
+	}
+
+	// never cut after the opener of a block token whose
+	// closing line isn't in s yet, as the locator can't
+	// find the token (unless the opener starts s, and the
+	// token is too long to keep whole)
+	open := unterminatedBlock(s)
+	if open > 0 && cut > open {
+		return open, nil
+	}
+
+	// move the cut to the end of its line, unless a
+	// token straddles the end of the line
+	for {
+		i := strings.IndexByte(s[cut:], '\n')
+		if i < 0 {
+			return cut, nil
+		}
+		lineEnd := cut + i + 1
+		if open > 0 && lineEnd > open {
+			return cut, nil
+		}
+		straddled := false
+		for _, location := range locations {
+			if location.EnvelopeStart < lineEnd && location.EnvelopeEnd > lineEnd {
+				cut = location.EnvelopeEnd
+				straddled = true
+				break
+			}
+		}
+		if !straddled {
+			return lineEnd, nil
+		}
+	}
+}
+
+// unterminatedBlock returns the start of the first block
+// token in s whose closing line (like "EOF~~") isn't in s,
+// or -1 if there is none
+func unterminatedBlock(s string) int {
+	for pos := 0; pos < len(s); {
+		m := providerTokenRE.FindStringSubmatchIndex(s[pos:])
+		if m == nil {
+			break
+		}
+		start, payloadStart := pos+m[0], pos+m[1]
+		if m[10] < 0 {
+			// a line token, which may
+			// hold the start of another
+			pos = payloadStart
+			continue
+		}
+		_, envelopeEnd, ok := blockPayloadEnd(s, payloadStart, s[pos+m[10]:pos+m[11]])
+		if !ok {
+			return start
+		}
+		pos = envelopeEnd
+	}
+	return -1
+}
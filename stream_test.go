@@ -0,0 +1,187 @@
+package redactr_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dhoelle/redactr"
+	"github.com/dhoelle/redactr/escape"
+	"github.com/dhoelle/redactr/fakes"
+)
+
+// chunkReader reads from a string in chunks of an
+// awkward size, so that tokens straddle reads
+type chunkReader struct {
+	s    string
+	size int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.s) == 0 {
+		return 0, io.EOF
+	}
+	n := r.size
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(r.s) {
+		n = len(r.s)
+	}
+	copy(p, r.s[:n])
+	r.s = r.s[n:]
+	return n, nil
+}
+
+// streamInput builds a large input, with tokens spread
+// through it at irregular intervals
+func streamInput(token func(i int) string) string {
+	var b strings.Builder
+	for i := 0; b.Len() < 1<<20; i++ {
+		b.WriteString(strings.Repeat("x", (i*7919)%5003))
+		b.WriteString(token(i))
+		if i%17 == 0 {
+			b.WriteString("\n~~redact: an unterminated token\n")
+		}
+	}
+	return b.String()
+}
+
+func TestCompositeTokenRedacter_RedactStream(t *testing.T) {
+	fakeRedacter := &fakes.Redacter{}
+	fakeRedacter.RedactStub = func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	}
+	e := &redactr.CompositeTokenRedacter{
+		Redacter: fakeRedacter,
+		Locator:  &redactr.RegexTokenLocator{RE: regexp.MustCompile(`(?U)~~redact:(.+)~~`)},
+		Wrapper:  &redactr.StringWrapper{Before: "~~redacted:", After: "~~"},
+	}
+
+	input := streamInput(func(i int) string {
+		return fmt.Sprintf("~~redact:secret-%v-%v~~", i, strings.Repeat("y", (i*31)%2000))
+	})
+	want, err := e.RedactTokens(input)
+	if err != nil {
+		t.Fatalf("CompositeTokenRedacter.RedactTokens() got err: %v", err)
+	}
+
+	for _, size := range []int{1 << 10, 4093, 1 << 16} {
+		t.Run(fmt.Sprintf("reading %v bytes at a time", size), func(t *testing.T) {
+			var got bytes.Buffer
+			if err := e.RedactStream(&chunkReader{s: input, size: size}, &got); err != nil {
+				t.Fatalf("CompositeTokenRedacter.RedactStream() got err: %v", err)
+			}
+			if got.String() != want {
+				t.Errorf("CompositeTokenRedacter.RedactStream() output (%v bytes) differs from RedactTokens() output (%v bytes)", got.Len(), len(want))
+			}
+		})
+	}
+}
+
+func TestTool_UnredactStream(t *testing.T) {
+	tool, err := redactr.New(redactr.AESKey(testOldKey))
+	if err != nil {
+		t.Fatalf("New() got err: %v", err)
+	}
+
+	redacted, err := tool.RedactTokens("~~redact:hunter2~~")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := streamInput(func(i int) string {
+		return " " + redacted + " "
+	})
+
+	want, err := tool.UnredactTokens(input, redactr.WrapTokens)
+	if err != nil {
+		t.Fatalf("Tool.UnredactTokens() got err: %v", err)
+	}
+	var got bytes.Buffer
+	if err := tool.UnredactStream(&chunkReader{s: input, size: 4093}, &got, redactr.WrapTokens); err != nil {
+		t.Fatalf("Tool.UnredactStream() got err: %v", err)
+	}
+	if got.String() != want {
+		t.Errorf("Tool.UnredactStream() output (%v bytes) differs from UnredactTokens() output (%v bytes)", got.Len(), len(want))
+	}
+
+	t.Run("it should follow the escaping context from one chunk to the next", func(t *testing.T) {
+		redacted, err := tool.RedactTokens(`~~redact:a "quoted" secret~~`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a JSON list, whose strings hold escaped quotes
+		// and tokens, with lines of irregular lengths
+		var b strings.Builder
+		b.WriteString("[")
+		for i := 0; b.Len() < 1<<20; i++ {
+			fmt.Fprintf(&b, "\"%v\", \"%v\",", strings.Repeat(`\"`, (i*7919)%5003), redacted)
+			if i%3 == 0 {
+				b.WriteString("\n")
+			}
+		}
+		b.WriteString(`"end"]`)
+		input := b.String()
+
+		want, err := tool.UnredactTokens(input, redactr.EscapeFor(escape.JSON))
+		if err != nil {
+			t.Fatalf("Tool.UnredactTokens() got err: %v", err)
+		}
+		var got bytes.Buffer
+		if err := tool.UnredactStream(&chunkReader{s: input, size: 4093}, &got, redactr.EscapeFor(escape.JSON)); err != nil {
+			t.Fatalf("Tool.UnredactStream() got err: %v", err)
+		}
+		if got.String() != want {
+			t.Errorf("Tool.UnredactStream() output (%v bytes) differs from UnredactTokens() output (%v bytes)", got.Len(), len(want))
+		}
+		var v []string
+		if err := json.Unmarshal(got.Bytes(), &v); err != nil {
+			t.Errorf("Tool.UnredactStream() output is not valid JSON: %v", err)
+		}
+	})
+
+	t.Run("it should return an error if a token fails to unredact", func(t *testing.T) {
+		err := tool.UnredactStream(strings.NewReader(input+"~~redacted-aes:bm9wZQ==~~"), &bytes.Buffer{})
+		if err == nil {
+			t.Errorf("Tool.UnredactStream(): expected an error")
+		}
+	})
+}
+
+func TestRegistry_RedactStream_BlockTokens(t *testing.T) {
+	r := redactr.NewRegistry("rev")
+	if err := r.Register("rev", &reverseProvider{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a PEM-sized block token, which opens on the line
+	// where the first chunk would be cut, but isn't
+	// finished in the first chunk
+	block := strings.Repeat("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef\n", 625)
+	input := strings.Repeat("x", 2*redactr.MaxStreamTokenSize+40000) +
+		" key: ~~redact<<EOF\n" + block + "EOF~~\n" +
+		"after\n"
+
+	want, err := r.RedactTokens(input)
+	if err != nil {
+		t.Fatalf("Registry.RedactTokens() got err: %v", err)
+	}
+	if strings.Contains(want, block) {
+		t.Fatalf("Registry.RedactTokens() left the block unredacted")
+	}
+	for _, size := range []int{4093, 1 << 16} {
+		t.Run(fmt.Sprintf("reading %v bytes at a time", size), func(t *testing.T) {
+			var got bytes.Buffer
+			if err := r.RedactStream(&chunkReader{s: input, size: size}, &got); err != nil {
+				t.Fatalf("Registry.RedactStream() got err: %v", err)
+			}
+			if got.String() != want {
+				t.Errorf("Registry.RedactStream() output (%v bytes) differs from RedactTokens() output (%v bytes)", got.Len(), len(want))
+			}
+		})
+	}
+}
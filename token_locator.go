@@ -14,6 +14,24 @@ type TokenLocator interface {
 	LocateTokens(string) ([]struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }, error)
 }
 
+// A ContextTokenLocator locates tokens which may
+// be bound to a context label, like the label
+// "db-password" in:
+//
+//    ~~redact[db-password]:hunter2~~
+//
+type ContextTokenLocator interface {
+	LocateContextTokens(string) ([]ContextTokenLocation, error)
+}
+
+// A ContextTokenLocation describes the location of a
+// token, and the context label that it is bound to.
+// Context is empty for tokens without a label.
+type ContextTokenLocation struct {
+	EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int
+	Context                                              string
+}
+
 // A RegexTokenLocator locates tokens according to a
 // regular expression (RE).
 //
@@ -21,6 +39,11 @@ type TokenLocator interface {
 // should have one capturing group which captures
 // the token payload. If the payload is the same as the
 // envelope, the entire regex should be a capturing group.
+//
+// The regex may also have a capturing group named
+// "context", which captures a context label that the
+// token is bound to. In that case, the payload group
+// must be named "payload".
 type RegexTokenLocator struct {
 	RE *regexp.Regexp
 }
@@ -28,15 +51,72 @@ type RegexTokenLocator struct {
 // LocateTokens locates all tokens according
 // to the embedded regular expression
 func (l *RegexTokenLocator) LocateTokens(s string) ([]struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }, error) {
+	locations, err := l.LocateContextTokens(s)
+	if err != nil {
+		return nil, err
+	}
+	sls := make([]struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }, len(locations))
+	for i, loc := range locations {
+		sls[i] = struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }{
+			EnvelopeStart: loc.EnvelopeStart,
+			PayloadStart:  loc.PayloadStart,
+			PayloadEnd:    loc.PayloadEnd,
+			EnvelopeEnd:   loc.EnvelopeEnd,
+		}
+	}
+	return sls, nil
+}
+
+// LocateContextTokens locates all tokens, and their
+// context labels, according to the embedded
+// regular expression
+func (l *RegexTokenLocator) LocateContextTokens(s string) ([]ContextTokenLocation, error) {
+	payloadGroup, contextGroup := 1, -1
+	for i, name := range l.RE.SubexpNames() {
+		switch name {
+		case "payload":
+			payloadGroup = i
+		case "context":
+			contextGroup = i
+		}
+	}
+
 	matches := l.RE.FindAllStringSubmatchIndex(s, -1)
-	sls := make([]struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }, len(matches))
+	locations := make([]ContextTokenLocation, len(matches))
 	for i, m := range matches {
-		sls[i] = struct{ EnvelopeStart, PayloadStart, PayloadEnd, EnvelopeEnd int }{
+		locations[i] = ContextTokenLocation{
 			EnvelopeStart: m[0],
-			PayloadStart:  m[2],
-			PayloadEnd:    m[3],
+			PayloadStart:  m[2*payloadGroup],
+			PayloadEnd:    m[2*payloadGroup+1],
 			EnvelopeEnd:   m[1],
 		}
+		if contextGroup > 0 && m[2*contextGroup] >= 0 {
+			locations[i].Context = s[m[2*contextGroup]:m[2*contextGroup+1]]
+		}
 	}
-	return sls, nil
+	return locations, nil
+}
+
+// locateContextTokens locates tokens with a TokenLocator.
+// If the locator is a ContextTokenLocator, the tokens'
+// context labels are located too.
+func locateContextTokens(l TokenLocator, s string) ([]ContextTokenLocation, error) {
+	if cl, ok := l.(ContextTokenLocator); ok {
+		return cl.LocateContextTokens(s)
+	}
+
+	sls, err := l.LocateTokens(s)
+	if err != nil {
+		return nil, err
+	}
+	locations := make([]ContextTokenLocation, len(sls))
+	for i, sl := range sls {
+		locations[i] = ContextTokenLocation{
+			EnvelopeStart: sl.EnvelopeStart,
+			PayloadStart:  sl.PayloadStart,
+			PayloadEnd:    sl.PayloadEnd,
+			EnvelopeEnd:   sl.EnvelopeEnd,
+		}
+	}
+	return locations, nil
 }
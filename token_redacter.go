@@ -1,6 +1,12 @@
 package redactr
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dhoelle/redactr/escape"
+)
 
 //go:generate gobin -m -run github.com/maxbrunsfeld/counterfeiter/v6 -o ./fakes/token_redacter.go --fake-name TokenRedacter . TokenRedacter
 
@@ -25,11 +31,35 @@ type TokenRedacterUnredacter interface {
 // A UnredactTokensConfig configures a request to unredact tokens.
 type UnredactTokensConfig struct {
 	wrapTokens bool
+	format     escape.Format
+	onSecret   func(secret string)
+	onSource   func(source, secret string)
 }
 
 // A UnredactTokensOption configures a request to unredact tokens.
 type UnredactTokensOption func(*UnredactTokensConfig)
 
+// ReportSecrets requests that f be called with each
+// secret that is unredacted (before it is escaped or
+// wrapped). For example, a caller can use the reported
+// secrets to mask them in a command's output.
+func ReportSecrets(f func(secret string)) UnredactTokensOption {
+	return func(c *UnredactTokensConfig) {
+		c.onSecret = f
+	}
+}
+
+// ReportSecretSources is like ReportSecrets, but also
+// passes f a description of the token that each secret
+// came from, like "vault:secret/data/db#password". The
+// description never holds the secret, so it can be
+// logged, for example to say which secret has changed.
+func ReportSecretSources(f func(source, secret string)) UnredactTokensOption {
+	return func(c *UnredactTokensConfig) {
+		c.onSource = f
+	}
+}
+
 // WrapTokens requests that unredacted secrets be wrapped
 // in secret envelopes (ideally in the format
 // understood by the corresponding redacter)
@@ -53,8 +83,33 @@ func WrapTokens(c *UnredactTokensConfig) {
 	c.wrapTokens = true
 }
 
+// EscapeFor requests that unredacted secrets be escaped
+// for the syntactic context of each token in a document of
+// the given format. For example, in a JSON document:
+//
+//   {"password": "~~redacted-aes:...~~"}
+//
+// a secret like `my"secret` is unredacted as:
+//
+//   {"password": "my\"secret"}
+//
+// Secrets which can't be written into their context (like a
+// line break into a single-quoted YAML string) are an error.
+// Wrapped tokens (see WrapTokens) are not escaped.
+func EscapeFor(f escape.Format) UnredactTokensOption {
+	return func(c *UnredactTokensConfig) {
+		c.format = f
+	}
+}
+
 // A CompositeTokenRedacter looks for secret tokens
-// within text, and redacts them
+// within text, and redacts them.
+//
+// If the Locator is a ContextTokenLocator, tokens may be
+// bound to a context label, like ~~redact[db-password]:hunter2~~.
+// Labelled tokens are redacted with a ContextRedacter,
+// and wrapped with a ContextTokenWrapper, so that the
+// label is kept in the redacted token.
 type CompositeTokenRedacter struct {
 	Redacter Redacter
 	Locator  TokenLocator
@@ -62,7 +117,11 @@ type CompositeTokenRedacter struct {
 }
 
 // A CompositeTokenUnredacter looks for redacted secret tokens
-// within text, and unredacts them
+// within text, and unredacts them.
+//
+// As with CompositeTokenRedacter, tokens may be bound to a
+// context label, in which case they are unredacted with
+// a ContextUnredacter.
 type CompositeTokenUnredacter struct {
 	Unredacter Unredacter
 	Locator    TokenLocator
@@ -71,67 +130,209 @@ type CompositeTokenUnredacter struct {
 
 // RedactTokens looks for secret tokens within text, and redacts them
 func (e *CompositeTokenRedacter) RedactTokens(s string) (string, error) {
-	locations, err := e.Locator.LocateTokens(s)
+	locations, err := locateContextTokens(e.Locator, s)
 	if err != nil {
 		return "", fmt.Errorf("failed to locate tokens: %v", err)
 	}
 
-	// walk through the matches in reverse order;
-	// we'll be cutting and inserting, and this
-	// simplifies the calculation
+	// walk through the matches in reverse order,
+	// collecting the replacement for each token
+	replacements := make([]string, len(locations))
 	for i := len(locations) - 1; i >= 0; i-- {
 		location := locations[i]
 		payload := s[location.PayloadStart:location.PayloadEnd]
 		envelope := s[location.EnvelopeStart:location.EnvelopeEnd]
 
-		redacted, err := e.Redacter.Redact(payload)
+		redacted, err := redactInContext(e.Redacter, payload, location.Context)
 		if err != nil {
 			return "", fmt.Errorf("failed to redact: %v", err)
 		}
 
-		// Cut the placeholder out of the original plaintext,
-		// and replace it with the new ciphertext
-		wrappedToken := e.Wrapper.WrapToken(redacted, payload, envelope)
-		s = s[:location.EnvelopeStart] + wrappedToken + s[location.EnvelopeEnd:]
+		wrappedToken, err := wrapInContext(e.Wrapper, redacted, location.Context, payload, envelope)
+		if err != nil {
+			return "", err
+		}
+		replacements[i] = wrappedToken
 	}
 
-	return s, nil
+	return replaceLocations(s, locations, replacements), nil
 }
 
 // UnredactTokens looks for redacted secret tokens within text, and unredacts them
 func (d *CompositeTokenUnredacter) UnredactTokens(s string, opts ...UnredactTokensOption) (string, error) {
-	conf := &UnredactTokensConfig{}
-	for _, o := range opts {
-		o(conf)
-	}
+	conf := newUnredactTokensConfig(opts...)
+	return d.unredactTokens(s, conf, escape.NewScanner(conf.format))
+}
 
-	locations, err := d.Locator.LocateTokens(s)
+// unredactTokens unredacts the tokens in s, which
+// continues the document followed by sc
+func (d *CompositeTokenUnredacter) unredactTokens(s string, conf *UnredactTokensConfig, sc *escape.Scanner) (string, error) {
+	locations, err := locateContextTokens(d.Locator, s)
 	if err != nil {
 		return "", fmt.Errorf("failed to locate tokens: %v", err)
 	}
 
-	// walk through the matches in reverse order;
-	// we'll be cutting and inserting, and this
-	// simplifies the calculation
+	// walk through the matches in reverse order,
+	// collecting the replacement for each token
+	replacements := make([]string, len(locations))
 	for i := len(locations) - 1; i >= 0; i-- {
 		location := locations[i]
 		payload := s[location.PayloadStart:location.PayloadEnd]
 		envelope := s[location.EnvelopeStart:location.EnvelopeEnd]
 
-		redacted, err := d.Unredacter.Unredact(payload)
+		redacted, err := unredactInContext(d.Unredacter, payload, location.Context)
 		if err != nil {
 			return "", err
 		}
+		conf.reportSecret(envelope, redacted)
 
 		ins := redacted
 		if conf.wrapTokens && d.Wrapper != nil {
-			ins = d.Wrapper.WrapToken(redacted, payload, envelope)
+			ins, err = wrapInContext(d.Wrapper, redacted, location.Context, payload, envelope)
+			if err != nil {
+				return "", err
+			}
+		}
+		replacements[i] = ins
+	}
+
+	if !conf.wrapTokens || d.Wrapper == nil {
+		if err := escapeReplacements(sc, s, locations, replacements, nil); err != nil {
+			return "", err
+		}
+	}
+
+	return replaceLocations(s, locations, replacements), nil
+}
+
+// RedactStream looks for secret tokens within a stream,
+// and writes it to w with the tokens redacted. The output
+// is the same as from RedactTokens, but r is read through
+// a bounded buffer rather than all at once.
+//
+// Tokens longer than MaxStreamTokenSize may not be
+// found if they straddle the edge of the buffer.
+func (e *CompositeTokenRedacter) RedactStream(r io.Reader, w io.Writer) error {
+	return streamTokens(r, w, e.Locator, e.RedactTokens)
+}
+
+// UnredactStream looks for redacted secret tokens within
+// a stream, and writes it to w with the tokens unredacted.
+// The output is the same as from UnredactTokens, but r is
+// read through a bounded buffer rather than all at once.
+//
+// Tokens longer than MaxStreamTokenSize may not be
+// found if they straddle the edge of the buffer.
+func (d *CompositeTokenUnredacter) UnredactStream(r io.Reader, w io.Writer, opts ...UnredactTokensOption) error {
+	conf := newUnredactTokensConfig(opts...)
+	sc := escape.NewScanner(conf.format)
+	return streamTokens(r, w, d.Locator, func(s string) (string, error) {
+		return d.unredactTokens(s, conf, sc)
+	})
+}
+
+// newUnredactTokensConfig applies options
+// to a new UnredactTokensConfig
+func newUnredactTokensConfig(opts ...UnredactTokensOption) *UnredactTokensConfig {
+	conf := &UnredactTokensConfig{}
+	for _, o := range opts {
+		o(conf)
+	}
+	return conf
+}
+
+// reportSecret passes an unredacted secret, and the
+// source it came from, to the ReportSecrets and
+// ReportSecretSources callbacks, if there are any
+func (c *UnredactTokensConfig) reportSecret(source, secret string) {
+	if c.onSecret != nil {
+		c.onSecret(secret)
+	}
+	if c.onSource != nil {
+		c.onSource(source, secret)
+	}
+}
+
+// escapeReplacements escapes each replacement for the
+// syntactic context of the token that it replaces, and
+// moves sc to the end of s. Tokens which are marked to
+// skip are left as they are.
+func escapeReplacements(sc *escape.Scanner, s string, locations []ContextTokenLocation, replacements []string, skip []bool) error {
+	prev := 0
+	for i, location := range locations {
+		sc.Scan(s[prev:location.EnvelopeStart])
+		prev = location.EnvelopeEnd
+		if skip != nil && skip[i] {
+			sc.Skip(s[location.EnvelopeStart:location.EnvelopeEnd])
+			continue
 		}
+		escaped, err := sc.Escape(replacements[i], escape.RestOfLine(s, location.EnvelopeEnd))
+		if err != nil {
+			return fmt.Errorf("failed to escape the secret in token %v: %v", s[location.EnvelopeStart:location.EnvelopeEnd], err)
+		}
+		replacements[i] = escaped
+	}
+	sc.Scan(s[prev:])
+	return nil
+}
+
+// replaceLocations replaces each located token in s
+// with the corresponding replacement
+func replaceLocations(s string, locations []ContextTokenLocation, replacements []string) string {
+	if len(locations) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	prev := 0
+	for i, location := range locations {
+		b.WriteString(s[prev:location.EnvelopeStart])
+		b.WriteString(replacements[i])
+		prev = location.EnvelopeEnd
+	}
+	b.WriteString(s[prev:])
+	return b.String()
+}
 
-		// Cut the placeholder out of the original plaintext,
-		// and replace it with the new ciphertext
-		s = s[:location.EnvelopeStart] + ins + s[location.EnvelopeEnd:]
+// redactInContext redacts a payload. If the payload is
+// bound to a context label, the Redacter must be a
+// ContextRedacter.
+func redactInContext(r Redacter, payload, context string) (string, error) {
+	if context == "" {
+		return r.Redact(payload)
 	}
+	cr, ok := r.(ContextRedacter)
+	if !ok {
+		return "", fmt.Errorf("redacter does not support context labels (token is labelled %q)", context)
+	}
+	return cr.RedactWithContext(payload, context)
+}
+
+// unredactInContext unredacts a payload. If the payload
+// is bound to a context label, the Unredacter must be
+// a ContextUnredacter.
+func unredactInContext(u Unredacter, payload, context string) (string, error) {
+	if context == "" {
+		return u.Unredact(payload)
+	}
+	cu, ok := u.(ContextUnredacter)
+	if !ok {
+		return "", fmt.Errorf("unredacter does not support context labels (token is labelled %q)", context)
+	}
+	return cu.UnredactWithContext(payload, context)
+}
 
-	return s, nil
+// wrapInContext wraps a token. If the token is bound to a
+// context label, the TokenWrapper must be a ContextTokenWrapper,
+// so that the label is not lost.
+func wrapInContext(w TokenWrapper, token, context, payload, envelope string) (string, error) {
+	if context == "" {
+		return w.WrapToken(token, payload, envelope), nil
+	}
+	cw, ok := w.(ContextTokenWrapper)
+	if !ok {
+		return "", fmt.Errorf("wrapper does not support context labels (token is labelled %q)", context)
+	}
+	return cw.WrapContextToken(token, context, payload, envelope), nil
 }
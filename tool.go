@@ -1,14 +1,20 @@
 package redactr
 
 import (
-	"encoding/base64"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-	"regexp"
+	"strings"
+	"time"
 
 	"github.com/dhoelle/redactr/aes"
+	"github.com/dhoelle/redactr/escape"
 	"github.com/dhoelle/redactr/exec"
+	"github.com/dhoelle/redactr/plugin"
 	"github.com/dhoelle/redactr/vault"
+	"github.com/dhoelle/redactr/watch"
 	"github.com/hashicorp/vault/api"
 )
 
@@ -16,11 +22,27 @@ import (
 // If you want to use redactr as a library, you probably
 // want to create and use a Tool.
 type Tool struct {
-	SecretUnredacter TokenUnredacter
-	VaultUnredacter  TokenUnredacter
+	// Providers redact and unredact tokens, like
+	// ~~redact:hunter2~~ (handled by "aes", the default
+	// provider) or ~~redacted-vault:path#key~~.
+	// Register more with the RegisterProvider option.
+	Providers *Registry
 
-	SecretRedacter TokenRedacter
-	VaultRedacter  TokenRedacter
+	// keyEnvVars are the names of environment variables
+	// which hold key material. Exec removes them from
+	// the command's environment.
+	keyEnvVars []string
+
+	// aesKeys are the keys of the "aes" provider
+	// (or nil, if none were configured), which
+	// RekeyTokens decrypts secrets with
+	aesKeys *aes.Keyring
+
+	// aesKeyFiles are the files which aesKeys were
+	// loaded from (see AESKeyFile). Exec watches
+	// them, and adds the keys which are added to
+	// them to aesKeys.
+	aesKeyFiles []string
 }
 
 // New creates a new Tool
@@ -30,27 +52,23 @@ func New(opts ...NewToolOption) (*Tool, error) {
 		o(c)
 	}
 
-	t := &Tool{}
+	t := &Tool{
+		Providers:  NewRegistry("aes"),
+		keyEnvVars: c.keyEnvVars,
+	}
 
 	//
 	// AES redacter
 	//
-	if c.aesKey != "" {
-		key, err := keyFromString(c.aesKey)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse AES key: %v", err)
-		}
-
-		t.SecretRedacter = &CompositeTokenRedacter{
-			Locator:  &RegexTokenLocator{RE: regexp.MustCompile(`(?U)~~redact:(.+)~~`)},
-			Redacter: &aes.Redacter{Key: key},
-			Wrapper:  &StringWrapper{Before: "~~redacted-aes:", After: "~~"},
-		}
-
-		t.SecretUnredacter = &CompositeTokenUnredacter{
-			Locator:    &RegexTokenLocator{RE: regexp.MustCompile(`(?U)~~redacted-aes:(.+)~~`)},
-			Unredacter: &aes.Redacter{Key: key},
-			Wrapper:    &StringWrapper{Before: "~~redact:", After: "~~"},
+	keyring, err := c.aesKeyring()
+	if err != nil {
+		return nil, err
+	}
+	if keyring != nil {
+		t.aesKeys = keyring
+		t.aesKeyFiles = c.aesKeyFiles
+		if err := t.Providers.Register("aes", &aes.KeyringRedacter{Keyring: keyring}); err != nil {
+			return nil, err
 		}
 	}
 
@@ -61,17 +79,55 @@ func New(opts ...NewToolOption) (*Tool, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Vault client: %v", err)
 	}
-	vaultWrapper := &vault.StandardClientWrapper{Client: vaultClient}
-	vaultRedacter := vault.NewRedacter(vaultWrapper)
-	t.VaultUnredacter = &CompositeTokenUnredacter{
-		Locator:    &RegexTokenLocator{RE: vault.RedactedRE},
-		Unredacter: vaultRedacter,
-		Wrapper:    &vault.TokenWrapper{Before: "~~redact-vault:", After: "~~"},
+	standardWrapper := &vault.StandardClientWrapper{Client: vaultClient}
+	var vaultWrapper vault.Client = standardWrapper
+	var leaseClient vault.LeaseClient = standardWrapper
+	var transitClient vault.TransitClient = standardWrapper
+	if c.vaultAuth != nil {
+		authWrapper := vault.NewAuthClientWrapper(vaultClient, c.vaultAuth)
+		vaultWrapper, leaseClient, transitClient = authWrapper, authWrapper, authWrapper
+	}
+	var vaultOpts []vault.RedacterOption
+	if c.vaultLatest {
+		vaultOpts = append(vaultOpts, vault.LatestVersions)
 	}
-	t.VaultRedacter = &CompositeTokenRedacter{
-		Locator:  &RegexTokenLocator{RE: vault.UnredactedRE},
-		Redacter: vaultRedacter,
-		Wrapper:  &StringWrapper{Before: "~~redacted-vault:", After: "~~"},
+	if err := t.Providers.Register("vault", vault.NewRedacter(vaultWrapper, vaultOpts...)); err != nil {
+		return nil, err
+	}
+	if err := t.Providers.Register("vault-dynamic", vault.NewDynamicRedacter(leaseClient)); err != nil {
+		return nil, err
+	}
+	if err := t.Providers.Register("vault-transit", vault.NewTransitRedacter(transitClient, c.vaultTransitMount)); err != nil {
+		return nil, err
+	}
+
+	//
+	// Other providers
+	//
+	for _, p := range c.providers {
+		if err := t.Providers.Register(p.name, p.provider); err != nil {
+			return nil, fmt.Errorf("failed to register provider: %v", err)
+		}
+	}
+
+	//
+	// Plugins, which are launched when they are
+	// first used. Providers which are already
+	// registered take precedence.
+	//
+	if c.discoverPlugins {
+		plugins, err := plugin.Discover(c.pluginDirs...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover plugins: %v", err)
+		}
+		for name, path := range plugins {
+			if _, ok := t.Providers.Provider(name); ok {
+				continue
+			}
+			if err := t.Providers.Register(name, plugin.NewClient(name, path)); err != nil {
+				return nil, fmt.Errorf("failed to register plugin %v: %v", path, err)
+			}
+		}
 	}
 
 	return t, nil
@@ -79,61 +135,245 @@ func New(opts ...NewToolOption) (*Tool, error) {
 
 // NewToolConfig is used to configure a Tool created by New()
 type NewToolConfig struct {
-	aesKey string
+	aesKey            string
+	aesKeySources     []keySource
+	aesKeyFiles       []string
+	aesPassphrase     string
+	aesKeyDescriptor  string
+	keyEnvVars        []string
+	vaultAuth         vault.Authenticator
+	vaultLatest       bool
+	vaultTransitMount string
+	providers         []namedProvider
+	discoverPlugins   bool
+	pluginDirs        []string
+}
+
+// aesKeyring loads the AES keys configured by AESKey,
+// AESKeyring, AESKeyFile, AESKeyFD, AESKeyCommand and
+// AESPassphrase. It returns nil if none were configured.
+func (c *NewToolConfig) aesKeyring() (*aes.Keyring, error) {
+	if c.aesKey == "" && len(c.aesKeySources) == 0 && c.aesPassphrase == "" && c.aesKeyDescriptor == "" {
+		return nil, nil
+	}
+
+	var specs []string
+	for _, source := range c.aesKeySources {
+		ss, err := source()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AES keys: %v", err)
+		}
+		specs = append(specs, ss...)
+	}
+
+	keyring, err := newKeyring(c.aesKey, specs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AES keys: %v", err)
+	}
+	if keyring.Len() == 0 && c.aesPassphrase == "" && c.aesKeyDescriptor == "" {
+		return nil, fmt.Errorf("failed to load AES keys: no keys found")
+	}
+
+	if c.aesPassphrase != "" || c.aesKeyDescriptor != "" {
+		id, key, err := passphraseKey(c.aesPassphrase, c.aesKeyDescriptor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive AES key from passphrase: %v", err)
+		}
+		if err := addKey(keyring, id, key); err != nil {
+			return nil, fmt.Errorf("failed to add passphrase-derived AES key: %v", err)
+		}
+	}
+	return keyring, nil
+}
+
+// A namedProvider is a Provider, and the
+// name that it should be registered under
+type namedProvider struct {
+	name     string
+	provider Provider
 }
 
 // NewToolOption configures a Tool on a call to New()
 type NewToolOption func(*NewToolConfig)
 
-// AESKey sets the key used for AES encryption and decryption
+// AESKey sets the primary key used for AES encryption and
+// decryption.
+//
+// Keys are base64-encoded, and may be prefixed with
+// an ID, like "my-key:xuY6/V0ZE29RtPD3TNWga/EkdU3XYsPtBIk8U4nzZyc=".
+// If no ID is given, one is derived from the key.
 func AESKey(key string) NewToolOption {
 	return func(c *NewToolConfig) {
 		c.aesKey = key
 	}
 }
 
-// RedactTokens redacts all tokens in a string
-func (t *Tool) RedactTokens(s string) (string, error) {
-	var err error
-
-	if t.SecretRedacter != nil {
-		s, err = t.SecretRedacter.RedactTokens(s)
-		if err != nil {
-			return "", fmt.Errorf("secret redacter failed: %v", err)
+// AESKeyring adds keys to the AES keyring. Any key in the
+// keyring may be used to decrypt secrets.
+//
+// Keys take the same form as in AESKey, and each argument
+// may hold several keys separated by commas or whitespace.
+// If AESKey is not set, the first key in the keyring is the
+// primary key, which is used to encrypt new secrets.
+func AESKeyring(keys ...string) NewToolOption {
+	return func(c *NewToolConfig) {
+		var specs []string
+		for _, k := range keys {
+			specs = append(specs, splitKeySpecs(k)...)
 		}
+		if len(specs) == 0 {
+			return
+		}
+		c.aesKeySources = append(c.aesKeySources, func() ([]string, error) {
+			return specs, nil
+		})
 	}
+}
 
-	if t.VaultRedacter != nil {
-		s, err = t.VaultRedacter.RedactTokens(s)
-		if err != nil {
-			return "", fmt.Errorf("vault redacter failed: %v", err)
-		}
+// AESKeyFile adds the keys in a file to the AES keyring.
+// The file holds one or more keys, in the same form as
+// AESKeyring, separated by commas or whitespace.
+//
+// The file must not be readable or writable by anyone
+// but its owner (e.g. mode 0600).
+func AESKeyFile(filename string) NewToolOption {
+	return func(c *NewToolConfig) {
+		c.aesKeyFiles = append(c.aesKeyFiles, filename)
+		c.aesKeySources = append(c.aesKeySources, func() ([]string, error) {
+			return keysFromFile(filename)
+		})
 	}
+}
 
-	return s, nil
+// AESKeyFD adds the keys read from an inherited file
+// descriptor to the AES keyring, like:
+//
+//    redactr --key-fd 3 redact 3< <(pass show redactr)
+//
+// The file descriptor is read to EOF and closed.
+func AESKeyFD(fd int) NewToolOption {
+	return func(c *NewToolConfig) {
+		c.aesKeySources = append(c.aesKeySources, func() ([]string, error) {
+			return keysFromFD(fd)
+		})
+	}
 }
 
-// UnredactTokens unredacts all tokens in a string
-func (t *Tool) UnredactTokens(s string, opts ...UnredactTokensOption) (string, error) {
-	var err error
+// AESKeyCommand adds keys to the AES keyring by running
+// a command (with "sh -c"). The command's stdout should
+// hold one or more keys, and its stderr is passed through.
+func AESKeyCommand(command string) NewToolOption {
+	return func(c *NewToolConfig) {
+		c.aesKeySources = append(c.aesKeySources, func() ([]string, error) {
+			return keysFromCommand(command)
+		})
+	}
+}
 
-	if t.SecretUnredacter != nil {
-		sc := s
-		s, err = t.SecretUnredacter.UnredactTokens(sc, opts...)
-		if err != nil {
-			return "", fmt.Errorf("failed to unredact secret token %v: %v", sc, err)
-		}
+// KeyEnvVars names environment variables which hold key
+// material, or which tell redactr where to find it (like
+// AES_KEY or AES_KEY_FILE). Exec removes them from the
+// environment of the command that it runs, unless it
+// is called with the KeepKeyEnv option.
+func KeyEnvVars(names ...string) NewToolOption {
+	return func(c *NewToolConfig) {
+		c.keyEnvVars = append(c.keyEnvVars, names...)
 	}
+}
 
-	if t.VaultUnredacter != nil {
-		sc := s
-		s, err = t.VaultUnredacter.UnredactTokens(sc, opts...)
-		if err != nil {
-			return "", fmt.Errorf("failed to unredact vault token %v: %v", sc, err)
-		}
+// AESPassphrase derives an AES key from a passphrase,
+// using the KDF parameters (salt and cost) in a key
+// descriptor file. Key descriptors can be created
+// with `redactr keygen --type passphrase`.
+//
+// The derived key is added to the AES keyring. It is the
+// primary key unless AESKey or AESKeyring are also set.
+func AESPassphrase(passphrase, descriptorFile string) NewToolOption {
+	return func(c *NewToolConfig) {
+		c.aesPassphrase = passphrase
+		c.aesKeyDescriptor = descriptorFile
+	}
+}
+
+// VaultAuth logs in to Vault with an Authenticator (like
+// vault.AppRole or vault.Kubernetes), instead of using the
+// token in VAULT_TOKEN. The token is renewed before it
+// expires, and Vault is logged in to again if it rejects
+// the token.
+func VaultAuth(a vault.Authenticator) NewToolOption {
+	return func(c *NewToolConfig) {
+		c.vaultAuth = a
 	}
+}
+
+// VaultLatestVersions tells the Tool to read the latest
+// version of Vault secrets, even if a token pins a secret
+// to a version (like ~~redacted-vault:path#key@7~~), and to
+// redact secrets without pinning them to a version.
+func VaultLatestVersions(c *NewToolConfig) {
+	c.vaultLatest = true
+}
 
-	return s, nil
+// VaultTransitMount sets the path that Vault's transit
+// secrets engine is mounted at, for the "vault-transit"
+// provider (by default, "transit")
+func VaultTransitMount(mount string) NewToolOption {
+	return func(c *NewToolConfig) {
+		c.vaultTransitMount = mount
+	}
+}
+
+// RegisterProvider registers a Provider with the Tool, to
+// handle tokens with the given name. For example, a Provider
+// registered as "gcp-kms" would redact ~~redact-gcp-kms:...~~
+// tokens, and unredact ~~redacted-gcp-kms:...~~ tokens.
+func RegisterProvider(name string, p Provider) NewToolOption {
+	return func(c *NewToolConfig) {
+		c.providers = append(c.providers, namedProvider{name: name, provider: p})
+	}
+}
+
+// DiscoverPlugins registers provider plugins: executables
+// named redactr-provider-<name>, found in the given
+// directories or on PATH. Plugins are launched when they
+// are first used, and stopped by Tool.Close.
+//
+// Plugins do not replace built-in providers, or providers
+// registered with RegisterProvider.
+func DiscoverPlugins(dirs ...string) NewToolOption {
+	return func(c *NewToolConfig) {
+		c.discoverPlugins = true
+		c.pluginDirs = append(c.pluginDirs, dirs...)
+	}
+}
+
+// Close stops any plugins that the Tool launched
+func (t *Tool) Close() error {
+	return t.Providers.Close()
+}
+
+// RedactTokens redacts all tokens in a string
+func (t *Tool) RedactTokens(s string) (string, error) {
+	return t.Providers.RedactTokens(s)
+}
+
+// UnredactTokens unredacts all tokens in a string
+func (t *Tool) UnredactTokens(s string, opts ...UnredactTokensOption) (string, error) {
+	return t.Providers.UnredactTokens(s, opts...)
+}
+
+// RedactStream redacts all tokens in a stream. Its output
+// is the same as from RedactTokens, but it reads r through
+// a bounded buffer, rather than all at once.
+func (t *Tool) RedactStream(r io.Reader, w io.Writer) error {
+	return t.Providers.RedactStream(r, w)
+}
+
+// UnredactStream unredacts all tokens in a stream. Its output
+// is the same as from UnredactTokens, but it reads r through
+// a bounded buffer, rather than all at once.
+func (t *Tool) UnredactStream(r io.Reader, w io.Writer, opts ...UnredactTokensOption) error {
+	return t.Providers.UnredactStream(r, w, opts...)
 }
 
 // Exec executes a command. It acts like os.Exec,
@@ -143,20 +383,210 @@ func (t *Tool) UnredactTokens(s string, opts ...UnredactTokensOption) (string, e
 //  1. Before running the command, redacted secrets
 //     in the environment will be unredacted.
 //
-//  2. When called with the RestartIfEnvChanges or
-//     StopIfEnvChanges option, Exec will periodically
-//     re-evaluate the environment. If the environment
-//     has changed, Exec will restart or stop the command
-//     as requested.
+//  2. When called with the RestartIfEnvChanges,
+//     StopIfEnvChanges or SignalIfEnvChanges option,
+//     Exec will re-evaluate the environment when its
+//     secrets may have changed. If the environment
+//     has changed, Exec will restart, stop or signal
+//     the command as requested.
+//
+//     Secrets are watched by their providers, where
+//     they can be (see PayloadWatcher): for example,
+//     AES secrets never change, and Vault secrets are
+//     checked by their version. Redacted files named
+//     in args, and AES key files (see AESKeyFile), are
+//     watched for changes; keys which are added to a
+//     key file are added to the keyring. Other secrets
+//     are polled (see PollInterval).
+//
+//  3. Leased secrets (like those of the "vault-dynamic"
+//     provider) are renewed while the command runs, and
+//     revoked when it exits (see LeaseRevoker). When a
+//     lease nears its max TTL, its secrets change, so
+//     the command is restarted or signalled as in 2 (or,
+//     if Exec wasn't asked to act on changes, restarted).
+//     A replaced lease is revoked when the command is
+//     restarted (see RetiredLeaseRevoker).
+//
+// Environment variables which hold key material (see
+// KeyEnvVars) are removed from the command's environment,
+// unless Exec is called with the KeepKeyEnv option.
+//
+// With the MaskOutput option, unredacted secrets are
+// masked in the command's output and errors.
+//
+// Signals which the current process receives (see
+// exec.ForwardedSignals) are forwarded to the command.
+// If the command fails, Exec returns an *exec.ExitError
+// with its exit code.
 func (t *Tool) Exec(name string, args []string, opts ...ExecOption) error {
+	conf := &ExecConfig{}
+	for _, o := range opts {
+		o(conf)
+	}
+
+	env := os.Environ()
+	if !conf.keepKeyEnv {
+		env = withoutEnvVars(env, t.keyEnvVars...)
+	}
+	for _, path := range conf.envFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open env file: %v", err)
+		}
+		fileEnv, err := exec.ParseEnvFile(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %v: %v", path, err)
+		}
+		env = append(env, fileEnv.Strings()...)
+	}
+	for _, kv := range conf.env {
+		if !strings.Contains(kv, "=") {
+			return fmt.Errorf("invalid variable %q: expected NAME=value", kv)
+		}
+		env = append(env, kv)
+	}
+
 	runner := exec.NewRunner(
 		os.Stdin,
 		os.Stdout,
-		os.Environ(),
+		os.Stderr,
+		env,
 		toolUnredactReplacer(*t),
 		name,
 		args...)
-	return Exec(runner, opts...)
+	if conf.maskPlaceholder != "" {
+		runner.MaskOutput(conf.maskPlaceholder)
+	}
+	if conf.secretFiles {
+		runner.SecretFiles()
+	}
+	if conf.tty {
+		runner.TTY()
+	}
+	if conf.stopSignal != nil {
+		runner.StopSignal(conf.stopSignal, conf.stopGracePeriod)
+	}
+	runner.ForwardSignals(exec.ForwardedSignals...)
+
+	if !conf.watching {
+		watchOpts, err := t.watchChanges(conf, env, args)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, watchOpts...)
+	}
+	err := Exec(runner, opts...)
+
+	// the command has exited, so the leases
+	// of its dynamic secrets can be revoked
+	if revokeErr := t.Providers.RevokeLeases(); revokeErr != nil && err == nil {
+		err = revokeErr
+	}
+	return err
+}
+
+// watchChanges builds the ExecOptions which watch the
+// secrets in a command's environment, args and redacted
+// files for changes, and poll the secrets of providers
+// which can't be watched.
+//
+// Leased secrets are watched even if Exec wasn't asked to
+// act on changes, since their leases can't be renewed
+// forever: the command is restarted when they change.
+func (t *Tool) watchChanges(conf *ExecConfig, env, args []string) ([]ExecOption, error) {
+	docs := append(append([]string{}, env...), args...)
+	files := exec.RedactedFiles(args)
+	for _, path := range files {
+		// unreadable files are reported by the runner
+		if b, err := ioutil.ReadFile(path); err == nil {
+			docs = append(docs, string(b))
+		}
+	}
+
+	if conf.onEnvChange == DoNothing {
+		watchers, err := t.Providers.leaseWatchers(docs, conf.pollInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to watch leased secrets: %v", err)
+		}
+		if len(watchers) == 0 {
+			return nil, nil
+		}
+		restart := func(c *ExecConfig) { c.onEnvChange = Restart }
+		return []ExecOption{restart, WatchChanges(0, watchers...)}, nil
+	}
+
+	watchers, unwatched, err := t.Providers.Watchers(docs, conf.pollInterval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch secrets: %v", err)
+	}
+	if len(files) > 0 {
+		watchers = append(watchers, watch.Files(conf.reevaluationFreq, files...))
+	}
+	if t.aesKeys != nil && len(t.aesKeyFiles) > 0 {
+		watchers = append(watchers, t.watchKeyFiles(conf.reevaluationFreq))
+	}
+
+	// poll as often as the most
+	// frequently-polled provider
+	var poll time.Duration
+	for _, name := range unwatched {
+		if d := conf.pollInterval(name); poll == 0 || d < poll {
+			poll = d
+		}
+	}
+	return []ExecOption{WatchChanges(poll, watchers...)}, nil
+}
+
+// watchKeyFiles returns a Watcher for the files which
+// the AES keys were loaded from. When one changes, the
+// keys which were added to it are added to the keyring
+// before the change is reported, so that secrets which
+// were redacted with them can be unredacted.
+func (t *Tool) watchKeyFiles(interval time.Duration) watch.Watcher {
+	files := watch.Files(interval, t.aesKeyFiles...)
+	return watch.Func(func(ctx context.Context, changed func()) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var loadErr error
+		err := files.Watch(ctx, func() {
+			if loadErr = t.loadKeyFiles(); loadErr != nil {
+				cancel()
+				return
+			}
+			changed()
+		})
+		if loadErr != nil {
+			return loadErr
+		}
+		return err
+	})
+}
+
+// withoutEnvVars removes the named variables
+// from an environment array
+func withoutEnvVars(env []string, names ...string) []string {
+	if len(names) == 0 {
+		return env
+	}
+	remove := make(map[string]bool, len(names))
+	for _, name := range names {
+		remove[name] = true
+	}
+
+	var kept []string
+	for _, kv := range env {
+		name := kv
+		if i := strings.Index(kv, "="); i >= 0 {
+			name = kv[:i]
+		}
+		if !remove[name] {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
 }
 
 // A toolUnredactReplacer uses a Tool to replace
@@ -170,17 +600,60 @@ func (r toolUnredactReplacer) Replace(s string) (string, error) {
 	return t.UnredactTokens(s)
 }
 
-func keyFromString(s string) (*[32]byte, error) {
-	// keys should be base64 redacted
-	d, err := base64.StdEncoding.DecodeString(s)
+// ReplaceFormat will replace any redacted tokens
+// in the given string with unredacted values,
+// escaped for the format of the string
+func (r toolUnredactReplacer) ReplaceFormat(s string, f escape.Format) (string, error) {
+	t := Tool(r)
+	if f == escape.Raw {
+		return t.UnredactTokens(s)
+	}
+	return t.UnredactTokens(s, EscapeFor(f))
+}
+
+// BeginRender begins rendering a command's inputs
+// (see exec.ConsistentReplacer)
+func (r toolUnredactReplacer) BeginRender() (end func()) {
+	return r.Providers.BeginRender()
+}
+
+// ReleaseUnused revokes the leases which were replaced
+// before the command (re)started (see exec.ReleasingReplacer).
+// Leases which can't be revoked now are revoked when the
+// command exits, where a failure is reported.
+func (r toolUnredactReplacer) ReleaseUnused() {
+	r.Providers.RevokeRetiredLeases()
+}
+
+// ReplaceSecrets will replace any redacted tokens
+// in the given string with unredacted values, escaped
+// for the format of the string, and return the
+// unredacted secrets
+func (r toolUnredactReplacer) ReplaceSecrets(s string, f escape.Format) (string, []string, error) {
+	t := Tool(r)
+	var secrets []string
+	replaced, err := t.UnredactTokens(s,
+		EscapeFor(f),
+		ReportSecrets(func(secret string) { secrets = append(secrets, secret) }))
 	if err != nil {
-		return nil, fmt.Errorf("could not base64-unredact key: %v", err)
+		return "", nil, err
 	}
+	return replaced, secrets, nil
+}
 
-	if len(d) != 32 {
-		return nil, fmt.Errorf("key must be exactly 32 bytes (got %v)", len(d))
+// ReplaceSources is like ReplaceSecrets, but also
+// reports the source of each secret (see
+// ReportSecretSources)
+func (r toolUnredactReplacer) ReplaceSources(s string, f escape.Format) (string, []exec.Secret, error) {
+	t := Tool(r)
+	var secrets []exec.Secret
+	replaced, err := t.UnredactTokens(s,
+		EscapeFor(f),
+		ReportSecretSources(func(source, secret string) {
+			secrets = append(secrets, exec.Secret{Source: source, Value: secret})
+		}))
+	if err != nil {
+		return "", nil, err
 	}
-	b := &[32]byte{}
-	copy(b[:], d)
-	return b, nil
+	return replaced, secrets, nil
 }
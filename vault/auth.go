@@ -0,0 +1,409 @@
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// An Authenticator logs in to Vault. Login returns
+// the response to the login request, whose Auth
+// holds the client token and its lease.
+type Authenticator interface {
+	Login(client *api.Client) (*api.Secret, error)
+}
+
+// AppRole logs in with the AppRole auth method
+type AppRole struct {
+	RoleID   string
+	SecretID string
+
+	// Mount is the path that the auth method
+	// is mounted at (by default, "approle")
+	Mount string
+}
+
+// Login logs in with the role and secret IDs
+func (a *AppRole) Login(client *api.Client) (*api.Secret, error) {
+	return login(client, mountOrDefault(a.Mount, "approle"), "", map[string]interface{}{
+		"role_id":   a.RoleID,
+		"secret_id": a.SecretID,
+	})
+}
+
+// DefaultKubernetesJWTFile is where Kubernetes
+// mounts a pod's service account token
+const DefaultKubernetesJWTFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// Kubernetes logs in with the Kubernetes auth method,
+// using a service account token (a JWT)
+type Kubernetes struct {
+	// Role is the Vault role to log in as
+	Role string
+
+	// JWTFile holds the service account token (by
+	// default, DefaultKubernetesJWTFile). It is read
+	// on every login, as Kubernetes rotates it.
+	JWTFile string
+
+	// Mount is the path that the auth method
+	// is mounted at (by default, "kubernetes")
+	Mount string
+}
+
+// Login logs in with the service account token
+func (a *Kubernetes) Login(client *api.Client) (*api.Secret, error) {
+	jwtFile := a.JWTFile
+	if jwtFile == "" {
+		jwtFile = DefaultKubernetesJWTFile
+	}
+	jwt, err := readTokenFile(jwtFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %v", err)
+	}
+	return login(client, mountOrDefault(a.Mount, "kubernetes"), "", map[string]interface{}{
+		"role": a.Role,
+		"jwt":  jwt,
+	})
+}
+
+// UserPass logs in with the userpass auth method
+type UserPass struct {
+	Username string
+	Password string
+
+	// Mount is the path that the auth method
+	// is mounted at (by default, "userpass")
+	Mount string
+}
+
+// Login logs in with the username and password
+func (a *UserPass) Login(client *api.Client) (*api.Secret, error) {
+	return login(client, mountOrDefault(a.Mount, "userpass"), a.Username, map[string]interface{}{
+		"password": a.Password,
+	})
+}
+
+// TokenFile reads a token from a file, like the
+// sink of a Vault Agent. The file is read again
+// whenever Vault rejects the token.
+//
+// Tokens from a file are not renewed: whatever
+// writes the file (like Vault Agent) should
+// renew them.
+type TokenFile struct {
+	Path string
+}
+
+// Login reads the token from the file
+func (a *TokenFile) Login(client *api.Client) (*api.Secret, error) {
+	token, err := readTokenFile(a.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token: %v", err)
+	}
+	return &api.Secret{Auth: &api.SecretAuth{ClientToken: token}}, nil
+}
+
+// login writes data to the login
+// endpoint of an auth method
+func login(client *api.Client, mount, name string, data map[string]interface{}) (*api.Secret, error) {
+	path := "auth/" + mount + "/login"
+	if name != "" {
+		path += "/" + name
+	}
+	secret, err := client.Logical().Write(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to log in at %v: %v", path, err)
+	}
+	return secret, nil
+}
+
+func mountOrDefault(mount, defaultMount string) string {
+	if mount = strings.Trim(mount, "/"); mount != "" {
+		return mount
+	}
+	return defaultMount
+}
+
+func readTokenFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("%v is empty", path)
+	}
+	return token, nil
+}
+
+// An AuthClientWrapper is a StandardClientWrapper which
+// logs in to Vault with an Authenticator before its first
+// request. It renews its token when about two thirds of
+// the token's lease has passed, and logs in again if Vault
+// rejects the token (with a 403).
+//
+// Close stops renewing the token.
+type AuthClientWrapper struct {
+	StandardClientWrapper
+	auth Authenticator
+
+	mu      sync.Mutex
+	token   string // the current token, or "" to log in
+	renewal *time.Timer
+	closed  bool
+}
+
+// NewAuthClientWrapper creates a new AuthClientWrapper.
+// Its token replaces any token that client has (like
+// one from VAULT_TOKEN).
+func NewAuthClientWrapper(client *api.Client, auth Authenticator) *AuthClientWrapper {
+	return &AuthClientWrapper{
+		StandardClientWrapper: StandardClientWrapper{Client: client},
+		auth:                  auth,
+	}
+}
+
+// ReadSecret reads a secret, after logging in if needed
+func (w *AuthClientWrapper) ReadSecret(path, key string) (interface{}, error) {
+	var v interface{}
+	err := w.withToken(func() error {
+		var err error
+		v, err = w.StandardClientWrapper.ReadSecret(path, key)
+		return err
+	})
+	return v, err
+}
+
+// WriteSecret writes a secret, after logging in if needed
+func (w *AuthClientWrapper) WriteSecret(path, key, value string) error {
+	return w.withToken(func() error {
+		return w.StandardClientWrapper.WriteSecret(path, key, value)
+	})
+}
+
+// ReadSecretVersion reads a version of a
+// secret, after logging in if needed
+func (w *AuthClientWrapper) ReadSecretVersion(path, key string, version int) (interface{}, error) {
+	var v interface{}
+	err := w.withToken(func() error {
+		var err error
+		v, err = w.StandardClientWrapper.ReadSecretVersion(path, key, version)
+		return err
+	})
+	return v, err
+}
+
+// WriteSecretVersion writes a secret, and returns the
+// version that it wrote, after logging in if needed
+func (w *AuthClientWrapper) WriteSecretVersion(path, key, value string) (int, error) {
+	var version int
+	err := w.withToken(func() error {
+		var err error
+		version, err = w.StandardClientWrapper.WriteSecretVersion(path, key, value)
+		return err
+	})
+	return version, err
+}
+
+// IssueLease reads a dynamic secret, after logging in if needed
+func (w *AuthClientWrapper) IssueLease(path string) (*Lease, error) {
+	var lease *Lease
+	err := w.withToken(func() error {
+		var err error
+		lease, err = w.StandardClientWrapper.IssueLease(path)
+		return err
+	})
+	return lease, err
+}
+
+// RenewLease renews a lease, after logging in if needed
+func (w *AuthClientWrapper) RenewLease(id string, increment time.Duration) (*Lease, error) {
+	var lease *Lease
+	err := w.withToken(func() error {
+		var err error
+		lease, err = w.StandardClientWrapper.RenewLease(id, increment)
+		return err
+	})
+	return lease, err
+}
+
+// RevokeLease revokes a lease, after logging in if needed
+func (w *AuthClientWrapper) RevokeLease(id string) error {
+	return w.withToken(func() error {
+		return w.StandardClientWrapper.RevokeLease(id)
+	})
+}
+
+// Encrypt encrypts plaintexts with a
+// transit key, after logging in if needed
+func (w *AuthClientWrapper) Encrypt(mount, key string, plaintexts []string) ([]string, error) {
+	var ciphertexts []string
+	err := w.withToken(func() error {
+		var err error
+		ciphertexts, err = w.StandardClientWrapper.Encrypt(mount, key, plaintexts)
+		return err
+	})
+	return ciphertexts, err
+}
+
+// Decrypt decrypts ciphertexts with a
+// transit key, after logging in if needed
+func (w *AuthClientWrapper) Decrypt(mount, key string, ciphertexts []string) ([]string, error) {
+	var plaintexts []string
+	err := w.withToken(func() error {
+		var err error
+		plaintexts, err = w.StandardClientWrapper.Decrypt(mount, key, ciphertexts)
+		return err
+	})
+	return plaintexts, err
+}
+
+// Rewrap rewraps ciphertexts with a
+// transit key, after logging in if needed
+func (w *AuthClientWrapper) Rewrap(mount, key string, ciphertexts []string) ([]string, error) {
+	var rewrapped []string
+	err := w.withToken(func() error {
+		var err error
+		rewrapped, err = w.StandardClientWrapper.Rewrap(mount, key, ciphertexts)
+		return err
+	})
+	return rewrapped, err
+}
+
+// SecretVersion returns the version of a secret, after
+// logging in if needed. See StandardClientWrapper.SecretVersion.
+func (w *AuthClientWrapper) SecretVersion(path string) (string, time.Duration, error) {
+	var version string
+	var ttl time.Duration
+	err := w.withToken(func() error {
+		var err error
+		version, ttl, err = w.StandardClientWrapper.SecretVersion(path)
+		return err
+	})
+	return version, ttl, err
+}
+
+// Close stops renewing the token
+func (w *AuthClientWrapper) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.renewal != nil {
+		w.renewal.Stop()
+	}
+	return nil
+}
+
+// withToken calls f with a token. If Vault rejects the
+// token, withToken logs in again and calls f once more.
+func (w *AuthClientWrapper) withToken(f func() error) error {
+	token, err := w.currentToken()
+	if err != nil {
+		return err
+	}
+	err = f()
+	if !isPermissionDenied(err) {
+		return err
+	}
+
+	// the token may have expired or been
+	// revoked: log in again, unless another
+	// request already has
+	w.mu.Lock()
+	if w.token == token {
+		w.token = ""
+	}
+	w.mu.Unlock()
+	if _, err := w.currentToken(); err != nil {
+		return err
+	}
+	return f()
+}
+
+// currentToken returns the current
+// token, logging in if there is none
+func (w *AuthClientWrapper) currentToken() (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.token == "" {
+		if err := w.login(); err != nil {
+			return "", err
+		}
+	}
+	return w.token, nil
+}
+
+// login logs in, and schedules the renewal of
+// the new token. The caller must hold w.mu.
+func (w *AuthClientWrapper) login() error {
+	// log in with a client which has no token, as
+	// Vault may reject the login of a client whose
+	// token has expired
+	client, err := w.Client.Clone()
+	if err != nil {
+		return fmt.Errorf("failed to create Vault client: %v", err)
+	}
+	client.ClearToken()
+	client.SetHeaders(w.Client.Headers())
+
+	secret, err := w.auth.Login(client)
+	if err != nil {
+		return fmt.Errorf("failed to log in to Vault: %v", err)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return fmt.Errorf("failed to log in to Vault: no token was returned")
+	}
+	w.token = secret.Auth.ClientToken
+	w.Client.SetToken(w.token)
+	w.scheduleRenewal(secret.Auth)
+	return nil
+}
+
+// scheduleRenewal renews a renewable token when about
+// two thirds of its lease has passed. The caller must
+// hold w.mu.
+func (w *AuthClientWrapper) scheduleRenewal(auth *api.SecretAuth) {
+	if w.renewal != nil {
+		w.renewal.Stop()
+	}
+	if w.closed || !auth.Renewable || auth.LeaseDuration <= 0 {
+		return
+	}
+	token := w.token
+	lease := time.Duration(auth.LeaseDuration) * time.Second
+	w.renewal = time.AfterFunc(lease*2/3, func() {
+		w.renew(token)
+	})
+}
+
+// renew renews a token, if it is still the current
+// token. If the token can't be renewed, renew logs in
+// again (or, failing that, leaves the next request
+// to log in).
+func (w *AuthClientWrapper) renew(token string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.token != token {
+		return
+	}
+	secret, err := w.Client.Auth().Token().RenewSelf(0)
+	if err == nil && secret != nil && secret.Auth != nil {
+		w.scheduleRenewal(secret.Auth)
+		return
+	}
+	if err := w.login(); err != nil {
+		w.token = ""
+	}
+}
+
+// isPermissionDenied returns true if err is a 403
+// response from Vault. (The Vault client reports the
+// status code of failed requests only in its errors.)
+func isPermissionDenied(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Code: 403")
+}
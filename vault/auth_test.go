@@ -0,0 +1,254 @@
+package vault_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dhoelle/redactr/vault"
+	"github.com/hashicorp/vault/api"
+)
+
+// fakeVault is a stand-in for the Vault API. It issues
+// tokens on login (to the credentials in logins), and
+// serves a secret to requests with a valid token.
+type fakeVault struct {
+	mu       sync.Mutex
+	logins   map[string]map[string]interface{} // login path => expected data
+	lease    int                               // the lease duration of tokens, in seconds
+	tokens   map[string]bool                   // valid tokens
+	issued   int
+	loggedIn []string // the paths logged in at
+	renewals int
+}
+
+func newFakeVault(logins map[string]map[string]interface{}) *fakeVault {
+	return &fakeVault{
+		logins: logins,
+		tokens: make(map[string]bool),
+	}
+}
+
+// revokeAll invalidates every token
+func (v *fakeVault) revokeAll() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.tokens = make(map[string]bool)
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if want, ok := v.logins[path]; ok {
+		var got map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, `{"errors":["invalid body"]}`, http.StatusBadRequest)
+			return
+		}
+		for k, wv := range want {
+			if got[k] != wv {
+				http.Error(w, `{"errors":["invalid credentials"]}`, http.StatusBadRequest)
+				return
+			}
+		}
+		if r.Header.Get("X-Vault-Token") != "" {
+			http.Error(w, `{"errors":["logged in with a token"]}`, http.StatusBadRequest)
+			return
+		}
+		v.issued++
+		token := fmt.Sprintf("token-%v", v.issued)
+		v.tokens[token] = true
+		v.loggedIn = append(v.loggedIn, path)
+		writeJSON(w, map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   token,
+				"lease_duration": v.lease,
+				"renewable":      v.lease > 0,
+			},
+		})
+		return
+	}
+
+	if !v.tokens[r.Header.Get("X-Vault-Token")] {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+	switch path {
+	case "auth/token/renew-self":
+		v.renewals++
+		writeJSON(w, map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   r.Header.Get("X-Vault-Token"),
+				"lease_duration": v.lease,
+				"renewable":      true,
+			},
+		})
+	case "secret/app":
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{"password": "hunter2"},
+		})
+	default:
+		http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func newTestClient(t *testing.T, url string) *api.Client {
+	config := api.DefaultConfig()
+	config.Address = url
+	config.MaxRetries = 0
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.ClearToken()
+	return client
+}
+
+func readPassword(t *testing.T, w *vault.AuthClientWrapper) {
+	t.Helper()
+	got, err := w.ReadSecret("secret/app", "password")
+	if err != nil {
+		t.Fatalf("ReadSecret() got err: %v", err)
+	}
+	if got != "hunter2" {
+		t.Fatalf("ReadSecret() want hunter2, got %v", got)
+	}
+}
+
+func TestAuthClientWrapper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redactr-vault-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jwtFile := filepath.Join(dir, "jwt")
+	if err := ioutil.WriteFile(jwtFile, []byte("a.service.account\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	logins := map[string]map[string]interface{}{
+		"auth/approle/login":        {"role_id": "my-role", "secret_id": "my-secret"},
+		"auth/k8s/login":            {"role": "app", "jwt": "a.service.account"},
+		"auth/userpass/login/alice": {"password": "hunter3"},
+	}
+
+	tests := []struct {
+		name      string
+		auth      vault.Authenticator
+		wantLogin string
+	}{
+		{
+			name:      "approle",
+			auth:      &vault.AppRole{RoleID: "my-role", SecretID: "my-secret"},
+			wantLogin: "auth/approle/login",
+		},
+		{
+			name:      "kubernetes",
+			auth:      &vault.Kubernetes{Role: "app", JWTFile: jwtFile, Mount: "/k8s/"},
+			wantLogin: "auth/k8s/login",
+		},
+		{
+			name:      "userpass",
+			auth:      &vault.UserPass{Username: "alice", Password: "hunter3"},
+			wantLogin: "auth/userpass/login/alice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" should log in, and log in again when the token is rejected", func(t *testing.T) {
+			v := newFakeVault(logins)
+			srv := httptest.NewServer(v)
+			defer srv.Close()
+
+			w := vault.NewAuthClientWrapper(newTestClient(t, srv.URL), tt.auth)
+			defer w.Close()
+			readPassword(t, w)
+			readPassword(t, w)
+
+			v.revokeAll()
+			readPassword(t, w)
+
+			want := []string{tt.wantLogin, tt.wantLogin}
+			if got := v.loggedIn; fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("want logins %v, got %v", want, got)
+			}
+		})
+	}
+
+	t.Run("it should fail if it can't log in", func(t *testing.T) {
+		v := newFakeVault(logins)
+		srv := httptest.NewServer(v)
+		defer srv.Close()
+
+		w := vault.NewAuthClientWrapper(newTestClient(t, srv.URL), &vault.AppRole{RoleID: "my-role", SecretID: "wrong"})
+		if _, err := w.ReadSecret("secret/app", "password"); err == nil {
+			t.Errorf("ReadSecret(): expected an error")
+		}
+	})
+
+	t.Run("it should renew the token before it expires", func(t *testing.T) {
+		v := newFakeVault(logins)
+		v.lease = 1
+		srv := httptest.NewServer(v)
+		defer srv.Close()
+
+		w := vault.NewAuthClientWrapper(newTestClient(t, srv.URL), &vault.AppRole{RoleID: "my-role", SecretID: "my-secret"})
+		defer w.Close()
+		readPassword(t, w)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			v.mu.Lock()
+			renewals := v.renewals
+			v.mu.Unlock()
+			if renewals >= 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("want at least 2 renewals, got %v", renewals)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		readPassword(t, w)
+		if got := len(v.loggedIn); got != 1 {
+			t.Errorf("want 1 login, got %v", got)
+		}
+	})
+
+	t.Run("it should read a token file again when the token is rejected", func(t *testing.T) {
+		v := newFakeVault(logins)
+		v.tokens["agent-1"] = true
+		srv := httptest.NewServer(v)
+		defer srv.Close()
+
+		tokenFile := filepath.Join(dir, "token")
+		if err := ioutil.WriteFile(tokenFile, []byte("agent-1\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		w := vault.NewAuthClientWrapper(newTestClient(t, srv.URL), &vault.TokenFile{Path: tokenFile})
+		defer w.Close()
+		readPassword(t, w)
+
+		// Vault Agent writes a new token
+		v.revokeAll()
+		v.tokens["agent-2"] = true
+		if err := ioutil.WriteFile(tokenFile, []byte("agent-2\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		readPassword(t, w)
+	})
+}
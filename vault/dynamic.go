@@ -0,0 +1,410 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhoelle/redactr/watch"
+)
+
+// A Lease is a secret which Vault issued with a lease,
+// like a set of dynamic database credentials
+type Lease struct {
+	ID        string
+	Duration  time.Duration
+	Renewable bool
+	Data      map[string]interface{}
+}
+
+// A LeaseClient can issue, renew and revoke
+// the leases of dynamic secrets
+type LeaseClient interface {
+	// IssueLease reads a dynamic secret, like
+	// database/creds/readonly, which issues a new lease
+	IssueLease(path string) (*Lease, error)
+
+	// RenewLease asks Vault to extend a lease by increment,
+	// and returns the renewed lease (without its data).
+	// Vault may extend the lease by less than increment,
+	// as a lease can't outlive its max TTL.
+	RenewLease(id string, increment time.Duration) (*Lease, error)
+
+	// RevokeLease revokes a lease
+	RevokeLease(id string) error
+}
+
+// A DynamicRedacter unredacts dynamic secrets, like
+// database or AWS credentials, which Vault issues
+// with a lease. It expects inputs like:
+//
+//    database/creds/readonly#username
+//
+// Every field read from the same path comes from the same
+// lease, so ~~redacted-vault-dynamic:database/creds/readonly#username~~
+// and ~~redacted-vault-dynamic:database/creds/readonly#password~~
+// are a matching pair.
+//
+// Leases are renewed when about two thirds of their
+// duration has passed. When a lease can't be renewed
+// for much longer (it is nearing its max TTL, or isn't
+// renewable), it is replaced by a new lease the next
+// time it is read, and its watchers (see WatchPayloads)
+// are told that it has changed, so that a command
+// run by Exec can be restarted or signalled before its
+// credentials expire.
+//
+// Leases are revoked by RevokeLeases, and replaced leases
+// by RevokeRetiredLeases. Close stops renewing them,
+// without revoking them.
+type DynamicRedacter struct {
+	client LeaseClient
+
+	// rotation is held for reading while a command's inputs
+	// are rendered (see BeginRender), and for writing to mark
+	// a lease for replacement, so that a render never mixes
+	// fields from two leases
+	rotation sync.RWMutex
+
+	mu       sync.Mutex
+	leases   map[string]*activeLease // current leases, by path
+	retired  []*activeLease          // replaced leases, which may still be in use
+	watchers map[*leaseWatcher]bool
+	closed   bool
+}
+
+// An activeLease is a lease which
+// a DynamicRedacter has issued
+type activeLease struct {
+	Lease
+	path    string
+	expires time.Time
+	due     bool // replace the lease when it is next read
+	renewal *time.Timer
+}
+
+// NewDynamicRedacter creates a new DynamicRedacter
+func NewDynamicRedacter(client LeaseClient) *DynamicRedacter {
+	return &DynamicRedacter{
+		client:   client,
+		leases:   make(map[string]*activeLease),
+		watchers: make(map[*leaseWatcher]bool),
+	}
+}
+
+// Redact fails: dynamic secrets are
+// issued by Vault, not stored in it
+func (r *DynamicRedacter) Redact(secretDeclaration string) (string, error) {
+	return "", fmt.Errorf("dynamic secrets are issued by Vault, and can't be redacted")
+}
+
+// Unredact reads a field from the current lease
+// of a dynamic secret, issuing a lease if there
+// is none.
+//
+// It expects an input like:
+//
+//    database/creds/readonly#password
+//
+func (r *DynamicRedacter) Unredact(secretDeclaration string) (string, error) {
+	ss := strings.Split(secretDeclaration, "#")
+	if len(ss) != 2 {
+		return "", fmt.Errorf("expected secret declaration with two parts, got %v", len(ss))
+	}
+	path, field := ss[0], ss[1]
+
+	lease, err := r.lease(path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := lease.Data[field]
+	if !ok || value == nil {
+		return "", fmt.Errorf("%v has no field %q", path, field)
+	}
+	return formatValue(value)
+}
+
+// MatchUnredactedPayload reports whether a payload could
+// be redacted. Dynamic secrets can't be, so that tokens
+// like ~~redact-vault-dynamic:...~~ are left as they are.
+func (r *DynamicRedacter) MatchUnredactedPayload(payload string) bool {
+	return false
+}
+
+// MatchRedactedPayload reports whether a
+// payload is a secret path and field
+func (r *DynamicRedacter) MatchRedactedPayload(payload string) bool {
+	return redactedPayloadRE.MatchString(payload)
+}
+
+// BeginRender begins rendering a command's inputs. Until
+// the returned function is called, no lease is marked for
+// replacement, so the fields that are read from a path
+// all come from the same lease.
+func (r *DynamicRedacter) BeginRender() (end func()) {
+	r.rotation.RLock()
+	return r.rotation.RUnlock
+}
+
+// lease returns the current lease for path, issuing a
+// new lease if there is none, or it is due to be replaced
+func (r *DynamicRedacter) lease(path string) (*activeLease, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.leases[path]
+	if current != nil && !current.due && time.Now().Before(current.expires) {
+		return current, nil
+	}
+
+	lease, err := r.client.IssueLease(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue a lease for %v: %v", path, err)
+	}
+	if lease == nil {
+		return nil, fmt.Errorf("failed to issue a lease for %v: not found", path)
+	}
+	l := &activeLease{
+		Lease:   *lease,
+		path:    path,
+		expires: time.Now().Add(lease.Duration),
+	}
+	if lease.Duration <= 0 {
+		// the secret has no lease, and never expires
+		l.expires = time.Now().Add(100 * 365 * 24 * time.Hour)
+	}
+
+	// keep the replaced lease, which a command may still
+	// be using, until it is revoked or expires
+	if current != nil {
+		if current.renewal != nil {
+			current.renewal.Stop()
+		}
+		r.retired = append(r.retired, current)
+	}
+	r.leases[path] = l
+	r.scheduleRenewal(l, lease.Duration)
+	return l, nil
+}
+
+// scheduleRenewal renews a lease when about two thirds of
+// its remaining duration has passed. The caller must hold
+// r.mu.
+func (r *DynamicRedacter) scheduleRenewal(l *activeLease, remaining time.Duration) {
+	if r.closed || l.ID == "" || remaining <= 0 {
+		return
+	}
+	l.renewal = time.AfterFunc(remaining*2/3, func() {
+		r.renew(l)
+	})
+}
+
+// renew renews a lease, if it is still current. If the
+// lease can't be extended to at least half of its original
+// duration, it is marked for replacement.
+func (r *DynamicRedacter) renew(l *activeLease) {
+	r.mu.Lock()
+	current := !r.closed && r.leases[l.path] == l
+	r.mu.Unlock()
+	if !current {
+		return
+	}
+
+	if l.Renewable {
+		renewed, err := r.client.RenewLease(l.ID, l.Duration)
+		if err == nil && renewed != nil && renewed.Duration >= l.Duration/2 {
+			r.mu.Lock()
+			if r.leases[l.path] == l {
+				l.expires = time.Now().Add(renewed.Duration)
+				r.scheduleRenewal(l, renewed.Duration)
+			}
+			r.mu.Unlock()
+			return
+		}
+	}
+	r.replace(l)
+}
+
+// replace marks a lease for replacement,
+// and tells the watchers of its path
+func (r *DynamicRedacter) replace(l *activeLease) {
+	// wait for renders in progress
+	r.rotation.Lock()
+	r.mu.Lock()
+	if r.leases[l.path] == l {
+		l.due = true
+	}
+	var changed []func()
+	for w := range r.watchers {
+		if w.paths[l.path] {
+			changed = append(changed, w.changed)
+		}
+	}
+	r.mu.Unlock()
+	r.rotation.Unlock()
+
+	for _, f := range changed {
+		f()
+	}
+}
+
+// RevokeLeases revokes every lease that
+// the DynamicRedacter has issued
+func (r *DynamicRedacter) RevokeLeases() error {
+	r.mu.Lock()
+	leases := r.retired
+	for _, l := range r.leases {
+		leases = append(leases, l)
+	}
+	for _, l := range leases {
+		if l.renewal != nil {
+			l.renewal.Stop()
+		}
+	}
+	r.leases = make(map[string]*activeLease)
+	r.retired = nil
+	r.mu.Unlock()
+
+	_, err := r.revoke(leases)
+	return err
+}
+
+// RevokeRetiredLeases revokes the leases which have been
+// replaced, which a command restarted with the secrets of
+// the new leases no longer uses. Leases which can't be
+// revoked are kept, to be revoked by the next call, or
+// by RevokeLeases.
+func (r *DynamicRedacter) RevokeRetiredLeases() error {
+	r.mu.Lock()
+	leases := r.retired
+	r.retired = nil
+	r.mu.Unlock()
+
+	failed, err := r.revoke(leases)
+	r.mu.Lock()
+	r.retired = append(r.retired, failed...)
+	r.mu.Unlock()
+	return err
+}
+
+// revoke revokes leases which have not expired, and
+// returns those which couldn't be revoked
+func (r *DynamicRedacter) revoke(leases []*activeLease) (failed []*activeLease, err error) {
+	sort.Slice(leases, func(i, j int) bool { return leases[i].ID < leases[j].ID })
+	for _, l := range leases {
+		if l.ID == "" || time.Now().After(l.expires) {
+			continue
+		}
+		if revokeErr := r.client.RevokeLease(l.ID); revokeErr != nil {
+			failed = append(failed, l)
+			if err == nil {
+				err = fmt.Errorf("failed to revoke lease %v: %v", l.ID, revokeErr)
+			}
+		}
+	}
+	return failed, err
+}
+
+// Close stops renewing leases. It does not revoke
+// them (see RevokeLeases), so that secrets which
+// were unredacted can still be used.
+func (r *DynamicRedacter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	for _, l := range r.leases {
+		if l.renewal != nil {
+			l.renewal.Stop()
+		}
+	}
+	return nil
+}
+
+// WatchPayloads returns a Watcher for the dynamic secrets
+// behind redacted payloads (like "database/creds/readonly#password"),
+// which reports a change when the lease of a secret is
+// due to be replaced. The interval is not used.
+func (r *DynamicRedacter) WatchPayloads(payloads []string, interval time.Duration) (watch.Watcher, error) {
+	paths := make(map[string]bool)
+	for _, p := range payloads {
+		paths[strings.SplitN(p, "#", 2)[0]] = true
+	}
+	return &leaseWatcher{redacter: r, paths: paths}, nil
+}
+
+// A leaseWatcher watches the leases of dynamic secrets
+type leaseWatcher struct {
+	redacter *DynamicRedacter
+	paths    map[string]bool
+	changed  func()
+}
+
+// Watch reports a change when the lease of
+// a watched secret is due to be replaced
+func (w *leaseWatcher) Watch(ctx context.Context, changed func()) error {
+	r := w.redacter
+	r.mu.Lock()
+	w.changed = changed
+	r.watchers[w] = true
+	isDue := false
+	for path := range w.paths {
+		if l := r.leases[path]; l != nil && l.due {
+			isDue = true
+		}
+	}
+	r.mu.Unlock()
+	if isDue {
+		changed()
+	}
+
+	<-ctx.Done()
+	r.mu.Lock()
+	delete(r.watchers, w)
+	r.mu.Unlock()
+	return nil
+}
+
+// IssueLease reads a dynamic secret using the standard
+// Vault client, which issues a new lease
+func (w *StandardClientWrapper) IssueLease(path string) (*Lease, error) {
+	secret, err := w.Client.Logical().Read(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %v", err)
+	}
+	if secret == nil {
+		return nil, nil
+	}
+	return &Lease{
+		ID:        secret.LeaseID,
+		Duration:  time.Duration(secret.LeaseDuration) * time.Second,
+		Renewable: secret.Renewable,
+		Data:      secret.Data,
+	}, nil
+}
+
+// RenewLease renews a lease using the standard Vault client
+func (w *StandardClientWrapper) RenewLease(id string, increment time.Duration) (*Lease, error) {
+	secret, err := w.Client.Sys().Renew(id, int(increment/time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew lease: %v", err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("failed to renew lease: no lease was returned")
+	}
+	return &Lease{
+		ID:        secret.LeaseID,
+		Duration:  time.Duration(secret.LeaseDuration) * time.Second,
+		Renewable: secret.Renewable,
+	}, nil
+}
+
+// RevokeLease revokes a lease using the standard Vault client
+func (w *StandardClientWrapper) RevokeLease(id string) error {
+	if err := w.Client.Sys().Revoke(id); err != nil {
+		return fmt.Errorf("failed to revoke lease: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package vault_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dhoelle/redactr/vault"
+)
+
+// fakeLeaseClient issues leases for dynamic
+// credentials, like a database secrets engine
+type fakeLeaseClient struct {
+	mu        sync.Mutex
+	duration  time.Duration
+	renewable bool
+	maxTTL    time.Duration // how long a lease can be renewed for (0 for no limit)
+	issued    int
+	issuedAt  map[string]time.Time
+	renewals  int
+	revoked   []string
+	failing   bool // fail to revoke leases
+}
+
+func newFakeLeaseClient(duration time.Duration, renewable bool, maxTTL time.Duration) *fakeLeaseClient {
+	return &fakeLeaseClient{
+		duration:  duration,
+		renewable: renewable,
+		maxTTL:    maxTTL,
+		issuedAt:  make(map[string]time.Time),
+	}
+}
+
+func (c *fakeLeaseClient) IssueLease(path string) (*vault.Lease, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.issued++
+	id := fmt.Sprintf("%v/lease-%v", path, c.issued)
+	c.issuedAt[id] = time.Now()
+	return &vault.Lease{
+		ID:        id,
+		Duration:  c.duration,
+		Renewable: c.renewable,
+		Data: map[string]interface{}{
+			"username": fmt.Sprintf("user-%v", c.issued),
+			"password": fmt.Sprintf("pass-%v", c.issued),
+		},
+	}, nil
+}
+
+func (c *fakeLeaseClient) RenewLease(id string, increment time.Duration) (*vault.Lease, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.renewals++
+	d := increment
+	if c.maxTTL > 0 {
+		if remaining := time.Until(c.issuedAt[id].Add(c.maxTTL)); remaining < d {
+			d = remaining
+		}
+	}
+	return &vault.Lease{ID: id, Duration: d, Renewable: true}, nil
+}
+
+func (c *fakeLeaseClient) RevokeLease(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failing {
+		return fmt.Errorf("permission denied")
+	}
+	c.revoked = append(c.revoked, id)
+	return nil
+}
+
+func (c *fakeLeaseClient) setFailing(failing bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failing = failing
+}
+
+func (c *fakeLeaseClient) renewalCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.renewals
+}
+
+func unredactAll(t *testing.T, r *vault.DynamicRedacter, payloads ...string) []string {
+	t.Helper()
+	var values []string
+	for _, p := range payloads {
+		v, err := r.Unredact(p)
+		if err != nil {
+			t.Fatalf("Unredact(%q) got err: %v", p, err)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// watchChanges watches payloads, and sends
+// the changes that are reported to a channel
+func watchChanges(t *testing.T, r *vault.DynamicRedacter, payloads ...string) (<-chan struct{}, func()) {
+	t.Helper()
+	w, err := r.WatchPayloads(payloads, time.Second)
+	if err != nil {
+		t.Fatalf("WatchPayloads() got err: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 10)
+	go w.Watch(ctx, func() { changes <- struct{}{} })
+	return changes, cancel
+}
+
+func TestDynamicRedacter(t *testing.T) {
+	const username = "database/creds/readonly#username"
+	const password = "database/creds/readonly#password"
+
+	t.Run("it should read every field of a path from one lease", func(t *testing.T) {
+		client := newFakeLeaseClient(time.Hour, true, 0)
+		r := vault.NewDynamicRedacter(client)
+		defer r.Close()
+
+		got := unredactAll(t, r, username, password, username, "database/creds/admin#username")
+		want := []string{"user-1", "pass-1", "user-1", "user-2"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Unredact() want %v, got %v", want, got)
+		}
+
+		if _, err := r.Unredact("database/creds/readonly#missing"); err == nil {
+			t.Errorf("Unredact(): expected an error for a missing field")
+		}
+		if _, err := r.Redact("database/creds/readonly#username#admin"); err == nil {
+			t.Errorf("Redact(): expected an error")
+		}
+	})
+
+	t.Run("it should renew leases before they expire", func(t *testing.T) {
+		client := newFakeLeaseClient(150*time.Millisecond, true, 0)
+		r := vault.NewDynamicRedacter(client)
+		defer r.Close()
+		changes, stop := watchChanges(t, r, username, password)
+		defer stop()
+
+		unredactAll(t, r, username)
+		time.Sleep(400 * time.Millisecond)
+		if n := client.renewalCount(); n < 2 {
+			t.Errorf("want at least 2 renewals, got %v", n)
+		}
+		if got := unredactAll(t, r, username, password); fmt.Sprint(got) != "[user-1 pass-1]" {
+			t.Errorf("Unredact() want the first lease, got %v", got)
+		}
+		select {
+		case <-changes:
+			t.Errorf("Watch(): expected no change while the lease is renewed")
+		default:
+		}
+	})
+
+	t.Run("it should replace a lease which nears its max TTL, and revoke both", func(t *testing.T) {
+		client := newFakeLeaseClient(600*time.Millisecond, true, 900*time.Millisecond)
+		r := vault.NewDynamicRedacter(client)
+		defer r.Close()
+		changes, stop := watchChanges(t, r, password)
+		defer stop()
+
+		unredactAll(t, r, username, password)
+		select {
+		case <-changes:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Watch(): expected a change before the lease's max TTL")
+		}
+		if got := unredactAll(t, r, username, password); fmt.Sprint(got) != "[user-2 pass-2]" {
+			t.Errorf("Unredact() want a new lease, got %v", got)
+		}
+
+		if err := r.RevokeLeases(); err != nil {
+			t.Fatalf("RevokeLeases() got err: %v", err)
+		}
+		want := []string{"database/creds/readonly/lease-1", "database/creds/readonly/lease-2"}
+		if fmt.Sprint(client.revoked) != fmt.Sprint(want) {
+			t.Errorf("RevokeLeases() want %v revoked, got %v", want, client.revoked)
+		}
+	})
+
+	t.Run("it should revoke replaced leases, and retry those which can't be revoked", func(t *testing.T) {
+		client := newFakeLeaseClient(600*time.Millisecond, false, 0)
+		r := vault.NewDynamicRedacter(client)
+		defer r.Close()
+		changes, stop := watchChanges(t, r, username)
+		defer stop()
+
+		unredactAll(t, r, username)
+		select {
+		case <-changes:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Watch(): expected a change before the lease expires")
+		}
+		if got := unredactAll(t, r, username); fmt.Sprint(got) != "[user-2]" {
+			t.Errorf("Unredact() want a new lease, got %v", got)
+		}
+
+		client.setFailing(true)
+		if err := r.RevokeRetiredLeases(); err == nil {
+			t.Errorf("RevokeRetiredLeases(): expected an error")
+		}
+		client.setFailing(false)
+		if err := r.RevokeRetiredLeases(); err != nil {
+			t.Fatalf("RevokeRetiredLeases() got err: %v", err)
+		}
+		want := []string{"database/creds/readonly/lease-1"}
+		if fmt.Sprint(client.revoked) != fmt.Sprint(want) {
+			t.Errorf("RevokeRetiredLeases() want %v revoked, got %v", want, client.revoked)
+		}
+
+		// the current lease is still in use
+		if got := unredactAll(t, r, username); fmt.Sprint(got) != "[user-2]" {
+			t.Errorf("Unredact() want the current lease, got %v", got)
+		}
+		if err := r.RevokeLeases(); err != nil {
+			t.Fatalf("RevokeLeases() got err: %v", err)
+		}
+		want = append(want, "database/creds/readonly/lease-2")
+		if fmt.Sprint(client.revoked) != fmt.Sprint(want) {
+			t.Errorf("RevokeLeases() want %v revoked, got %v", want, client.revoked)
+		}
+	})
+
+	t.Run("it should not replace a lease during a render", func(t *testing.T) {
+		client := newFakeLeaseClient(600*time.Millisecond, false, 0)
+		r := vault.NewDynamicRedacter(client)
+		defer r.Close()
+		changes, stop := watchChanges(t, r, username, password)
+		defer stop()
+
+		// the lease can't be renewed, so is replaced
+		// after about 400ms, unless a render is in
+		// progress
+		end := r.BeginRender()
+		first := unredactAll(t, r, username)
+		time.Sleep(500 * time.Millisecond)
+		second := unredactAll(t, r, password)
+		end()
+		if got := append(first, second...); fmt.Sprint(got) != "[user-1 pass-1]" {
+			t.Errorf("Unredact() want fields from one lease, got %v", got)
+		}
+
+		select {
+		case <-changes:
+		case <-time.After(time.Second):
+			t.Fatalf("Watch(): expected a change after the render")
+		}
+		if got := unredactAll(t, r, username, password); fmt.Sprint(got) != "[user-2 pass-2]" {
+			t.Errorf("Unredact() want a new lease, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// casRetries is how many times a write to a KV version 2
+// secret is retried when another writer changes the
+// secret between our read and write
+const casRetries = 3
+
+// A kvMount is a KV secrets engine
+type kvMount struct {
+	path    string // like "secret/"
+	version int    // 1 or 2
+}
+
+// writeSecret writes a key to the secret at path, keeping
+// the secret's other keys, and creating the secret if it
+// does not exist.
+//
+// The version of the KV secrets engine that the secret is
+// in is read from sys/mounts. In a version 2 engine, the
+// path must be under the engine's data/ path (like
+// secret/data/my-secret), and the secret is written
+// with check-and-set, so that a concurrent write is not
+// lost: if the secret changes between our read and write,
+// it is read and written again.
+func (w *StandardClientWrapper) writeSecret(path, key, value string) (*api.Secret, error) {
+	path = strings.TrimPrefix(path, "/")
+	mount, err := w.kvMount(path)
+	if err != nil {
+		return nil, err
+	}
+	if mount.version != 2 {
+		return w.writeSecretV1(path, key, value)
+	}
+
+	if !strings.HasPrefix(path, mount.path+"data/") {
+		return nil, fmt.Errorf("%v is in a KV version 2 secrets engine, so it must be written under %vdata/", path, mount.path)
+	}
+	for i := 0; ; i++ {
+		resp, err := w.writeSecretV2(path, key, value)
+		if err == nil || !isCheckAndSetFailure(err) || i == casRetries {
+			return resp, err
+		}
+	}
+}
+
+// writeSecretV1 writes a key to a KV version 1 secret
+func (w *StandardClientWrapper) writeSecretV1(path, key, value string) (*api.Secret, error) {
+	// Fetch the existing vault secret, if one exists
+	secret, err := w.Client.Logical().Read(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %v", err)
+	}
+
+	data := make(map[string]interface{})
+	if secret != nil {
+		for k, v := range secret.Data {
+			data[k] = v
+		}
+	}
+	data[key] = value
+
+	resp, err := w.Client.Logical().Write(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write secret: %v", err)
+	}
+	return resp, nil
+}
+
+// writeSecretV2 writes a key to a KV version 2 secret,
+// as a new version of the secret. It fails if the secret
+// changes after it is read.
+func (w *StandardClientWrapper) writeSecretV2(path, key, value string) (*api.Secret, error) {
+	// Fetch the latest version of the secret, if one exists.
+	// (A secret whose latest version was deleted has
+	// metadata, but no data.)
+	secret, err := w.Client.Logical().Read(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %v", err)
+	}
+
+	data := make(map[string]interface{})
+	cas := 0 // only write if the secret doesn't exist
+	if secret != nil && secret.Data != nil {
+		if kv, ok := secret.Data["data"].(map[string]interface{}); ok {
+			for k, v := range kv {
+				data[k] = v
+			}
+		}
+		if md, ok := secret.Data["metadata"].(map[string]interface{}); ok && md["version"] != nil {
+			if _, err := fmt.Sscan(fmt.Sprint(md["version"]), &cas); err != nil {
+				return nil, fmt.Errorf("failed to parse the version of the secret: %v", err)
+			}
+		}
+	}
+	data[key] = value
+
+	resp, err := w.Client.Logical().Write(path, map[string]interface{}{
+		"data": data,
+		"options": map[string]interface{}{
+			"cas": cas,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write secret: %v", err)
+	}
+	return resp, nil
+}
+
+// isCheckAndSetFailure returns true if err is a
+// failed check-and-set write to a KV version 2 secret
+func isCheckAndSetFailure(err error) bool {
+	return strings.Contains(err.Error(), "check-and-set")
+}
+
+// kvMount returns the KV secrets engine
+// which the secret at path is in
+func (w *StandardClientWrapper) kvMount(path string) (kvMount, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, m := range w.mounts {
+		if strings.HasPrefix(path, m.path) {
+			return m, nil
+		}
+	}
+
+	m, err := w.readKVMount(path)
+	if err != nil {
+		return kvMount{}, fmt.Errorf("failed to find the secrets engine of %v: %v", path, err)
+	}
+	w.mounts = append(w.mounts, m)
+	return m, nil
+}
+
+// readKVMount reads the KV secrets engine which the secret
+// at path is in from sys/mounts. Tokens which can't read
+// sys/mounts can usually read the engine of a path they
+// can access from sys/internal/ui/mounts (as the vault
+// CLI does), so readKVMount falls back to that.
+func (w *StandardClientWrapper) readKVMount(path string) (kvMount, error) {
+	mounts, err := w.Client.Sys().ListMounts()
+	if err != nil {
+		secret, uiErr := w.Client.Logical().Read("sys/internal/ui/mounts/" + path)
+		if uiErr != nil || secret == nil || secret.Data == nil {
+			return kvMount{}, fmt.Errorf("failed to read sys/mounts: %v", err)
+		}
+		m := &api.MountOutput{Options: make(map[string]string)}
+		m.Type, _ = secret.Data["type"].(string)
+		if options, ok := secret.Data["options"].(map[string]interface{}); ok {
+			for k, v := range options {
+				m.Options[k] = fmt.Sprint(v)
+			}
+		}
+		mountPath, _ := secret.Data["path"].(string)
+		mounts = map[string]*api.MountOutput{mountPath: m}
+	}
+
+	// find the longest mount path which holds the secret
+	var mountPath string
+	var mount *api.MountOutput
+	for p, m := range mounts {
+		if p != "" && strings.HasPrefix(path, p) && len(p) > len(mountPath) {
+			mountPath, mount = p, m
+		}
+	}
+	if mount == nil {
+		return kvMount{}, fmt.Errorf("no secrets engine is mounted at %v", path)
+	}
+	if mount.Type != "kv" && mount.Type != "generic" {
+		return kvMount{}, fmt.Errorf("%v is a %v secrets engine, not a KV secrets engine", mountPath, mount.Type)
+	}
+	version := 1
+	if mount.Options["version"] == "2" {
+		version = 2
+	}
+	return kvMount{path: mountPath, version: version}, nil
+}
@@ -0,0 +1,293 @@
+package vault_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dhoelle/redactr"
+	"github.com/dhoelle/redactr/vault"
+)
+
+// fakeKV is a stand-in for the Vault API, with a KV
+// version 1 engine at kv1/ and a KV version 2 engine
+// at secret/
+type fakeKV struct {
+	mu         sync.Mutex
+	denyMounts bool                                // deny reads of sys/mounts
+	denyMeta   bool                                // deny reads of secret/metadata/
+	v1         map[string]map[string]interface{}   // path => data
+	v2         map[string][]map[string]interface{} // path (under secret/data/) => versions
+	mountReads int
+
+	// beforeWrite, if set, is called before
+	// a write to a KV version 2 secret
+	beforeWrite func(path string)
+}
+
+func newFakeKV() *fakeKV {
+	return &fakeKV{
+		v1: make(map[string]map[string]interface{}),
+		v2: make(map[string][]map[string]interface{}),
+	}
+}
+
+func (v *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case path == "sys/mounts":
+		v.mountReads++
+		if v.denyMounts {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{
+				"kv1/":    map[string]interface{}{"type": "kv", "options": map[string]interface{}{"version": "1"}},
+				"secret/": map[string]interface{}{"type": "kv", "options": map[string]interface{}{"version": "2"}},
+				"sys/":    map[string]interface{}{"type": "system"},
+			},
+		})
+
+	case strings.HasPrefix(path, "sys/internal/ui/mounts/"):
+		v.mountReads++
+		p := strings.TrimPrefix(path, "sys/internal/ui/mounts/")
+		mount, version := "kv1/", "1"
+		if strings.HasPrefix(p, "secret/") {
+			mount, version = "secret/", "2"
+		}
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{"path": mount, "type": "kv", "options": map[string]interface{}{"version": version}},
+		})
+
+	case strings.HasPrefix(path, "kv1/"):
+		if r.Method == http.MethodGet {
+			data, ok := v.v1[path]
+			if !ok {
+				http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"data": data})
+			return
+		}
+		var data map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&data)
+		v.v1[path] = data
+		w.WriteHeader(http.StatusNoContent)
+
+	case strings.HasPrefix(path, "secret/metadata/"):
+		if v.denyMeta {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		versions := v.v2["secret/data/"+strings.TrimPrefix(path, "secret/metadata/")]
+		if len(versions) == 0 {
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{"current_version": len(versions)},
+		})
+
+	case strings.HasPrefix(path, "secret/data/"):
+		versions := v.v2[path]
+		if r.Method == http.MethodGet {
+			n := len(versions)
+			if q := r.URL.Query().Get("version"); q != "" {
+				n, _ = strconv.Atoi(q)
+			}
+			if n == 0 || n > len(versions) {
+				http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+				return
+			}
+			writeJSON(w, map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     versions[n-1],
+					"metadata": map[string]interface{}{"version": n},
+				},
+			})
+			return
+		}
+
+		if v.beforeWrite != nil {
+			v.mu.Unlock()
+			v.beforeWrite(path)
+			v.mu.Lock()
+			versions = v.v2[path]
+		}
+		var body struct {
+			Data    map[string]interface{} `json:"data"`
+			Options struct {
+				CAS *int `json:"cas"`
+			} `json:"options"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Data == nil {
+			http.Error(w, `{"errors":["no data provided"]}`, http.StatusBadRequest)
+			return
+		}
+		if body.Options.CAS != nil && *body.Options.CAS != len(versions) {
+			http.Error(w, `{"errors":["check-and-set parameter did not match the current version"]}`, http.StatusBadRequest)
+			return
+		}
+		v.v2[path] = append(versions, body.Data)
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{"version": len(v.v2[path])},
+		})
+
+	default:
+		http.Error(w, `{"errors":["no handler for route"]}`, http.StatusNotFound)
+	}
+}
+
+func TestStandardClientWrapper_WriteSecret(t *testing.T) {
+	setup := func(t *testing.T) (*fakeKV, *vault.StandardClientWrapper, func()) {
+		v := newFakeKV()
+		srv := httptest.NewServer(v)
+		return v, &vault.StandardClientWrapper{Client: newTestClient(t, srv.URL)}, srv.Close
+	}
+
+	t.Run("KV version 1", func(t *testing.T) {
+		v, client, done := setup(t)
+		defer done()
+
+		// create a secret, then add a key to it
+		if err := client.WriteSecret("kv1/app", "user", "admin"); err != nil {
+			t.Fatalf("WriteSecret() got err: %v", err)
+		}
+		version, err := client.WriteSecretVersion("kv1/app", "password", "hunter2")
+		if err != nil {
+			t.Fatalf("WriteSecretVersion() got err: %v", err)
+		}
+		if version != 0 {
+			t.Errorf("WriteSecretVersion() want version 0, got %v", version)
+		}
+
+		want := map[string]interface{}{"user": "admin", "password": "hunter2"}
+		if got := v.v1["kv1/app"]; !equalData(got, want) {
+			t.Errorf("want secret %v, got %v", want, got)
+		}
+		if v.mountReads != 1 {
+			t.Errorf("want sys/mounts to be read once, got %v", v.mountReads)
+		}
+	})
+
+	t.Run("KV version 2", func(t *testing.T) {
+		v, client, done := setup(t)
+		defer done()
+
+		// create a secret, then add a key to it
+		version, err := client.WriteSecretVersion("secret/data/app", "user", "admin")
+		if err != nil {
+			t.Fatalf("WriteSecretVersion() got err: %v", err)
+		}
+		if version != 1 {
+			t.Errorf("WriteSecretVersion() want version 1, got %v", version)
+		}
+		version, err = client.WriteSecretVersion("secret/data/app", "password", "hunter2")
+		if err != nil {
+			t.Fatalf("WriteSecretVersion() got err: %v", err)
+		}
+		if version != 2 {
+			t.Errorf("WriteSecretVersion() want version 2, got %v", version)
+		}
+
+		// the data is written in the envelope, rather
+		// than with the data and metadata nested in it
+		want := map[string]interface{}{"user": "admin", "password": "hunter2"}
+		if got := v.v2["secret/data/app"]; len(got) != 2 || !equalData(got[1], want) {
+			t.Errorf("want secret %v, got versions %v", want, got)
+		}
+
+		got, err := client.ReadSecret("secret/data/app", "password")
+		if err != nil || got != "hunter2" {
+			t.Errorf("ReadSecret() = %v, %v, want hunter2", got, err)
+		}
+	})
+
+	t.Run("KV version 2 should not clobber a concurrent write", func(t *testing.T) {
+		v, client, done := setup(t)
+		defer done()
+		if err := client.WriteSecret("secret/data/app", "user", "admin"); err != nil {
+			t.Fatalf("WriteSecret() got err: %v", err)
+		}
+
+		// another writer adds a key between our read and write
+		v.beforeWrite = func(path string) {
+			v.beforeWrite = nil
+			v.v2[path] = append(v.v2[path], map[string]interface{}{"user": "admin", "email": "admin@example.com"})
+		}
+		if err := client.WriteSecret("secret/data/app", "password", "hunter2"); err != nil {
+			t.Fatalf("WriteSecret() got err: %v", err)
+		}
+
+		versions := v.v2["secret/data/app"]
+		want := map[string]interface{}{"user": "admin", "email": "admin@example.com", "password": "hunter2"}
+		if len(versions) != 3 || !equalData(versions[2], want) {
+			t.Errorf("want secret %v, got versions %v", want, versions)
+		}
+	})
+
+	t.Run("KV version 2 should only write under data/", func(t *testing.T) {
+		_, client, done := setup(t)
+		defer done()
+		if err := client.WriteSecret("secret/app", "password", "hunter2"); err == nil {
+			t.Errorf("WriteSecret(): expected an error")
+		}
+	})
+
+	t.Run("it should find the engine without access to sys/mounts", func(t *testing.T) {
+		v, client, done := setup(t)
+		defer done()
+		v.denyMounts = true
+
+		if err := client.WriteSecret("secret/data/app", "password", "hunter2"); err != nil {
+			t.Fatalf("WriteSecret() got err: %v", err)
+		}
+		if got := v.v2["secret/data/app"]; len(got) != 1 {
+			t.Errorf("want 1 version of the secret, got %v", got)
+		}
+	})
+
+	t.Run("it should redact into a new KV version 2 secret", func(t *testing.T) {
+		_, client, done := setup(t)
+		defer done()
+
+		r := redactr.NewRegistry("aes")
+		if err := r.Register("vault", vault.NewRedacter(client)); err != nil {
+			t.Fatal(err)
+		}
+		redacted, err := r.RedactTokens("~~redact-vault:secret/data/new#password#hunter2~~")
+		if err != nil {
+			t.Fatalf("RedactTokens() got err: %v", err)
+		}
+		if want := "~~redacted-vault:secret/data/new#password@1~~"; redacted != want {
+			t.Errorf("RedactTokens() want %v, got %v", want, redacted)
+		}
+		unredacted, err := r.UnredactTokens(redacted)
+		if err != nil {
+			t.Fatalf("UnredactTokens() got err: %v", err)
+		}
+		if unredacted != "hunter2" {
+			t.Errorf("UnredactTokens() want hunter2, got %v", unredacted)
+		}
+	})
+}
+
+func equalData(a, b map[string]interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
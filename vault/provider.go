@@ -0,0 +1,31 @@
+package vault
+
+import "regexp"
+
+// unredactedPayloadRE matches the payload of an unredacted
+// token, like "path/to/kv/secret#my_key#my_value". The value
+// may hold whitespace, line breaks and escaped #s (as \#).
+var unredactedPayloadRE = regexp.MustCompile(`^[^#\s]+#[^#\s]+#(?s:[^#\\]|\\.|\\$)+$`)
+
+// redactedPayloadRE matches the payload of a redacted
+// token, like "path/to/kv/secret#my_key"
+var redactedPayloadRE = regexp.MustCompile(`^[^#\s]+#[^#\s]+$`)
+
+// MatchUnredactedPayload reports whether a payload
+// is a secret path, key and value
+func (r *Redacter) MatchUnredactedPayload(payload string) bool {
+	return unredactedPayloadRE.MatchString(payload)
+}
+
+// MatchRedactedPayload reports whether a payload
+// is a secret path and key
+func (r *Redacter) MatchRedactedPayload(payload string) bool {
+	return redactedPayloadRE.MatchString(payload)
+}
+
+// WrapUnredactedPayload appends an unredacted secret
+// to its path and key, like "path/to/kv/secret#my_key#my_value",
+// so that it can be redacted again
+func (r *Redacter) WrapUnredactedPayload(secret, redactedPayload string) string {
+	return redactedPayload + "#" + EscapeValue(secret)
+}
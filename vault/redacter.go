@@ -3,8 +3,10 @@ package vault
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/vault/api"
 )
@@ -13,13 +15,38 @@ import (
 // them in a Hashicorp Vault
 type Redacter struct {
 	client Client
+	latest bool
 }
 
+// A RedacterOption configures a new Redacter
+type RedacterOption func(*Redacter)
+
 // NewRedacter creates a new Redacter
-func NewRedacter(client Client) *Redacter {
-	return &Redacter{
+func NewRedacter(client Client, opts ...RedacterOption) *Redacter {
+	r := &Redacter{
 		client: client,
 	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// LatestVersions tells a Redacter to ignore the versions
+// that secrets are pinned to (like path/to/secret#key@7),
+// and read the latest version of every secret. Secrets
+// that it redacts are not pinned to a version.
+func LatestVersions(r *Redacter) {
+	r.latest = true
+}
+
+// Close closes the Redacter's Client, if it is
+// an io.Closer (like an AuthClientWrapper)
+func (r *Redacter) Close() error {
+	if c, ok := r.client.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
 }
 
 // Unredact replaces a Vault secret declaration with the
@@ -29,21 +56,44 @@ func NewRedacter(client Client) *Redacter {
 //
 //    path/to/secret#secret_key
 //
+// A declaration may pin the secret to a version, like:
+//
+//    path/to/secret#secret_key@7
+//
+// in which case that version is read (unless the Redacter
+// was created with LatestVersions). The Redacter's Client
+// must be a VersionedClient.
 func (r *Redacter) Unredact(secretDeclaration string) (string, error) {
 	ss := strings.Split(secretDeclaration, "#")
 	if len(ss) != 2 {
 		return "", fmt.Errorf("expected secret declaration with two parts, got %v", len(ss))
 	}
-	path, key := ss[0], ss[1]
+	path, key, version, err := splitVersion(ss[0], ss[1])
+	if err != nil {
+		return "", err
+	}
 
-	secret, err := r.client.ReadSecret(path, key)
+	var secret interface{}
+	if version > 0 && !r.latest {
+		vc, ok := r.client.(VersionedClient)
+		if !ok {
+			return "", fmt.Errorf("secret is pinned to version %v, but the Vault client does not support versions", version)
+		}
+		secret, err = vc.ReadSecretVersion(path, key, version)
+	} else {
+		secret, err = r.client.ReadSecret(path, key)
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to read secret: %v", err)
 	}
 	if secret == nil {
 		return "", fmt.Errorf("not found")
 	}
+	return formatValue(secret)
+}
 
+// formatValue formats the value of a secret
+func formatValue(secret interface{}) (string, error) {
 	switch typed := secret.(type) {
 	case string:
 		return typed, nil
@@ -64,18 +114,107 @@ func (r *Redacter) Unredact(secretDeclaration string) (string, error) {
 //
 //    path/to/secret#key#value
 //
+// A # in the value must be escaped as \#, and a
+// backslash before a # (or at the end of the value)
+// as \\. Other backslashes are kept as they are.
+//
+// If the Redacter's Client is a VersionedClient, the
+// redacted declaration is pinned to the version that
+// was written, like path/to/secret#key@8. If the input
+// is already pinned to a version which holds the value
+// (like path/to/secret#key@7#value), no new version
+// is written.
 func (r *Redacter) Redact(secretDeclaration string) (string, error) {
-	ss := strings.Split(secretDeclaration, "#")
+	ss := strings.SplitN(secretDeclaration, "#", 3)
 	if len(ss) != 3 {
 		return "", fmt.Errorf("expected secret declaration with three parts, got %v", len(ss))
 	}
-	path, key, value := ss[0], ss[1], ss[2]
+	path, key, version, err := splitVersion(ss[0], ss[1])
+	if err != nil {
+		return "", err
+	}
+	value, err := UnescapeValue(ss[2])
+	if err != nil {
+		return "", err
+	}
+
+	vc, ok := r.client.(VersionedClient)
+	if !ok || r.latest {
+		err = r.client.WriteSecret(path, key, value)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret: %v", err)
+		}
+		return fmt.Sprintf("%v#%v", path, key), nil
+	}
 
-	err := r.client.WriteSecret(path, key, value)
+	if version > 0 {
+		current, err := vc.ReadSecretVersion(path, key, version)
+		if err == nil && current != nil {
+			if s, err := formatValue(current); err == nil && s == value {
+				return fmt.Sprintf("%v#%v@%v", path, key, version), nil
+			}
+		}
+	}
+	version, err = vc.WriteSecretVersion(path, key, value)
 	if err != nil {
-		return "", fmt.Errorf("failed to read secret: %v", err)
+		return "", fmt.Errorf("failed to write secret: %v", err)
+	}
+	if version == 0 {
+		return fmt.Sprintf("%v#%v", path, key), nil
 	}
-	return fmt.Sprintf("%v#%v", path, key), nil
+	return fmt.Sprintf("%v#%v@%v", path, key, version), nil
+}
+
+// splitVersion splits the version that a secret is
+// pinned to (if any) from its key, like "password@7".
+// A key may hold an @ which isn't followed by a version.
+func splitVersion(path, key string) (string, string, int, error) {
+	i := strings.LastIndex(key, "@")
+	if i <= 0 || i == len(key)-1 || strings.Trim(key[i+1:], "0123456789") != "" {
+		return path, key, 0, nil
+	}
+	version, err := strconv.Atoi(key[i+1:])
+	if err != nil || version < 1 {
+		return "", "", 0, fmt.Errorf("invalid secret version %q", key[i+1:])
+	}
+	return path, key[:i], version, nil
+}
+
+// EscapeValue escapes a secret value for a secret
+// declaration, like path/to/secret#key#value.
+// See Redact.
+func EscapeValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '#':
+			b.WriteString(`\#`)
+		case c == '\\' && (i+1 == len(value) || value[i+1] == '#' || value[i+1] == '\\'):
+			b.WriteString(`\\`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// UnescapeValue unescapes the value of a secret
+// declaration. See Redact.
+func UnescapeValue(escaped string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(escaped); i++ {
+		c := escaped[i]
+		switch {
+		case c == '#':
+			return "", fmt.Errorf("expected # in a secret value to be escaped (as \\#)")
+		case c == '\\' && i+1 < len(escaped) && (escaped[i+1] == '#' || escaped[i+1] == '\\'):
+			b.WriteByte(escaped[i+1])
+			i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
 }
 
 // A Client can get secrets from a Hashicorp Vault instance
@@ -84,9 +223,25 @@ type Client interface {
 	WriteSecret(path, key, value string) error
 }
 
+// A VersionedClient is a Client which can read and write
+// versions of secrets (in a KV version 2 secrets engine)
+type VersionedClient interface {
+	// ReadSecretVersion reads a key from
+	// a version of the secret at path
+	ReadSecretVersion(path, key string, version int) (interface{}, error)
+
+	// WriteSecretVersion writes a key to the secret at
+	// path, and returns the version that it wrote (or
+	// zero, if the secret is not versioned)
+	WriteSecretVersion(path, key, value string) (version int, err error)
+}
+
 // StandardClientWrapper wraps the standard Vault client into a Client
 type StandardClientWrapper struct {
 	Client *api.Client
+
+	mu     sync.Mutex
+	mounts []kvMount // the KV mounts written to so far
 }
 
 // ReadSecret reads a secret using the standard Vault client
@@ -95,9 +250,35 @@ func (w *StandardClientWrapper) ReadSecret(path, key string) (interface{}, error
 	if err != nil {
 		return nil, fmt.Errorf("failed to read secret: %v", err)
 	}
+	v, _ := secretValue(secret, key)
+	return v, nil
+}
+
+// ReadSecretVersion reads a version of a KV version 2 secret
+// (like secret/data/my-secret) using the standard Vault client
+func (w *StandardClientWrapper) ReadSecretVersion(path, key string, version int) (interface{}, error) {
+	secret, err := w.Client.Logical().ReadWithData(path, map[string][]string{
+		"version": {strconv.Itoa(version)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %v", err)
+	}
 	if secret == nil || secret.Data == nil {
 		return nil, nil
 	}
+	v, versioned := secretValue(secret, key)
+	if !versioned {
+		return nil, fmt.Errorf("%v is not a KV version 2 secret, so it has no versions", path)
+	}
+	return v, nil
+}
+
+// secretValue returns the value of a key in a secret,
+// and whether the secret is a KV version 2 secret
+func secretValue(secret *api.Secret, key string) (interface{}, bool) {
+	if secret == nil || secret.Data == nil {
+		return nil, false
+	}
 
 	// Determine if this KV secret is version 1 or 2
 	//
@@ -117,35 +298,35 @@ func (w *StandardClientWrapper) ReadSecret(path, key string) (interface{}, error
 		kv, kvok := secret.Data["data"].(map[string]interface{})
 		if !mdok || !kvok || md["version"] == nil {
 			// treat this as a v1 secret
-			return secret.Data[key], nil
+			return secret.Data[key], false
 		}
 		// treat this as a v2 secret
-		return kv[key], nil
+		return kv[key], true
 	}
 
-	return secret.Data[key], nil
+	return secret.Data[key], false
 }
 
-// WriteSecret writes a secret using the standard Vault client
-// TODO(dhoelle): this is failing if the secret does not already exist
+// WriteSecret writes a secret using the standard Vault client.
+// The secret is created if it does not exist. See writeSecret.
 func (w *StandardClientWrapper) WriteSecret(path, key, value string) error {
-	// Fetch the existing vault secret, if one exists
-	secret, err := w.Client.Logical().Read(path)
+	_, err := w.writeSecret(path, key, value)
+	return err
+}
+
+// WriteSecretVersion writes a secret using the standard Vault
+// client, and returns the version that it wrote (if any)
+func (w *StandardClientWrapper) WriteSecretVersion(path, key, value string) (int, error) {
+	resp, err := w.writeSecret(path, key, value)
 	if err != nil {
-		return fmt.Errorf("failed to read secret: %v", err)
+		return 0, err
 	}
-
-	var data map[string]interface{}
-	if secret != nil && secret.Data != nil {
-		data = secret.Data
-	} else {
-		data = make(map[string]interface{})
+	if resp == nil || resp.Data == nil || resp.Data["version"] == nil {
+		return 0, nil
 	}
-	data[key] = value
-
-	_, err = w.Client.Logical().Write(path, data)
+	version, err := strconv.Atoi(fmt.Sprint(resp.Data["version"]))
 	if err != nil {
-		return fmt.Errorf("failed to write secret: %v", err)
+		return 0, fmt.Errorf("failed to parse the version of the secret: %v", err)
 	}
-	return nil
+	return version, nil
 }
@@ -0,0 +1,262 @@
+package vault_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhoelle/redactr"
+	"github.com/dhoelle/redactr/vault"
+)
+
+// memoryClient stores secrets in memory
+type memoryClient map[string]string
+
+func (c memoryClient) ReadSecret(path, key string) (interface{}, error) {
+	v, ok := c[path+"#"+key]
+	if !ok {
+		return nil, nil
+	}
+	return v, nil
+}
+
+func (c memoryClient) WriteSecret(path, key, value string) error {
+	c[path+"#"+key] = value
+	return nil
+}
+
+func TestRedacter_EscapedValues(t *testing.T) {
+	values := []string{
+		`hunter2`,
+		`has # a hash`,
+		`C:\windows\path`,
+		`trailing backslash\`,
+		`backslash before a hash \#`,
+		`\\#\#`,
+		"multiple\nlines with spaces",
+	}
+
+	for _, value := range values {
+		client := memoryClient{}
+		r := redactr.NewRegistry("aes")
+		if err := r.Register("vault", vault.NewRedacter(client)); err != nil {
+			t.Fatal(err)
+		}
+
+		// values with line breaks need a block token
+		token := "~~redact-vault:secret/app#password#" + vault.EscapeValue(value) + "~~"
+		if strings.Contains(value, "\n") {
+			token = "~~redact-vault<<EOF\nsecret/app#password#" + vault.EscapeValue(value) + "\nEOF~~"
+		}
+		redacted, err := r.RedactTokens(token)
+		if err != nil {
+			t.Errorf("%q: RedactTokens() got err: %v", value, err)
+			continue
+		}
+		if want := "~~redacted-vault:secret/app#password~~"; redacted != want {
+			t.Errorf("%q: RedactTokens()\n\twant %v\n\t got %v", value, want, redacted)
+		}
+		if got := client["secret/app#password"]; got != value {
+			t.Errorf("%q: RedactTokens() wrote %q to vault", value, got)
+		}
+
+		wrapped, err := r.UnredactTokens(redacted, redactr.WrapTokens)
+		if err != nil {
+			t.Errorf("%q: UnredactTokens() got err: %v", value, err)
+			continue
+		}
+		if wrapped != token {
+			t.Errorf("%q: UnredactTokens(WrapTokens)\n\twant %v\n\t got %v", value, token, wrapped)
+		}
+	}
+
+	t.Run("it should reject unescaped hashes in values", func(t *testing.T) {
+		_, err := vault.NewRedacter(memoryClient{}).Redact("secret/app#password#a#b")
+		if err == nil {
+			t.Errorf("Redact(): expected an error")
+		}
+	})
+}
+
+// versionedMemoryClient stores every
+// version of its secrets in memory
+type versionedMemoryClient map[string][]string
+
+func (c versionedMemoryClient) ReadSecret(path, key string) (interface{}, error) {
+	versions := c[path+"#"+key]
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	return versions[len(versions)-1], nil
+}
+
+func (c versionedMemoryClient) WriteSecret(path, key, value string) error {
+	_, err := c.WriteSecretVersion(path, key, value)
+	return err
+}
+
+func (c versionedMemoryClient) ReadSecretVersion(path, key string, version int) (interface{}, error) {
+	versions := c[path+"#"+key]
+	if version > len(versions) {
+		return nil, nil
+	}
+	return versions[version-1], nil
+}
+
+func (c versionedMemoryClient) WriteSecretVersion(path, key, value string) (int, error) {
+	c[path+"#"+key] = append(c[path+"#"+key], value)
+	return len(c[path+"#"+key]), nil
+}
+
+func TestRedacter_Versions(t *testing.T) {
+	newClient := func() versionedMemoryClient {
+		return versionedMemoryClient{"secret/data/db#password": {"hunter1", "hunter2", "hunter3"}}
+	}
+
+	t.Run("it should read the version that a secret is pinned to", func(t *testing.T) {
+		r := vault.NewRedacter(newClient())
+		tests := map[string]string{
+			"secret/data/db#password@2": "hunter2",
+			"secret/data/db#password@1": "hunter1",
+			"secret/data/db#password":   "hunter3",
+		}
+		for payload, want := range tests {
+			got, err := r.Unredact(payload)
+			if err != nil {
+				t.Errorf("Unredact(%q) got err: %v", payload, err)
+			} else if got != want {
+				t.Errorf("Unredact(%q) want %v, got %v", payload, want, got)
+			}
+		}
+		if _, err := r.Unredact("secret/data/db#password@4"); err == nil {
+			t.Errorf("Unredact(): expected an error for a missing version")
+		}
+		if _, err := r.Unredact("secret/data/db#password@0"); err == nil {
+			t.Errorf("Unredact(): expected an error for version 0")
+		}
+	})
+
+	t.Run("it should read the latest version with LatestVersions", func(t *testing.T) {
+		got, err := vault.NewRedacter(newClient(), vault.LatestVersions).Unredact("secret/data/db#password@1")
+		if err != nil {
+			t.Fatalf("Unredact() got err: %v", err)
+		}
+		if got != "hunter3" {
+			t.Errorf("Unredact() want hunter3, got %v", got)
+		}
+	})
+
+	t.Run("it should treat an @ which isn't followed by a version as part of the key", func(t *testing.T) {
+		client := versionedMemoryClient{"secret/app#user@example.com": {"hunter2"}}
+		got, err := vault.NewRedacter(client).Unredact("secret/app#user@example.com")
+		if err != nil {
+			t.Fatalf("Unredact() got err: %v", err)
+		}
+		if got != "hunter2" {
+			t.Errorf("Unredact() want hunter2, got %v", got)
+		}
+	})
+
+	t.Run("it should fail to read a pinned version with a client which has no versions", func(t *testing.T) {
+		client := memoryClient{"secret/data/db#password": "hunter2"}
+		if _, err := vault.NewRedacter(client).Unredact("secret/data/db#password@2"); err == nil {
+			t.Errorf("Unredact(): expected an error")
+		}
+	})
+
+	t.Run("it should pin redacted secrets to the version that was written", func(t *testing.T) {
+		client := newClient()
+		r := redactr.NewRegistry("aes")
+		if err := r.Register("vault", vault.NewRedacter(client)); err != nil {
+			t.Fatal(err)
+		}
+
+		redacted, err := r.RedactTokens("~~redact-vault:secret/data/db#password#swordfish~~")
+		if err != nil {
+			t.Fatalf("RedactTokens() got err: %v", err)
+		}
+		if want := "~~redacted-vault:secret/data/db#password@4~~"; redacted != want {
+			t.Errorf("RedactTokens() want %v, got %v", want, redacted)
+		}
+
+		// unredacting and wrapping keeps the version,
+		// and redacting again doesn't write a new one
+		wrapped, err := r.UnredactTokens(redacted, redactr.WrapTokens)
+		if err != nil {
+			t.Fatalf("UnredactTokens() got err: %v", err)
+		}
+		if want := "~~redact-vault:secret/data/db#password@4#swordfish~~"; wrapped != want {
+			t.Errorf("UnredactTokens(WrapTokens) want %v, got %v", want, wrapped)
+		}
+		again, err := r.RedactTokens(wrapped)
+		if err != nil {
+			t.Fatalf("RedactTokens() got err: %v", err)
+		}
+		if again != redacted {
+			t.Errorf("RedactTokens() want %v, got %v", redacted, again)
+		}
+		if n := len(client["secret/data/db#password"]); n != 4 {
+			t.Errorf("RedactTokens(): want 4 versions, got %v", n)
+		}
+
+		// changing the value writes a new version
+		changed := strings.Replace(wrapped, "swordfish", "hunter5", 1)
+		again, err = r.RedactTokens(changed)
+		if err != nil {
+			t.Fatalf("RedactTokens() got err: %v", err)
+		}
+		if want := "~~redacted-vault:secret/data/db#password@5~~"; again != want {
+			t.Errorf("RedactTokens() want %v, got %v", want, again)
+		}
+	})
+
+	t.Run("it should keep the version when wrapping with a TokenWrapper", func(t *testing.T) {
+		w := &vault.TokenWrapper{Before: "~~redact-vault:", After: "~~"}
+		got := w.WrapToken("hunter2", "secret/data/db#password@2", "~~redacted-vault:secret/data/db#password@2~~")
+		if want := "~~redact-vault:secret/data/db#password@2#hunter2~~"; got != want {
+			t.Errorf("WrapToken() want %v, got %v", want, got)
+		}
+	})
+}
+
+func TestStandardClientWrapper_ReadSecretVersion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/secret/data/db":
+			version := r.URL.Query().Get("version")
+			writeJSON(w, map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     map[string]interface{}{"password": "hunter" + version},
+					"metadata": map[string]interface{}{"version": version},
+				},
+			})
+		case "/v1/kv1/db":
+			writeJSON(w, map[string]interface{}{
+				"data": map[string]interface{}{"password": "hunter2"},
+			})
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	client := &vault.StandardClientWrapper{Client: newTestClient(t, srv.URL)}
+
+	got, err := client.ReadSecretVersion("secret/data/db", "password", 7)
+	if err != nil {
+		t.Fatalf("ReadSecretVersion() got err: %v", err)
+	}
+	if got != "hunter7" {
+		t.Errorf("ReadSecretVersion() want hunter7, got %v", got)
+	}
+
+	if _, err := client.ReadSecretVersion("kv1/db", "password", 7); err == nil {
+		t.Errorf("ReadSecretVersion(): expected an error for a KV version 1 secret")
+	}
+}
+
+func ExampleEscapeValue() {
+	fmt.Println(vault.EscapeValue(`a#b\#c`))
+	// Output: a\#b\\\#c
+}
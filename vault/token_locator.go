@@ -63,9 +63,10 @@ var UnredactedRE = regexp.MustCompile(`` +
 	// A literal # must separate the key and value
 	`#` +
 
-	// Match the secret value, which can
-	// be any non-whitespace characters besides #
-	`[^#\s]+` +
+	// Match the secret value, which can be any
+	// characters (including whitespace and line
+	// breaks), with # escaped as \#
+	`(?s:[^#\\]|\\.)+?` +
 
 	// Close capturing group
 	`)` +
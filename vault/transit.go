@@ -0,0 +1,272 @@
+package vault
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// DefaultTransitMount is the path that the
+// transit secrets engine is usually mounted at
+const DefaultTransitMount = "transit"
+
+// A TransitClient encrypts, decrypts and rewraps data with
+// the named keys of a transit secrets engine. Each method
+// takes a batch of inputs, and returns one output for each
+// of them, in the same order.
+type TransitClient interface {
+	// Encrypt encrypts plaintexts with a key,
+	// returning ciphertexts like "vault:v1:..."
+	Encrypt(mount, key string, plaintexts []string) ([]string, error)
+
+	// Decrypt decrypts ciphertexts with a key
+	Decrypt(mount, key string, ciphertexts []string) ([]string, error)
+
+	// Rewrap re-encrypts ciphertexts with the latest
+	// version of a key, without revealing the plaintexts
+	Rewrap(mount, key string, ciphertexts []string) ([]string, error)
+}
+
+// A TransitRedacter redacts secrets by encrypting them
+// with Vault's transit secrets engine. Secrets are not
+// stored in Vault: the ciphertext is the redacted payload.
+//
+// It redacts payloads like:
+//
+//    keyname:hunter2
+//
+// into payloads like:
+//
+//    keyname:vault:v1:8SDd3WHDOjf7mq69CyCqYjBXAiQQAVZRkFM13ok481zoCmHnSeDX9vyf7w==
+//
+// Batches of payloads (like the tokens in a file) are sent
+// to Vault in one request per key (see RedactBatch and
+// UnredactBatch).
+type TransitRedacter struct {
+	client TransitClient
+	mount  string
+}
+
+// NewTransitRedacter creates a new TransitRedacter, for
+// the transit secrets engine mounted at mount (by default,
+// DefaultTransitMount)
+func NewTransitRedacter(client TransitClient, mount string) *TransitRedacter {
+	return &TransitRedacter{
+		client: client,
+		mount:  mountOrDefault(mount, DefaultTransitMount),
+	}
+}
+
+// transitUnredactedPayloadRE matches the payload of an
+// unredacted token, like "keyname:hunter2". The secret
+// may hold anything (including colons).
+var transitUnredactedPayloadRE = regexp.MustCompile(`^[^:\s/]+:(?s:.*)$`)
+
+// transitRedactedPayloadRE matches the payload of a
+// redacted token, like "keyname:vault:v1:8SDd3WHD..."
+var transitRedactedPayloadRE = regexp.MustCompile(`^[^:\s/]+:vault:v[0-9]+:[A-Za-z0-9+/=]+$`)
+
+// Redact encrypts a secret with a transit key
+func (r *TransitRedacter) Redact(payload string) (string, error) {
+	redacted, err := r.RedactBatch([]string{payload})
+	if err != nil {
+		return "", err
+	}
+	return redacted[0], nil
+}
+
+// Unredact decrypts a secret with a transit key
+func (r *TransitRedacter) Unredact(payload string) (string, error) {
+	unredacted, err := r.UnredactBatch([]string{payload})
+	if err != nil {
+		return "", err
+	}
+	return unredacted[0], nil
+}
+
+// RedactBatch encrypts many secrets, with one
+// request to Vault for each key that they use
+func (r *TransitRedacter) RedactBatch(payloads []string) ([]string, error) {
+	return r.batch(payloads, false, "encrypt", func(key string, inputs []string) ([]string, error) {
+		outputs, err := r.client.Encrypt(r.mount, key, inputs)
+		if err != nil {
+			return nil, err
+		}
+		for i := range outputs {
+			outputs[i] = key + ":" + outputs[i]
+		}
+		return outputs, nil
+	})
+}
+
+// UnredactBatch decrypts many secrets, with one
+// request to Vault for each key that they use
+func (r *TransitRedacter) UnredactBatch(payloads []string) ([]string, error) {
+	return r.batch(payloads, true, "decrypt", func(key string, inputs []string) ([]string, error) {
+		return r.client.Decrypt(r.mount, key, inputs)
+	})
+}
+
+// RewrapPayloads re-encrypts many redacted secrets with the
+// latest versions of their keys (after a key is rotated),
+// with one request to Vault for each key. The secrets
+// are never sent back to redactr.
+func (r *TransitRedacter) RewrapPayloads(payloads []string) ([]string, error) {
+	return r.batch(payloads, true, "rewrap", func(key string, inputs []string) ([]string, error) {
+		outputs, err := r.client.Rewrap(r.mount, key, inputs)
+		if err != nil {
+			return nil, err
+		}
+		for i := range outputs {
+			outputs[i] = key + ":" + outputs[i]
+		}
+		return outputs, nil
+	})
+}
+
+// batch splits payloads (like "keyname:hunter2") into their
+// keys and data, and calls f once for each key, with the
+// data of that key's payloads. It returns the outputs of f
+// in the order of the payloads.
+func (r *TransitRedacter) batch(payloads []string, redacted bool, op string, f func(key string, inputs []string) ([]string, error)) ([]string, error) {
+	match, want := r.MatchUnredactedPayload, "keyname:secret"
+	if redacted {
+		match, want = r.MatchRedactedPayload, "keyname:vault:v1:..."
+	}
+
+	var keys []string
+	inputs := make(map[string][]string)
+	indexes := make(map[string][]int)
+	for i, p := range payloads {
+		if !match(p) {
+			return nil, fmt.Errorf("expected a payload like %v, got %q", want, p)
+		}
+		ss := strings.SplitN(p, ":", 2)
+		key := ss[0]
+		if _, ok := inputs[key]; !ok {
+			keys = append(keys, key)
+		}
+		inputs[key] = append(inputs[key], ss[1])
+		indexes[key] = append(indexes[key], i)
+	}
+
+	outputs := make([]string, len(payloads))
+	for _, key := range keys {
+		results, err := f(key, inputs[key])
+		if err != nil {
+			return nil, fmt.Errorf("failed to %v with transit key %v: %v", op, key, err)
+		}
+		if len(results) != len(inputs[key]) {
+			return nil, fmt.Errorf("failed to %v with transit key %v: expected %v results, got %v", op, key, len(inputs[key]), len(results))
+		}
+		for i, j := range indexes[key] {
+			outputs[j] = results[i]
+		}
+	}
+	return outputs, nil
+}
+
+// MatchUnredactedPayload reports whether a
+// payload is a key name and a secret
+func (r *TransitRedacter) MatchUnredactedPayload(payload string) bool {
+	return transitUnredactedPayloadRE.MatchString(payload)
+}
+
+// MatchRedactedPayload reports whether a
+// payload is a key name and a ciphertext
+func (r *TransitRedacter) MatchRedactedPayload(payload string) bool {
+	return transitRedactedPayloadRE.MatchString(payload)
+}
+
+// WrapUnredactedPayload prefixes an unredacted secret with
+// its key name, like "keyname:hunter2", so that it can be
+// redacted again
+func (r *TransitRedacter) WrapUnredactedPayload(secret, redactedPayload string) string {
+	return strings.SplitN(redactedPayload, ":", 2)[0] + ":" + secret
+}
+
+// Close closes the TransitRedacter's client, if it
+// is an io.Closer (like an AuthClientWrapper)
+func (r *TransitRedacter) Close() error {
+	if c, ok := r.client.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Encrypt encrypts plaintexts using the standard
+// Vault client, and the batch encrypt endpoint
+func (w *StandardClientWrapper) Encrypt(mount, key string, plaintexts []string) ([]string, error) {
+	var batch []map[string]interface{}
+	for _, p := range plaintexts {
+		batch = append(batch, map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString([]byte(p)),
+		})
+	}
+	return w.transit(mount+"/encrypt/"+key, batch, "ciphertext")
+}
+
+// Decrypt decrypts ciphertexts using the standard
+// Vault client, and the batch decrypt endpoint
+func (w *StandardClientWrapper) Decrypt(mount, key string, ciphertexts []string) ([]string, error) {
+	results, err := w.transit(mount+"/decrypt/"+key, ciphertextBatch(ciphertexts), "plaintext")
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range results {
+		b, err := base64.StdEncoding.DecodeString(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode plaintext %v: %v", i, err)
+		}
+		results[i] = string(b)
+	}
+	return results, nil
+}
+
+// Rewrap rewraps ciphertexts using the standard
+// Vault client, and the batch rewrap endpoint
+func (w *StandardClientWrapper) Rewrap(mount, key string, ciphertexts []string) ([]string, error) {
+	return w.transit(mount+"/rewrap/"+key, ciphertextBatch(ciphertexts), "ciphertext")
+}
+
+func ciphertextBatch(ciphertexts []string) []map[string]interface{} {
+	var batch []map[string]interface{}
+	for _, c := range ciphertexts {
+		batch = append(batch, map[string]interface{}{"ciphertext": c})
+	}
+	return batch
+}
+
+// transit writes a batch to a transit endpoint, and
+// returns the field of each of the batch's results
+func (w *StandardClientWrapper) transit(path string, batch []map[string]interface{}, field string) ([]string, error) {
+	secret, err := w.Client.Logical().Write(path, map[string]interface{}{
+		"batch_input": batch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %v: %v", path, err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("failed to write %v: no response was returned", path)
+	}
+	results, ok := secret.Data["batch_results"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to write %v: no batch results were returned", path)
+	}
+
+	values := make([]string, len(results))
+	for i, r := range results {
+		result, _ := r.(map[string]interface{})
+		if msg, _ := result["error"].(string); msg != "" {
+			return nil, fmt.Errorf("failed on input %v: %v", i, msg)
+		}
+		v, ok := result[field].(string)
+		if !ok {
+			return nil, fmt.Errorf("failed on input %v: no %v was returned", i, field)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
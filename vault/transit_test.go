@@ -0,0 +1,219 @@
+package vault_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dhoelle/redactr"
+	"github.com/dhoelle/redactr/vault"
+)
+
+// fakeTransit is a stand-in for a transit secrets engine,
+// mounted at transit/. Its "ciphertexts" hold the version
+// of the key and the plaintext, in base64.
+type fakeTransit struct {
+	mu       sync.Mutex
+	versions map[string]int // key name => latest version
+	requests []string       // the paths of requests
+}
+
+func newFakeTransit(keys ...string) *fakeTransit {
+	v := &fakeTransit{versions: make(map[string]int)}
+	for _, k := range keys {
+		v.versions[k] = 1
+	}
+	return v
+}
+
+func (v *fakeTransit) rotate(key string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.versions[key]++
+}
+
+func (v *fakeTransit) encrypt(key string, version int, plaintext string) string {
+	return fmt.Sprintf("vault:v%v:%v", version, base64.StdEncoding.EncodeToString([]byte(key+":"+plaintext)))
+}
+
+func (v *fakeTransit) decrypt(key, ciphertext string) (string, error) {
+	ss := strings.SplitN(ciphertext, ":", 3)
+	if len(ss) != 3 || ss[0] != "vault" {
+		return "", fmt.Errorf("invalid ciphertext")
+	}
+	b, err := base64.StdEncoding.DecodeString(ss[2])
+	if err != nil || !strings.HasPrefix(string(b), key+":") {
+		return "", fmt.Errorf("cipher: message authentication failed")
+	}
+	return base64.StdEncoding.EncodeToString([]byte(strings.TrimPrefix(string(b), key+":"))), nil
+}
+
+func (v *fakeTransit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	v.requests = append(v.requests, path)
+	ss := strings.Split(path, "/")
+	if len(ss) != 3 || ss[0] != "transit" || r.Method != http.MethodPut && r.Method != http.MethodPost {
+		http.Error(w, `{"errors":["no handler for route"]}`, http.StatusNotFound)
+		return
+	}
+	op, key := ss[1], ss[2]
+	version, ok := v.versions[key]
+	if !ok {
+		http.Error(w, `{"errors":["encryption key not found"]}`, http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		BatchInput []map[string]string `json:"batch_input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.BatchInput) == 0 {
+		http.Error(w, `{"errors":["missing batch input"]}`, http.StatusBadRequest)
+		return
+	}
+
+	var results []map[string]string
+	for _, in := range body.BatchInput {
+		switch op {
+		case "encrypt":
+			b, _ := base64.StdEncoding.DecodeString(in["plaintext"])
+			results = append(results, map[string]string{"ciphertext": v.encrypt(key, version, string(b))})
+		case "decrypt", "rewrap":
+			plaintext, err := v.decrypt(key, in["ciphertext"])
+			if err != nil {
+				results = append(results, map[string]string{"error": err.Error()})
+				continue
+			}
+			if op == "decrypt" {
+				results = append(results, map[string]string{"plaintext": plaintext})
+				continue
+			}
+			b, _ := base64.StdEncoding.DecodeString(plaintext)
+			results = append(results, map[string]string{"ciphertext": v.encrypt(key, version, string(b))})
+		default:
+			http.Error(w, `{"errors":["no handler for route"]}`, http.StatusNotFound)
+			return
+		}
+	}
+	writeJSON(w, map[string]interface{}{
+		"data": map[string]interface{}{"batch_results": results},
+	})
+}
+
+func TestTransitRedacter(t *testing.T) {
+	setup := func(t *testing.T) (*fakeTransit, *redactr.Registry, func()) {
+		v := newFakeTransit("app", "db")
+		srv := httptest.NewServer(v)
+		client := &vault.StandardClientWrapper{Client: newTestClient(t, srv.URL)}
+		r := redactr.NewRegistry("aes")
+		if err := r.Register("vault-transit", vault.NewTransitRedacter(client, "")); err != nil {
+			t.Fatal(err)
+		}
+		return v, r, srv.Close
+	}
+
+	t.Run("it should encrypt and decrypt secrets", func(t *testing.T) {
+		_, r, done := setup(t)
+		defer done()
+
+		redacted, err := r.RedactTokens("~~redact-vault-transit:app:hunter2:with:colons~~")
+		if err != nil {
+			t.Fatalf("RedactTokens() got err: %v", err)
+		}
+		if !strings.HasPrefix(redacted, "~~redacted-vault-transit:app:vault:v1:") {
+			t.Errorf("RedactTokens() want a transit ciphertext, got %v", redacted)
+		}
+		unredacted, err := r.UnredactTokens(redacted)
+		if err != nil {
+			t.Fatalf("UnredactTokens() got err: %v", err)
+		}
+		if unredacted != "hunter2:with:colons" {
+			t.Errorf("UnredactTokens() want hunter2:with:colons, got %v", unredacted)
+		}
+
+		wrapped, err := r.UnredactTokens(redacted, redactr.WrapTokens)
+		if err != nil {
+			t.Fatalf("UnredactTokens() got err: %v", err)
+		}
+		if want := "~~redact-vault-transit:app:hunter2:with:colons~~"; wrapped != want {
+			t.Errorf("UnredactTokens(WrapTokens) want %v, got %v", want, wrapped)
+		}
+	})
+
+	t.Run("it should send the tokens of a file in one request per key", func(t *testing.T) {
+		v, r, done := setup(t)
+		defer done()
+
+		var lines []string
+		for i := 0; i < 10; i++ {
+			key := []string{"app", "db"}[i%2]
+			lines = append(lines, "secret"+strconv.Itoa(i)+": ~~redact-vault-transit:"+key+":value"+strconv.Itoa(i)+"~~")
+		}
+		redacted, err := r.RedactTokens(strings.Join(lines, "\n"))
+		if err != nil {
+			t.Fatalf("RedactTokens() got err: %v", err)
+		}
+		unredacted, err := r.UnredactTokens(redacted)
+		if err != nil {
+			t.Fatalf("UnredactTokens() got err: %v", err)
+		}
+		if !strings.Contains(unredacted, "secret9: value9") || strings.Contains(unredacted, "~~") {
+			t.Errorf("UnredactTokens() want every secret, got %v", unredacted)
+		}
+
+		want := []string{"transit/encrypt/app", "transit/encrypt/db", "transit/decrypt/app", "transit/decrypt/db"}
+		if fmt.Sprint(v.requests) != fmt.Sprint(want) {
+			t.Errorf("want requests %v, got %v", want, v.requests)
+		}
+	})
+
+	t.Run("it should rewrap secrets after a key is rotated", func(t *testing.T) {
+		v, r, done := setup(t)
+		defer done()
+
+		redacted, err := r.RedactTokens("a: ~~redact-vault-transit:app:hunter2~~\nb: ~~redact-vault-transit:db:swordfish~~")
+		if err != nil {
+			t.Fatalf("RedactTokens() got err: %v", err)
+		}
+		v.rotate("app")
+
+		rewrapped, n, err := r.RewrapTokens(redacted)
+		if err != nil {
+			t.Fatalf("RewrapTokens() got err: %v", err)
+		}
+		if n != 2 {
+			t.Errorf("RewrapTokens() want 2 tokens rewrapped, got %v", n)
+		}
+		if !strings.Contains(rewrapped, "~~redacted-vault-transit:app:vault:v2:") || !strings.Contains(rewrapped, "~~redacted-vault-transit:db:vault:v1:") {
+			t.Errorf("RewrapTokens() want tokens under the latest key versions, got %v", rewrapped)
+		}
+		unredacted, err := r.UnredactTokens(rewrapped)
+		if err != nil {
+			t.Fatalf("UnredactTokens() got err: %v", err)
+		}
+		if want := "a: hunter2\nb: swordfish"; unredacted != want {
+			t.Errorf("UnredactTokens() want %v, got %v", want, unredacted)
+		}
+	})
+
+	t.Run("it should fail if any secret fails to decrypt", func(t *testing.T) {
+		_, r, done := setup(t)
+		defer done()
+
+		forged := "~~redacted-vault-transit:app:vault:v1:" + base64.StdEncoding.EncodeToString([]byte("db:hunter2")) + "~~"
+		if _, err := r.UnredactTokens("~~redacted-vault-transit:app:vault:v1:YXBwOm9r~~ " + forged); err == nil {
+			t.Errorf("UnredactTokens(): expected an error")
+		}
+		if _, err := r.RedactTokens("~~redact-vault-transit:missing:hunter2~~"); err == nil {
+			t.Errorf("RedactTokens(): expected an error for a missing key")
+		}
+	})
+}
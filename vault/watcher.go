@@ -0,0 +1,166 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dhoelle/redactr/watch"
+)
+
+// A MetadataClient is a Client which can read the
+// version of a secret, without reading the secret
+type MetadataClient interface {
+	// SecretVersion returns a version of the secret at
+	// path, which changes whenever the secret does, and
+	// the secret's lease duration (zero if it has none)
+	SecretVersion(path string) (version string, ttl time.Duration, err error)
+}
+
+// SecretVersion returns the version of a secret. For a
+// KV version 2 secret (like secret/data/my-secret), this
+// is the current version in the secret's metadata. Other
+// secrets (and KV version 2 secrets whose metadata can't
+// be read, as a policy may only grant access to data/)
+// are read, and their version is a hash of their data.
+func (w *StandardClientWrapper) SecretVersion(path string) (string, time.Duration, error) {
+	if i := strings.Index(path, "/data/"); i >= 0 {
+		metadataPath := path[:i] + "/metadata/" + path[i+len("/data/"):]
+		md, err := w.Client.Logical().Read(metadataPath)
+		if err == nil && md != nil && md.Data != nil && md.Data["current_version"] != nil {
+			return fmt.Sprint(md.Data["current_version"]), 0, nil
+		}
+		// not a KV version 2 secret, or its
+		// metadata can't be read
+	}
+
+	secret, err := w.Client.Logical().Read(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read secret: %v", err)
+	}
+	if secret == nil {
+		return "", 0, nil
+	}
+	b, err := json.Marshal(secret.Data)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to marshal secret data: %v", err)
+	}
+	sum := sha256.Sum256(b)
+	ttl := time.Duration(secret.LeaseDuration) * time.Second
+	return hex.EncodeToString(sum[:]), ttl, nil
+}
+
+// WatchPayloads returns a Watcher for the secrets behind
+// redacted payloads (like "path/to/secret#key"), which
+// polls the version of each secret every interval.
+// Secrets with a lease are checked when about two thirds
+// of the lease has passed, instead. Secrets which are
+// pinned to a version (like "path/to/secret#key@7") are
+// not watched.
+//
+// If the Redacter's Client is not a MetadataClient,
+// WatchPayloads returns nil.
+func (r *Redacter) WatchPayloads(payloads []string, interval time.Duration) (watch.Watcher, error) {
+	client, ok := r.client.(MetadataClient)
+	if !ok {
+		return nil, nil
+	}
+
+	unique := make(map[string]bool)
+	var paths []string
+	for _, p := range payloads {
+		ss := strings.SplitN(p, "#", 2)
+		path := ss[0]
+		if len(ss) == 2 && !r.latest {
+			// secrets pinned to a version don't change
+			if _, _, version, _ := splitVersion(path, ss[1]); version > 0 {
+				continue
+			}
+		}
+		if !unique[path] {
+			unique[path] = true
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	return &versionWatcher{
+		client:   client,
+		paths:    paths,
+		interval: interval,
+	}, nil
+}
+
+// A versionWatcher watches the versions
+// of secrets in Vault
+type versionWatcher struct {
+	client   MetadataClient
+	paths    []string
+	interval time.Duration
+}
+
+// Watch polls the version of each secret
+func (w *versionWatcher) Watch(ctx context.Context, changed func()) error {
+	if len(w.paths) == 0 {
+		return watch.Never().Watch(ctx, changed)
+	}
+
+	versions := make(map[string]string, len(w.paths))
+	due := make(map[string]time.Time, len(w.paths))
+	for _, path := range w.paths {
+		v, ttl, err := w.client.SecretVersion(path)
+		if err != nil {
+			return fmt.Errorf("failed to read the version of %v: %v", path, err)
+		}
+		versions[path] = v
+		due[path] = time.Now().Add(w.wait(ttl))
+	}
+
+	for {
+		// wait for the next secret which is due
+		var next time.Time
+		for _, t := range due {
+			if next.IsZero() || t.Before(next) {
+				next = t
+			}
+		}
+		if !watch.Sleep(ctx, time.Until(next)) {
+			return nil
+		}
+
+		now := time.Now()
+		isChanged := false
+		for _, path := range w.paths {
+			if due[path].After(now) {
+				continue
+			}
+			v, ttl, err := w.client.SecretVersion(path)
+			if err != nil {
+				return fmt.Errorf("failed to read the version of %v: %v", path, err)
+			}
+			if v != versions[path] {
+				versions[path] = v
+				isChanged = true
+			}
+			due[path] = now.Add(w.wait(ttl))
+		}
+		if isChanged {
+			changed()
+		}
+	}
+}
+
+// wait returns how long to wait before checking a secret
+// again: about two thirds of its lease, if it has one,
+// or the polling interval
+func (w *versionWatcher) wait(ttl time.Duration) time.Duration {
+	if ttl > 0 {
+		return watch.Jitter(ttl*2/3, watch.DefaultJitter)
+	}
+	return watch.Jitter(w.interval, watch.DefaultJitter)
+}
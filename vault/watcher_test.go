@@ -0,0 +1,160 @@
+package vault_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dhoelle/redactr/vault"
+)
+
+// versionClient is a memoryClient which
+// can read the versions of its secrets
+type versionClient struct {
+	memoryClient
+	mu       sync.Mutex
+	versions map[string]int
+	ttls     map[string]time.Duration
+	reads    map[string]int
+}
+
+func (c *versionClient) SecretVersion(path string) (string, time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reads[path]++
+	return string(rune('0' + c.versions[path])), c.ttls[path], nil
+}
+
+func (c *versionClient) bump(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions[path]++
+}
+
+func (c *versionClient) readsOf(path string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reads[path]
+}
+
+func TestRedacter_WatchPayloads(t *testing.T) {
+	newClient := func() *versionClient {
+		return &versionClient{
+			memoryClient: memoryClient{},
+			versions:     map[string]int{},
+			ttls:         map[string]time.Duration{},
+			reads:        map[string]int{},
+		}
+	}
+
+	t.Run("it should not watch with a client which can't read versions", func(t *testing.T) {
+		w, err := vault.NewRedacter(memoryClient{}).WatchPayloads([]string{"secret/data/a#b"}, time.Second)
+		if err != nil || w != nil {
+			t.Errorf("Redacter.WatchPayloads() = %v, %v, want nil, nil", w, err)
+		}
+	})
+
+	t.Run("it should report a change when the version of a secret changes", func(t *testing.T) {
+		client := newClient()
+		w, err := vault.NewRedacter(client).WatchPayloads([]string{"secret/data/a#b", "secret/data/a#c"}, 5*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Redacter.WatchPayloads() got err: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changes := make(chan struct{}, 10)
+		go w.Watch(ctx, func() { changes <- struct{}{} })
+
+		select {
+		case <-changes:
+			t.Fatalf("Watch(): expected no change before the secret changes")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		client.bump("secret/data/a")
+		select {
+		case <-changes:
+		case <-time.After(time.Second):
+			t.Fatalf("Watch(): expected a change when the secret changes")
+		}
+	})
+
+	t.Run("it should not watch secrets which are pinned to a version", func(t *testing.T) {
+		client := newClient()
+		w, err := vault.NewRedacter(client).WatchPayloads([]string{"secret/data/a#b@3"}, 5*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Redacter.WatchPayloads() got err: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := w.Watch(ctx, func() {}); err != nil {
+			t.Fatalf("Watch() got err: %v", err)
+		}
+		if n := client.readsOf("secret/data/a"); n != 0 {
+			t.Errorf("Watch(): expected the pinned secret not to be read, got %v reads", n)
+		}
+	})
+
+	t.Run("it should check secrets with a lease when most of the lease has passed", func(t *testing.T) {
+		client := newClient()
+		client.ttls["database/creds/leased"] = 300 * time.Millisecond
+		w, err := vault.NewRedacter(client).WatchPayloads([]string{"database/creds/leased#password", "secret/data/a#b"}, 10*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Redacter.WatchPayloads() got err: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+		defer cancel()
+		if err := w.Watch(ctx, func() {}); err != nil {
+			t.Fatalf("Watch() got err: %v", err)
+		}
+		if n := client.readsOf("database/creds/leased"); n != 1 {
+			t.Errorf("Watch(): expected the leased secret to be read once (before its lease is two thirds done), got %v", n)
+		}
+		if n := client.readsOf("secret/data/a"); n < 5 {
+			t.Errorf("Watch(): expected the unleased secret to be read every interval, got %v reads", n)
+		}
+	})
+}
+
+func TestStandardClientWrapper_SecretVersion(t *testing.T) {
+	v := newFakeKV()
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+	client := &vault.StandardClientWrapper{Client: newTestClient(t, srv.URL)}
+	if err := client.WriteSecret("secret/data/app", "password", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("it should read the version from the secret's metadata", func(t *testing.T) {
+		version, _, err := client.SecretVersion("secret/data/app")
+		if err != nil || version != "1" {
+			t.Errorf("SecretVersion() = %v, %v, want 1", version, err)
+		}
+	})
+
+	t.Run("it should hash the secret if its metadata can't be read", func(t *testing.T) {
+		v.mu.Lock()
+		v.denyMeta = true
+		v.mu.Unlock()
+
+		before, _, err := client.SecretVersion("secret/data/app")
+		if err != nil {
+			t.Fatalf("SecretVersion() got err: %v", err)
+		}
+		if err := client.WriteSecret("secret/data/app", "password", "swordfish"); err != nil {
+			t.Fatal(err)
+		}
+		after, _, err := client.SecretVersion("secret/data/app")
+		if err != nil {
+			t.Fatalf("SecretVersion() got err: %v", err)
+		}
+		if before == "" || before == after {
+			t.Errorf("SecretVersion(): want a version which changes with the secret, got %q then %q", before, after)
+		}
+	})
+}
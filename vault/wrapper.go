@@ -11,5 +11,5 @@ type TokenWrapper struct {
 
 // WrapToken wraps the string with Before and After
 func (w *TokenWrapper) WrapToken(token, originalPayload, originalEnvelope string) string {
-	return fmt.Sprintf("%v%v#%v%v", w.Before, originalPayload, token, w.After)
+	return fmt.Sprintf("%v%v#%v%v", w.Before, originalPayload, EscapeValue(token), w.After)
 }
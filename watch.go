@@ -0,0 +1,82 @@
+package redactr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dhoelle/redactr/watch"
+)
+
+// A PayloadWatcher is a Provider which can watch the
+// secrets behind redacted payloads for changes, more
+// cheaply than by unredacting them again (for example,
+// by polling the version of a secret, rather than
+// reading it).
+type PayloadWatcher interface {
+	// WatchPayloads returns a Watcher for the secrets
+	// behind the given redacted payloads. A Watcher which
+	// polls should poll about every interval. If the
+	// payloads can't be watched, WatchPayloads returns
+	// nil, and the caller should poll instead.
+	WatchPayloads(payloads []string, interval time.Duration) (watch.Watcher, error)
+}
+
+// Watchers returns a Watcher for the secrets behind the
+// redacted tokens in docs, for each provider which is a
+// PayloadWatcher. interval gives the polling interval
+// for each provider.
+//
+// Watchers also returns the names of the providers with
+// redacted tokens in docs which can't be watched, and so
+// must be polled (by unredacting their tokens again).
+func (r *Registry) Watchers(docs []string, interval func(provider string) time.Duration) (watchers []watch.Watcher, unwatched []string, err error) {
+	return r.watchers(docs, interval, func(Provider) bool { return true })
+}
+
+// leaseWatchers returns a Watcher for the leased secrets
+// behind the redacted tokens in docs, for each provider
+// which is a LeaseRevoker and PayloadWatcher. (Leases of
+// providers which can't be watched are not polled.)
+func (r *Registry) leaseWatchers(docs []string, interval func(provider string) time.Duration) ([]watch.Watcher, error) {
+	watchers, _, err := r.watchers(docs, interval, func(p Provider) bool {
+		_, ok := p.(LeaseRevoker)
+		return ok
+	})
+	return watchers, err
+}
+
+// watchers is like Watchers, for the
+// providers which include accepts
+func (r *Registry) watchers(docs []string, interval func(provider string) time.Duration, include func(Provider) bool) (watchers []watch.Watcher, unwatched []string, err error) {
+	// collect the payloads of each provider's tokens
+	payloads := make(map[string][]string)
+	for _, s := range docs {
+		for _, t := range r.locate(s) {
+			if t.redacted {
+				payloads[t.provider] = append(payloads[t.provider], s[t.PayloadStart:t.PayloadEnd])
+			}
+		}
+	}
+
+	for _, name := range r.Names() {
+		ps, ok := payloads[name]
+		if !ok || !include(r.providers[name]) {
+			continue
+		}
+		pw, ok := r.providers[name].(PayloadWatcher)
+		if !ok {
+			unwatched = append(unwatched, name)
+			continue
+		}
+		w, err := pw.WatchPayloads(ps, interval(name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to watch %v tokens: %v", name, err)
+		}
+		if w == nil {
+			unwatched = append(unwatched, name)
+			continue
+		}
+		watchers = append(watchers, w)
+	}
+	return watchers, unwatched, nil
+}
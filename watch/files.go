@@ -0,0 +1,166 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// settleTime is how long Files waits after a file
+// system event before it checks the files, so that a
+// burst of events (like an editor saving a file in
+// several writes) is checked once
+const settleTime = 20 * time.Millisecond
+
+// Files returns a Watcher which reports a change whenever
+// one of the files at paths is modified, created or
+// removed.
+//
+// It listens for file system events in the directories
+// which hold the files, so that a file which is replaced
+// (like a Kubernetes secret volume, whose files are
+// swapped by renaming a symlink), created or removed is
+// seen as well as one which is written. On each event,
+// it compares the size, modification time and mode of
+// the files with those it last saw.
+//
+// If the platform can't watch for file system events, or
+// the directory of a file can't be watched (because it
+// doesn't exist yet, or the limit on watches is reached),
+// the files are polled every interval instead (or not
+// at all, if interval is zero). Changes made on another
+// host to a network file system (like NFS) raise no
+// events, and are only seen when polling.
+func Files(interval time.Duration, paths ...string) Watcher {
+	stats := make([]fileStat, len(paths))
+	for i, path := range paths {
+		stats[i] = statFile(path)
+	}
+	check := func() (bool, error) {
+		changed := false
+		for i, path := range paths {
+			s := statFile(path)
+			if s.err != nil && !os.IsNotExist(s.err) {
+				return false, fmt.Errorf("failed to stat %v: %v", path, s.err)
+			}
+			if s != stats[i] {
+				changed = true
+			}
+			stats[i] = s
+		}
+		return changed, nil
+	}
+
+	return Func(func(ctx context.Context, changed func()) error {
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			if interval <= 0 {
+				<-ctx.Done()
+				return nil
+			}
+			return Poll(interval, check).Watch(ctx, changed)
+		}
+		defer w.Close()
+
+		poll := false
+		dirs := make(map[string]bool)
+		for _, path := range paths {
+			dir := filepath.Dir(path)
+			if dirs[dir] {
+				continue
+			}
+			dirs[dir] = true
+			if err := w.Add(dir); err != nil {
+				poll = interval > 0
+			}
+		}
+
+		report := func() error {
+			c, err := check()
+			if err != nil {
+				return err
+			}
+			if c {
+				changed()
+			}
+			return nil
+		}
+
+		// the files may have changed before
+		// their directories were watched
+		if err := report(); err != nil {
+			return err
+		}
+
+		var pollTimer *time.Timer
+		var pollC, settleC <-chan time.Time
+		if poll {
+			pollTimer = time.NewTimer(Jitter(interval, DefaultJitter))
+			defer pollTimer.Stop()
+			pollC = pollTimer.C
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+
+			case <-w.Events:
+				if settleC == nil {
+					settleC = time.After(settleTime)
+				}
+
+			case err := <-w.Errors:
+				// events were dropped, so the
+				// files must be checked
+				if err != fsnotify.ErrEventOverflow {
+					return fmt.Errorf("failed to watch files: %v", err)
+				}
+				if settleC == nil {
+					settleC = time.After(settleTime)
+				}
+
+			case <-settleC:
+				settleC = nil
+				if err := report(); err != nil {
+					return err
+				}
+
+			case <-pollC:
+				if err := report(); err != nil {
+					return err
+				}
+				pollTimer.Reset(Jitter(interval, DefaultJitter))
+			}
+		}
+	})
+}
+
+// A fileStat holds the parts of a
+// file's info which change with it
+type fileStat struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+	err     error
+}
+
+func statFile(path string) fileStat {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fileStat{}
+		}
+		return fileStat{err: err}
+	}
+	return fileStat{
+		exists:  true,
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		mode:    info.Mode(),
+	}
+}
@@ -0,0 +1,81 @@
+// package watch watches sources of secrets for changes
+
+package watch
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// DefaultJitter is the fraction by which watchers
+// randomize their waits (see Jitter)
+const DefaultJitter = 0.1
+
+// A Watcher watches a source of secrets
+type Watcher interface {
+	// Watch calls changed whenever the source may have
+	// changed, until ctx is done or it fails. Watch
+	// returns nil when ctx is done.
+	Watch(ctx context.Context, changed func()) error
+}
+
+// A Func is a function which is a Watcher
+type Func func(ctx context.Context, changed func()) error
+
+// Watch calls f
+func (f Func) Watch(ctx context.Context, changed func()) error {
+	return f(ctx, changed)
+}
+
+// Never returns a Watcher for a source which never
+// changes, like a secret which is encrypted in
+// its token
+func Never() Watcher {
+	return Func(func(ctx context.Context, changed func()) error {
+		<-ctx.Done()
+		return nil
+	})
+}
+
+// Poll returns a Watcher which calls check every interval
+// (randomized by DefaultJitter), and reports a change
+// whenever check returns true
+func Poll(interval time.Duration, check func() (bool, error)) Watcher {
+	return Func(func(ctx context.Context, changed func()) error {
+		for {
+			if !Sleep(ctx, Jitter(interval, DefaultJitter)) {
+				return nil
+			}
+			c, err := check()
+			if err != nil {
+				return err
+			}
+			if c {
+				changed()
+			}
+		}
+	})
+}
+
+// Jitter randomizes d by up to ±fraction of it, so that
+// many watchers don't poll in lockstep
+func Jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + fraction*(2*rand.Float64()-1)))
+}
+
+// Sleep waits for d, and returns true, or
+// returns false if ctx is done first
+func Sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,161 @@
+package watch_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dhoelle/redactr/watch"
+)
+
+// watchFor runs w for d, and returns how many
+// changes it reported and its error
+func watchFor(w watch.Watcher, d time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	var changes int64
+	err := w.Watch(ctx, func() { atomic.AddInt64(&changes, 1) })
+	return atomic.LoadInt64(&changes), err
+}
+
+func TestPoll(t *testing.T) {
+	t.Run("it should report a change whenever check returns true", func(t *testing.T) {
+		var checks int64
+		w := watch.Poll(5*time.Millisecond, func() (bool, error) {
+			return atomic.AddInt64(&checks, 1)%2 == 0, nil
+		})
+		changes, err := watchFor(w, 100*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Poll().Watch() got err: %v", err)
+		}
+		if changes == 0 || changes > atomic.LoadInt64(&checks)/2 {
+			t.Errorf("Poll().Watch() reported %v changes in %v checks", changes, atomic.LoadInt64(&checks))
+		}
+	})
+
+	t.Run("it should return the error of check", func(t *testing.T) {
+		w := watch.Poll(time.Millisecond, func() (bool, error) {
+			return false, fmt.Errorf("all is lost")
+		})
+		_, err := watchFor(w, time.Second)
+		if err == nil || !strings.Contains(err.Error(), "all is lost") {
+			t.Errorf(`Poll().Watch(): expected error with "all is lost", got: %v`, err)
+		}
+	})
+}
+
+func TestNever(t *testing.T) {
+	changes, err := watchFor(watch.Never(), 10*time.Millisecond)
+	if err != nil || changes != 0 {
+		t.Errorf("Never().Watch() got %v changes and err: %v", changes, err)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := watch.Jitter(time.Second, 0.1)
+		if d < 900*time.Millisecond || d > 1100*time.Millisecond {
+			t.Fatalf("Jitter(1s, 0.1) = %v, want within 10%% of 1s", d)
+		}
+	}
+	if d := watch.Jitter(time.Second, 0); d != time.Second {
+		t.Errorf("Jitter(1s, 0) = %v, want 1s", d)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	t.Run("it should report changes as file system events arrive, without polling", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "redactr-watch")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		testFiles(t, watch.Files(time.Hour, filepath.Join(dir, "config.redacted")), filepath.Join(dir, "config.redacted"))
+	})
+
+	t.Run("it should poll files in directories which can't be watched", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "redactr-watch")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		// the directory doesn't exist
+		// when the watch starts
+		path := filepath.Join(dir, "later", "config.redacted")
+		w := watch.Files(5*time.Millisecond, path)
+		if err := os.Mkdir(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		testFiles(t, w, path)
+	})
+}
+
+// testFiles watches the file at path with w, and
+// checks that it reports the file's changes
+func testFiles(t *testing.T, w watch.Watcher, path string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- w.Watch(ctx, func() { changes <- struct{}{} })
+	}()
+
+	expectChange := func(what string) {
+		t.Helper()
+		select {
+		case <-changes:
+		case err := <-errChan:
+			t.Fatalf("Files().Watch() got err: %v", err)
+		case <-time.After(time.Second):
+			t.Fatalf("Files().Watch(): expected a change when the file is %v", what)
+		}
+	}
+	expectNoChange := func(what string) {
+		t.Helper()
+		select {
+		case <-changes:
+			t.Errorf("Files().Watch(): expected no change when %v", what)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	if err := ioutil.WriteFile(path, []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("created")
+
+	if err := ioutil.WriteFile(path, []byte("ab"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("modified")
+
+	// replaced, like by an editor
+	// which saves atomically
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte("abc"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("replaced")
+
+	if err := ioutil.WriteFile(filepath.Join(filepath.Dir(path), "other"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectNoChange("another file in its directory changes")
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("removed")
+	expectNoChange("the file is unchanged")
+}
@@ -17,3 +17,36 @@ type StringWrapper struct {
 func (w *StringWrapper) WrapToken(token, originalPayload, originalEnvelope string) string {
 	return w.Before + token + w.After
 }
+
+// A ContextTokenWrapper wraps tokens which are
+// bound to a context label
+type ContextTokenWrapper interface {
+	WrapContextToken(token, context, originalPayload, originalEnvelope string) string
+}
+
+// ContextStringWrapper wraps tokens by putting strings
+// before and after each token, like StringWrapper.
+//
+// If the token is bound to a context label, the label
+// is written in square brackets between Before and
+// Separator, like:
+//
+//    ~~redacted-aes[db-password]:...~~
+//
+type ContextStringWrapper struct {
+	Before, Separator, After string
+}
+
+// WrapToken wraps the string with Before, Separator and After
+func (w *ContextStringWrapper) WrapToken(token, originalPayload, originalEnvelope string) string {
+	return w.Before + w.Separator + token + w.After
+}
+
+// WrapContextToken wraps the string with Before, the
+// context label, Separator and After
+func (w *ContextStringWrapper) WrapContextToken(token, context, originalPayload, originalEnvelope string) string {
+	if context == "" {
+		return w.WrapToken(token, originalPayload, originalEnvelope)
+	}
+	return w.Before + "[" + context + "]" + w.Separator + token + w.After
+}